@@ -2,32 +2,87 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer"
 )
 
+var (
+	verifyOnly   bool
+	verifyOutput string
+	guardPort    uint16
+)
+
 // initCmd represents the initialize command
 var initCmd = &cobra.Command{
 	Use:   "initialize",
 	Short: "Init configures the host, adding a new interface and updating route table",
 	Long: `This command creates a new dummy interface and attaches both link-local IPv4 and 
 IPv6 (if possible) addresses to interface. It also adds the required entries on the main
-route table to route traffic to the new interface.
+route table to route traffic to the new interface. Which address families must be set up
+is configured with --address-families.
+
+With --netns the interface is set up in another network namespace, eg. the one of a
+sandboxed runtime VM, instead of the current one.
+
+With --verify the host is only inspected and the command exits with a non-zero code
+if it is not set up as initialize would.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
-		executor, err := initalizer.NewExecutor()
+		executor, err := newExecutor(guardPort)
 		if err != nil {
 			log.Fatalf("Unable to initalize executor %v", err)
 		}
+		if verifyOnly {
+			report, err := executor.Verify(ctx)
+			if err != nil {
+				log.Fatalf("Unable to verify agent network: %v", err)
+			}
+			if err := printVerifyReport(os.Stdout, report, verifyOutput); err != nil {
+				log.Fatalf("Unable to print verification report: %v", err)
+			}
+			if !report.Ok() {
+				os.Exit(1)
+			}
+			return
+		}
 		if err := executor.Initialize(ctx); err != nil {
 			log.Fatalf("Unable to initalize agent: %v", err)
 		}
 	},
 }
 
+func printVerifyReport(w io.Writer, report initalizer.VerifyReport, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "table":
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(table, "CHECK\tTARGET\tSTATUS\tDETAIL")
+		for _, check := range report.Checks {
+			_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", check.Name, check.Target, check.Status, check.Detail)
+		}
+		return table.Flush()
+	default:
+		return fmt.Errorf("unknown output %q, expected table or json", output)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(initCmd)
+	addNetworkFlags(initCmd)
+	addNetnsFlag(initCmd)
+	initCmd.Flags().Uint16Var(&guardPort, "guard-port", 80, "Port of the agent restricted when --guard is set")
+	initCmd.Flags().BoolVar(&verifyOnly, "verify", false,
+		"Only check whether the host is set up, without changing it. Exits with a non-zero code on problems.")
+	initCmd.Flags().StringVarP(&verifyOutput, "output", "o", "table", "Format of the --verify report, either table or json")
 }
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/iproute"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/nftables"
+)
+
+var (
+	linkName         string
+	linkType         string
+	linkPeerName     string
+	linkPeerNetns    string
+	migrateLinkType  bool
+	linkAddresses    []string
+	addressFamilies  map[string]string
+	guardEnabled     bool
+	guardOpts        nftables.GuardOpts
+	guardAllowedUids []uint
+	routeTable       int
+	rulePriority     int
+	netnsPath        string
+)
+
+// addNetworkFlags adds the flags describing the agent link, which must be
+// the same for initialize, uninitialize and server
+func addNetworkFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&linkName, "link-name", configuration.AgentLinkName, "Name of the agent link")
+	cmd.Flags().StringVar(&linkType, "link-type", string(iproute.LinkTypeDummy),
+		"Type of the agent link: dummy, veth, or loopback to attach the addresses to lo where the dummy module cannot be loaded")
+	cmd.Flags().StringVar(&linkPeerName, "link-peer-name", "",
+		"Name of the other end of a veth agent link, --link-name with a p suffix if empty")
+	cmd.Flags().StringVar(&linkPeerNetns, "link-peer-netns", "",
+		"Path of a namespace, eg. /var/run/netns/pod-identity, the other end of a veth agent link is moved to")
+	cmd.Flags().BoolVar(&migrateLinkType, "migrate-link-type", false,
+		"Replace an existing agent link of another type than --link-type instead of failing")
+	cmd.Flags().StringSliceVar(&linkAddresses, "link-addresses", configuration.DefaultAgentAddresses(),
+		"Addresses the agent listens on, IPv4 link-local (169.254.0.0/16) or IPv6 unique local (fc00::/7)")
+	cmd.Flags().StringToStringVar(&addressFamilies, "address-families",
+		map[string]string{"ipv4": string(initalizer.FamilyRequired), "ipv6": string(initalizer.FamilyOptional)},
+		"Whether setting up each address family is required or optional, eg. ipv4=optional,ipv6=required for IPv6-only clusters")
+	cmd.Flags().IntVar(&routeTable, "route-table", 0,
+		"Route table the agent routes are added to, the main table if 0. Other tables are looked up through a rule at --rule-priority.")
+	cmd.Flags().IntVar(&rulePriority, "rule-priority", 100,
+		"Priority of the rule looking up --route-table, it must be lower than rules that would send the agent traffic elsewhere")
+	cmd.Flags().BoolVar(&guardEnabled, "guard", false,
+		"Install nftables rules so only the allowed pod CIDRs, interfaces and users can reach the agent. "+
+			"uninitialize removes the rules when set.")
+	cmd.Flags().StringSliceVar(&guardOpts.AllowedCIDRs, "guard-allowed-cidrs", nil,
+		"CIDRs, usually the pod CIDRs of the node, allowed to reach the agent when --guard is set")
+	cmd.Flags().StringSliceVar(&guardOpts.AllowedInterfaces, "guard-allowed-interfaces", nil,
+		"Interfaces, eg. eni* or veth*, allowed to reach the agent when --guard is set")
+	cmd.Flags().UintSliceVar(&guardAllowedUids, "guard-allowed-uids", nil,
+		"Users whose host network processes can reach the agent when --guard is set, none by default")
+	cmd.Flags().Uint32Var(&guardOpts.ProbeMark, "guard-probe-mark", nftables.DefaultProbeMark,
+		"Mark the agent sets on its probe connections so they pass the rules installed by --guard, which requires "+
+			"CAP_NET_ADMIN. Set 0 to disable, probes then only pass if the agent user is in --guard-allowed-uids.")
+}
+
+// addNetnsFlag adds the flag selecting the namespace the agent link is set
+// up in, for the commands that only set up the network
+func addNetnsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&netnsPath, "netns", "",
+		"Network namespace to set up instead of the current one, given as a path, eg. /var/run/netns/<name>, or the pid of a process in it")
+}
+
+func executorOpts(port uint16) (initalizer.ExecutorOpts, error) {
+	families, err := initalizer.ParseAddressFamilies(addressFamilies)
+	if err != nil {
+		return initalizer.ExecutorOpts{}, err
+	}
+	parsedLinkType, err := iproute.ParseLinkType(linkType)
+	if err != nil {
+		return initalizer.ExecutorOpts{}, err
+	}
+	opts := initalizer.ExecutorOpts{
+		LinkName:        linkName,
+		LinkType:        parsedLinkType,
+		LinkPeerName:    linkPeerName,
+		LinkPeerNetns:   linkPeerNetns,
+		MigrateLinkType: migrateLinkType,
+		Addresses:       linkAddresses,
+		AddressFamilies: families,
+		RouteTable:      routeTable,
+		RulePriority:    rulePriority,
+		Netns:           netnsPath,
+	}
+	if guardEnabled {
+		guardOpts.Port = port
+		guardOpts.AllowedUIDs = make([]uint32, len(guardAllowedUids))
+		for i, uid := range guardAllowedUids {
+			guardOpts.AllowedUIDs[i] = uint32(uid)
+		}
+		var guardNetns string
+		if netnsPath != "" {
+			guardNetns = initalizer.NetnsPath(netnsPath)
+		}
+		opts.Guard, err = nftables.NewNetlinkGuard(guardNetns, guardOpts)
+		if err != nil {
+			return initalizer.ExecutorOpts{}, err
+		}
+	}
+	return opts, nil
+}
+
+// newExecutor creates the executor configured by the network flags for an
+// agent listening on port
+func newExecutor(port uint16) (*initalizer.Executor, error) {
+	opts, err := executorOpts(port)
+	if err != nil {
+		return nil, err
+	}
+	return initalizer.NewExecutor(opts)
+}
+
+// agentTargetHosts validates --link-addresses and returns them in the form
+// requests are validated against
+func agentTargetHosts() ([]string, error) {
+	ips, err := configuration.ParseAgentAddresses(linkAddresses)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, len(ips))
+	for i, ip := range ips {
+		hosts[i] = ip.String()
+	}
+	return hosts, nil
+}
+
+// agentBindHosts turns target hosts into hosts the server can bind to,
+// IPv6 addresses are bracketed
+func agentBindHosts(targetHosts []string) []string {
+	hosts := make([]string, len(targetHosts))
+	for i, host := range targetHosts {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		hosts[i] = host
+	}
+	return hosts
+}
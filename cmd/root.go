@@ -7,14 +7,20 @@ import (
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 )
 
-var loggingVerbosity string
+var (
+	loggingVerbosity string
+	logFormat        string
+	logFieldMap      map[string]string
+	logSampling      logger.SamplingOpts
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "eks-pod-identity-agent",
 	Short: "The agent contains a proxy server and its initializer, for more information look at the server command",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		logger.Initialize(loggingVerbosity)
+		logger.InitializeWithFormat(loggingVerbosity, logger.Format(logFormat), logFieldMap)
+		logger.EnableSampling(logSampling)
 	},
 }
 
@@ -29,4 +35,16 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&loggingVerbosity, "verbosity", "v", "info", "Logging verbosity can be one of: panic, error, info, trace")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", string(logger.FormatJson),
+		"Logging format can be one of: json, logfmt, text")
+	rootCmd.PersistentFlags().StringToStringVar(&logFieldMap, "log-field-map", nil,
+		"Renames log fields to match a log pipeline, eg. msg=message,time=@timestamp,client-addr=client_ip")
+	rootCmd.PersistentFlags().DurationVar(&logSampling.Interval, "log-sampling-interval", 0,
+		"Interval in which repetitive info, debug and trace lines are sampled. Set 0 to disable sampling.")
+	rootCmd.PersistentFlags().IntVar(&logSampling.First, "log-sampling-first", 10,
+		"Amount of identical lines written in every sampling interval before sampling kicks in")
+	rootCmd.PersistentFlags().IntVar(&logSampling.Thereafter, "log-sampling-thereafter", 100,
+		"Once sampling kicks in only one out of this amount of identical lines is written. Set 0 to drop all of them.")
+	rootCmd.PersistentFlags().StringSliceVar(&logSampling.KeyFields, "log-sampling-keys", []string{"association-id"},
+		"Log fields that tell identical lines apart, eg. to sample every association separately")
 }
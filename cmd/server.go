@@ -3,8 +3,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
@@ -15,24 +17,55 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/audit"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/credsretriever"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/sharedcredsrotater"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/validation"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/handlers"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/server"
 )
 
 var (
-	serverPort              uint16
-	probePort               uint16
-	metricsAddress          string
-	metricsPort             uint16
-	bindHosts               []string
-	clusterName             string
-	overrideEksAuthEndpoint string
-	maxCredentialRenewal    time.Duration
-	maxCacheSize            int
-	refreshQps              int
-	rotateCredentials       bool
+	serverPort                uint16
+	probePort                 uint16
+	metricsAddress            string
+	metricsPort               uint16
+	adminPort                 uint16
+	bindHosts                 []string
+	clusterName               string
+	overrideEksAuthEndpoint   string
+	maxCredentialRenewal      time.Duration
+	credentialRenewalFraction float64
+	idleCredentialEviction    time.Duration
+	kubeletPodsUrl            string
+	kubeletTokenFile          string
+	kubeletCAFile             string
+	kubeletInsecure           bool
+	maxCacheSize              int
+	refreshQps                int
+	minRefreshQps             float64
+	refreshTuning             string
+	tokenAudience             string
+	tokenIssuers              []string
+	validateTokenSubject      bool
+	jwksFile                  string
+	jwksDiscoveryUrl          string
+	jwksRefreshInterval       time.Duration
+	accessPolicyFile          string
+	accessPolicyReload        time.Duration
+	validateCallerIp          bool
+	staticPodsFile            string
+	structuredErrors          bool
+	auditLog                  string
+	auditLogMaxSizeMb         int
+	auditLogMaxBackups        int
+	rotateCredentials         bool
+	initializeNetwork         bool
+	reconcileNetwork          bool
+	networkResyncInterval     time.Duration
 )
 
 var serverCmd = &cobra.Command{
@@ -59,25 +92,117 @@ var serverCmd = &cobra.Command{
 			log.Info("Credentials rotation enabled. Creds will be fetched and rotated from shared credentials file")
 			cfg.Credentials = aws.NewCredentialsCache(sharedcredsrotater.NewRotatingSharedCredentialsProvider())
 		}
+		handlerOpts, err := credentialHandlerOpts(cfg)
+		if err != nil {
+			log.Fatalf("Invalid credentials handler configuration: %v", err)
+		}
+		handlerOpts.TargetHosts, err = agentTargetHosts()
+		if err != nil {
+			log.Fatalf("Invalid link addresses: %v", err)
+		}
+		// bind to the link addresses unless told otherwise, so both can be
+		// changed at once
+		if !cmd.Flags().Changed("bind-hosts") {
+			bindHosts = agentBindHosts(handlerOpts.TargetHosts)
+		}
+		if err := handlerOpts.Validate(); err != nil {
+			log.Fatalf("Invalid credentials cache configuration: %v", err)
+		}
 
-		startServers(ctx, cfg)
+		startServers(ctx, handlerOpts)
 	},
 }
 
-func startServers(pCtx context.Context, cfg aws.Config) {
+func startServers(pCtx context.Context, handlerOpts handlers.EksCredentialHandlerOpts) {
 	ctx, cancel := context.WithCancel(pCtx)
 	wg := sync.WaitGroup{}
 
-	servers := createServers(cfg)
+	var executor *initalizer.Executor
+	if initializeNetwork || reconcileNetwork {
+		var err error
+		executor, err = newExecutor(serverPort)
+		if err != nil {
+			logger.FromContext(ctx).Fatalf("Unable to initalize executor %v", err)
+		}
+	}
+
+	// the credential servers share the handler, so its credentials cache
+	// and calls to EKS Auth, whatever the number of bind addresses
+	credentialHandler, err := handlers.NewEksCredentialHandler(handlerOpts)
+	if err != nil {
+		logger.FromContext(ctx).Fatalf("Unable to create credentials handler: %v", err)
+	}
+	credentialServers := createCredentialServers(credentialHandler)
+	var readinessChecks []handlers.ReadinessCheck
+	var startup *initalizer.Startup
+	if initializeNetwork {
+		startup = initalizer.NewStartup(executor, initalizer.StartupOpts{
+			Bind: func(ctx context.Context, failedAddrs []net.IP) error {
+				var bound []*server.Server
+				for _, srv := range credentialServers {
+					if bindsFailedAddr(srv.Addr(), failedAddrs) {
+						logger.FromContext(ctx).Warnf("Not listening on %s, its address could not be set up", srv.Addr())
+						continue
+					}
+					if err := srv.Listen(); err != nil {
+						return fmt.Errorf("unable to bind %s: %w", srv.Addr(), err)
+					}
+					bound = append(bound, srv)
+				}
+				// only the bound servers are started, the others would fail
+				// to listen on their address
+				credentialServers = bound
+				return nil
+			},
+		})
+		readinessChecks = append(readinessChecks, startup.Ready)
+	}
+	var reconciler *initalizer.Reconciler
+	if reconcileNetwork {
+		reconciler = initalizer.NewReconciler(executor, initalizer.ReconcilerOpts{
+			ResyncInterval: networkResyncInterval,
+		})
+		readinessChecks = append(readinessChecks, reconciler.Ready)
+	}
 
-	// start servers
-	for _, srv := range servers {
-		wg.Add(1)
-		go func(server *server.Server, childCtx context.Context) {
-			defer wg.Done()
-			server.ListenUntilContextCancelled(childCtx)
-		}(srv, logger.ContextWithField(ctx, "bind-addr", srv.Addr()))
+	// the probes are served during the network startup to report its
+	// progress
+	for _, srv := range createProbeServers(readinessChecks...) {
+		startServer(ctx, &wg, srv)
 	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// no request is served anymore once this returns, stop what the
+		// handler runs in the background
+		defer func() {
+			if err := credentialHandler.Close(); err != nil {
+				logger.FromContext(ctx).Errorf("Unable to close credentials handler: %v", err)
+			}
+		}()
+		// the startup only fails once ctx is done, the servers are not
+		// started then but some may have bound their address already
+		if startup != nil && startup.Run(ctx) != nil {
+			for _, srv := range credentialServers {
+				if err := srv.Close(); err != nil {
+					logger.FromContext(ctx).Errorf("Unable to close %s: %v", srv.Addr(), err)
+				}
+			}
+			return
+		}
+		if reconciler != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reconciler.Run(ctx)
+			}()
+		}
+		serversWg := sync.WaitGroup{}
+		for _, srv := range credentialServers {
+			startServer(ctx, &serversWg, srv)
+		}
+		serversWg.Wait()
+	}()
 
 	// Create a channel to listen for an interrupt or terminate signal from the operating system
 	// syscall.SIGTERM is equivalent to kill which allows the process time to cleanup
@@ -89,23 +214,128 @@ func startServers(pCtx context.Context, cfg aws.Config) {
 	wg.Wait()
 }
 
-func createServers(cfg aws.Config) []*server.Server {
+func startServer(ctx context.Context, wg *sync.WaitGroup, srv *server.Server) {
+	wg.Add(1)
+	go func(childCtx context.Context) {
+		defer wg.Done()
+		srv.ListenUntilContextCancelled(childCtx)
+	}(logger.ContextWithField(ctx, "bind-addr", srv.Addr()))
+}
+
+func credentialHandlerOpts(cfg aws.Config) (handlers.EksCredentialHandlerOpts, error) {
+	var podLister k8s.PodLister
+	if kubeletPodsUrl != "" {
+		var err error
+		podLister, err = k8s.NewKubeletPodLister(k8s.KubeletPodListerOpts{
+			PodsUrl:            kubeletPodsUrl,
+			TokenFile:          kubeletTokenFile,
+			CAFile:             kubeletCAFile,
+			InsecureSkipVerify: kubeletInsecure,
+		})
+		if err != nil {
+			return handlers.EksCredentialHandlerOpts{}, fmt.Errorf("creating kubelet pod lister: %w", err)
+		}
+	}
+	var keySet validation.KeySet
+	if jwksFile != "" || jwksDiscoveryUrl != "" {
+		keySet = validation.NewJwksKeySet(validation.JwksKeySetOpts{
+			File:            jwksFile,
+			DiscoveryUrl:    jwksDiscoveryUrl,
+			RefreshInterval: jwksRefreshInterval,
+		})
+	}
+	var podIPLookup k8s.PodIPLookup
+	if validateCallerIp {
+		switch {
+		case staticPodsFile != "":
+			staticLister, err := k8s.NewStaticPodLister(staticPodsFile)
+			if err != nil {
+				return handlers.EksCredentialHandlerOpts{}, fmt.Errorf("loading static pods: %w", err)
+			}
+			podIPLookup = k8s.NewPodIPLookup(staticLister)
+		case podLister != nil:
+			podIPLookup = k8s.NewPodIPLookup(podLister)
+		default:
+			return handlers.EksCredentialHandlerOpts{}, fmt.Errorf(
+				"validating the caller IP requires either --kubelet-pods-url or --static-pods-file")
+		}
+	}
+	var accessPolicy validation.AccessPolicy
+	if accessPolicyFile != "" {
+		var err error
+		accessPolicy, err = validation.NewFileAccessPolicy(accessPolicyFile, accessPolicyReload)
+		if err != nil {
+			return handlers.EksCredentialHandlerOpts{}, fmt.Errorf("loading access policy: %w", err)
+		}
+	}
+	var auditLogger audit.Logger
+	switch auditLog {
+	case "":
+	case "stdout":
+		auditLogger = audit.NewLogger(os.Stdout)
+	default:
+		auditFile, err := audit.NewRotatingFile(auditLog, int64(auditLogMaxSizeMb)*1024*1024, auditLogMaxBackups)
+		if err != nil {
+			return handlers.EksCredentialHandlerOpts{}, fmt.Errorf("opening audit log: %w", err)
+		}
+		auditLogger = audit.NewLogger(auditFile)
+	}
+	return handlers.EksCredentialHandlerOpts{
+		Cfg:                  cfg,
+		ClusterName:          clusterName,
+		CredentialRenewal:    maxCredentialRenewal,
+		RefreshFraction:      credentialRenewalFraction,
+		IdleEviction:         idleCredentialEviction,
+		PodLister:            podLister,
+		MaxCacheSize:         maxCacheSize,
+		RefreshQPS:           refreshQps,
+		MinRefreshQPS:        minRefreshQps,
+		RefreshTuning:        credsretriever.RefreshTuning(refreshTuning),
+		TokenAudience:        tokenAudience,
+		TokenIssuers:         tokenIssuers,
+		ValidateTokenSubject: validateTokenSubject,
+		TokenKeySet:          keySet,
+		AccessPolicy:         accessPolicy,
+		PodIPLookup:          podIPLookup,
+		StructuredErrors:     structuredErrors,
+		AuditLogger:          auditLogger,
+	}, nil
+}
+
+func createCredentialServers(handler *handlers.EksCredentialHandler) []*server.Server {
 	servers := make([]*server.Server, len(bindHosts))
 	// listen on all bindHosts
 	for i, ip := range bindHosts {
 		addr := fmt.Sprintf("%s:%d", ip, serverPort)
-		servers[i] = server.NewEksCredentialServer(addr, handlers.EksCredentialHandlerOpts{
-			Cfg:               cfg,
-			ClusterName:       clusterName,
-			CredentialRenewal: maxCredentialRenewal,
-			MaxCacheSize:      maxCacheSize,
-			RefreshQPS:        refreshQps,
-		})
+		servers[i] = server.NewEksCredentialServer(addr, handler)
 	}
+	return servers
+}
 
+// bindsFailedAddr tells whether addr is on one of the agent addresses that
+// could not be set up
+func bindsFailedAddr(addr string, failedAddrs []net.IP) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && slices.ContainsFunc(failedAddrs, ip.Equal)
+}
+
+func createProbeServers(readinessChecks ...handlers.ReadinessCheck) []*server.Server {
+	target := handlers.ProbeTarget{Hosts: bindHosts, Port: serverPort}
+	if guardEnabled {
+		target.Mark = guardOpts.ProbeMark
+	}
 	// add health probes listening on host's network
-	servers = append(servers, server.NewProbeServer(fmt.Sprintf("localhost:%d", probePort), bindHosts, serverPort))
-	servers = append(servers, server.NewMetricsServer(fmt.Sprintf("%s:%d", metricsAddress, metricsPort), bindHosts, serverPort))
+	servers := []*server.Server{
+		server.NewProbeServer(fmt.Sprintf("localhost:%d", probePort), target, readinessChecks...),
+		server.NewMetricsServer(fmt.Sprintf("%s:%d", metricsAddress, metricsPort), target, readinessChecks...),
+	}
+	if adminPort != 0 {
+		servers = append(servers, server.NewAdminServer(fmt.Sprintf("localhost:%d", adminPort)))
+	}
 	return servers
 }
 
@@ -125,6 +355,7 @@ func overrideEndpointInCfg(log *logrus.Entry, cfg *aws.Config, endpoint string)
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
+	addNetworkFlags(serverCmd)
 	// Read cluster name for CLI. This flag must be provided
 	serverCmd.Flags().StringVarP(&clusterName, "cluster-name", "c", "", "Name of the EKS Cluster the agent will run on")
 	err := serverCmd.MarkFlagRequired("cluster-name")
@@ -137,15 +368,73 @@ func init() {
 	serverCmd.Flags().Uint16Var(&probePort, "probe-port", 2703, "Health and readiness listening port")
 	serverCmd.Flags().StringVar(&metricsAddress, "metrics-address", "0.0.0.0", "Metrics listening address")
 	serverCmd.Flags().Uint16Var(&metricsPort, "metrics-port", 2705, "Metrics listening port")
+	serverCmd.Flags().Uint16Var(&adminPort, "admin-port", 0,
+		"Port listening on localhost for administrative requests, eg. changing the log level at runtime. Set 0 to disable.")
 	serverCmd.Flags().DurationVar(&maxCredentialRenewal, "max-credential-retention-before-renewal", 3*time.Hour,
 		"Maximum amount of time that agent waits before renewing credentials. Set 0 to disable caching.")
+	serverCmd.Flags().Float64Var(&credentialRenewalFraction, "credential-renewal-fraction", 0.8,
+		"Fraction of the credentials lifetime after which the agent renews them, must be within (0, 1]")
+	serverCmd.Flags().DurationVar(&idleCredentialEviction, "idle-credential-eviction", 0,
+		"Stop renewing credentials that were not requested for this amount of time. Set 0 to disable.")
+	serverCmd.Flags().StringVar(&kubeletPodsUrl, "kubelet-pods-url", "",
+		"Kubelet endpoint listing the pods on the node (eg. http://localhost:10255/pods), used to stop renewing credentials of deleted pods")
+	serverCmd.Flags().StringVar(&kubeletTokenFile, "kubelet-token-file", "", "File containing a bearer token used to call the kubelet")
+	serverCmd.Flags().StringVar(&kubeletCAFile, "kubelet-ca-file", "",
+		"File containing the certificates used to verify the kubelet serving certificate. Leave empty to use the system ones.")
+	serverCmd.Flags().BoolVar(&kubeletInsecure, "kubelet-insecure-skip-verify", false,
+		"Do not verify the kubelet serving certificate, eg. when the kubelet uses a self-signed certificate")
 	serverCmd.Flags().IntVar(&maxCacheSize, "max-cache-size", 2000,
 		"Maximum amount of unique credentials to cache. Set 0 to disable caching.")
 	serverCmd.Flags().IntVar(&refreshQps, "max-service-qps", 3,
 		"Maximum amount of queries per second to EKS Auth")
+	serverCmd.Flags().Float64Var(&minRefreshQps, "min-service-qps", 0.1,
+		"Minimum amount of queries per second to EKS Auth the agent backs off to when throttled")
+	serverCmd.Flags().StringVar(&refreshTuning, "refresh-tuning", string(credsretriever.RefreshTuningStatic),
+		"How credentials renewal is sized with respect to the cache size. 'static' requires max-service-qps and "+
+			"max-credential-retention-before-renewal to keep up with max-cache-size, 'auto' lengthens renewal as needed "+
+			"and backs off when EKS Auth throttles")
+	serverCmd.Flags().StringVar(&tokenAudience, "token-audience", configuration.DefaultTokenAudience,
+		"Audience service account tokens must be issued for. Set empty to disable the check.")
+	serverCmd.Flags().StringSliceVar(&tokenIssuers, "token-issuers", nil,
+		"Accepted service account token issuers, usually the cluster OIDC issuer. Leave empty to accept any issuer.")
+	serverCmd.Flags().BoolVar(&validateTokenSubject, "validate-token-subject", true,
+		"Check that service account tokens subject is system:serviceaccount:<namespace>:<name>")
+	serverCmd.Flags().StringVar(&jwksFile, "jwks-file", "",
+		"JWKS file used to verify service account token signatures. Takes precedence over --jwks-discovery-url.")
+	serverCmd.Flags().StringVar(&jwksDiscoveryUrl, "jwks-discovery-url", "",
+		"OIDC discovery URL (eg. <issuer>/.well-known/openid-configuration) of the keys used to verify service account "+
+			"token signatures. Signatures are left for EKS Auth to verify if neither this nor --jwks-file are set.")
+	serverCmd.Flags().DurationVar(&jwksRefreshInterval, "jwks-refresh-interval", time.Hour,
+		"How often the keys used to verify service account token signatures are reloaded")
+	serverCmd.Flags().StringVar(&accessPolicyFile, "access-policy-file", "",
+		"JSON file with the namespaces and service accounts allowed to fetch credentials. Leave empty to allow all.")
+	serverCmd.Flags().DurationVar(&accessPolicyReload, "access-policy-reload-interval", 30*time.Second,
+		"How often the access policy file is checked for changes")
+	serverCmd.Flags().BoolVar(&validateCallerIp, "validate-caller-ip", false,
+		"Only serve credentials to the pod the service account token was issued to, by matching the caller IP with the pod IPs")
+	serverCmd.Flags().StringVar(&staticPodsFile, "static-pods-file", "",
+		"JSON file listing the pods and their IPs used to validate the caller IP instead of the kubelet, meant for testing")
+	serverCmd.Flags().BoolVar(&structuredErrors, "structured-errors", false,
+		"Send errors as JSON bodies with stable error codes to all clients, not only those accepting application/json")
+	serverCmd.Flags().StringVar(&auditLog, "audit-log", "",
+		"Where to write a record of every issued credential, either 'stdout' or a file path. Leave empty to disable.")
+	serverCmd.Flags().IntVar(&auditLogMaxSizeMb, "audit-log-max-size-mb", 100,
+		"Size in megabytes after which the audit log file is rotated. Set 0 to disable rotation.")
+	serverCmd.Flags().IntVar(&auditLogMaxBackups, "audit-log-max-backups", 5,
+		"Maximum amount of rotated audit log files to keep")
 	serverCmd.Flags().StringArrayVarP(&bindHosts, "bind-hosts", "b",
-		[]string{configuration.DefaultIpv4TargetHost, "[" + configuration.DefaultIpv6TargetHost + "]"}, "Hosts to bind server to")
+		[]string{configuration.DefaultIpv4TargetHost, "[" + configuration.DefaultIpv6TargetHost + "]"},
+		"Hosts to bind server to, the --link-addresses by default")
 	serverCmd.Flags().BoolVar(&rotateCredentials, "rotate-credentials", false, "Enable credentials rotation from shared credentials file")
 	serverCmd.Flags().StringVar(&overrideEksAuthEndpoint, "endpoint", "", "Override for EKS auth endpoint")
+	serverCmd.Flags().BoolVar(&initializeNetwork, "initialize-network", false,
+		"Set up the link, addresses and routes like initialize before serving, so no separate initialize is needed. "+
+			"Binding is retried until the addresses are usable and the readiness probe reports the progress meanwhile, "+
+			"use a startup probe so the liveness probe does not fail before the agent is listening.")
+	serverCmd.Flags().BoolVar(&reconcileNetwork, "reconcile-network", false,
+		"Watch the link, addresses and routes set up by initialize and set them up again when they are changed. "+
+			"The readiness probe fails while they are not as expected.")
+	serverCmd.Flags().DurationVar(&networkResyncInterval, "network-resync-interval", time.Minute,
+		"How often the network is checked for changes when --reconcile-network is set, besides when the kernel notifies them")
 
 }
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// uninitCmd represents the uninitialize command
+var uninitCmd = &cobra.Command{
+	Use:   "uninitialize",
+	Short: "Uninitialize removes the interface and routes added by initialize",
+	Long: `This command removes the routes to the link-local IPv4 and IPv6 addresses,
+detaches the addresses and deletes the dummy interface created by initialize, as well
+as the nftables rules when --guard is set.
+It can be run repeatedly, anything that was already removed is skipped.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		// the port is not needed to remove the guard rules
+		executor, err := newExecutor(0)
+		if err != nil {
+			log.Fatalf("Unable to initalize executor %v", err)
+		}
+		if err := executor.Uninitialize(ctx); err != nil {
+			log.Fatalf("Unable to uninitialize agent: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uninitCmd)
+	addNetworkFlags(uninitCmd)
+	addNetnsFlag(uninitCmd)
+}
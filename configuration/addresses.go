@@ -0,0 +1,59 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ulaNetwork is the IPv6 unique local address range, fc00::/7
+var ulaNetwork = &net.IPNet{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)}
+
+// DefaultAgentAddresses are the addresses the agent listens on unless
+// configured otherwise
+func DefaultAgentAddresses() []string {
+	return []string{DefaultIpv4TargetHost, DefaultIpv6TargetHost}
+}
+
+// ParseAgentAddress parses an address the agent can listen on. Only IPv4
+// link-local (169.254.0.0/16) and IPv6 unique local (fc00::/7) addresses
+// are accepted as they are not routed outside of the node. IPv6 link-local
+// addresses are refused, pods cannot reach them through a route.
+func ParseAgentAddress(host string) (net.IP, error) {
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if ip == nil {
+		return nil, fmt.Errorf("%s is not an IP address", host)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if !ip4.IsLinkLocalUnicast() {
+			return nil, fmt.Errorf("%s is not an IPv4 link-local address (169.254.0.0/16)", host)
+		}
+		return ip4, nil
+	}
+	if !ulaNetwork.Contains(ip) {
+		return nil, fmt.Errorf("%s is not an IPv6 unique local address (fc00::/7)", host)
+	}
+	return ip, nil
+}
+
+// ParseAgentAddresses parses the addresses with ParseAgentAddress, failing
+// on the first invalid one or if there are none
+func ParseAgentAddresses(hosts []string) ([]net.IP, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("at least one address is required")
+	}
+	ips := make([]net.IP, len(hosts))
+	for i, host := range hosts {
+		ip, err := ParseAgentAddress(host)
+		if err != nil {
+			return nil, err
+		}
+		for _, previous := range ips[:i] {
+			if previous.Equal(ip) {
+				return nil, fmt.Errorf("address %s is repeated", host)
+			}
+		}
+		ips[i] = ip
+	}
+	return ips, nil
+}
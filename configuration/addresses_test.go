@@ -0,0 +1,72 @@
+package configuration
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseAgentAddresses(t *testing.T) {
+	testCases := []struct {
+		name             string
+		hosts            []string
+		expectedIPs      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:        "default addresses",
+			hosts:       DefaultAgentAddresses(),
+			expectedIPs: []string{DefaultIpv4TargetHost, DefaultIpv6TargetHost},
+		},
+		{
+			name:        "bracketed IPv6 address",
+			hosts:       []string{"169.254.170.24", "[fd00:ec2::24]"},
+			expectedIPs: []string{"169.254.170.24", "fd00:ec2::24"},
+		},
+		{
+			name:             "IPv4 address that is not link-local",
+			hosts:            []string{"10.0.0.1"},
+			expectedErrorMsg: "10.0.0.1 is not an IPv4 link-local address (169.254.0.0/16)",
+		},
+		{
+			name:             "IPv6 link-local address",
+			hosts:            []string{"fe80::1"},
+			expectedErrorMsg: "fe80::1 is not an IPv6 unique local address (fc00::/7)",
+		},
+		{
+			name:             "hostname",
+			hosts:            []string{"localhost"},
+			expectedErrorMsg: "localhost is not an IP address",
+		},
+		{
+			name:             "repeated address",
+			hosts:            []string{"169.254.170.24", "169.254.170.24"},
+			expectedErrorMsg: "address 169.254.170.24 is repeated",
+		},
+		{
+			name:             "no addresses",
+			expectedErrorMsg: "at least one address is required",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			ips, err := ParseAgentAddresses(tc.hosts)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			actual := make([]string, len(ips))
+			for i, ip := range ips {
+				actual[i] = ip.String()
+			}
+			g.Expect(actual).To(Equal(tc.expectedIPs))
+		})
+	}
+}
@@ -4,6 +4,9 @@ const (
 	DefaultIpv6TargetHost = "fd00:ec2::23"
 	DefaultIpv4TargetHost = "169.254.170.23"
 	AgentLinkName         = "pod-id-link0"
+	// DefaultTokenAudience is the audience of the service account tokens
+	// projected for EKS Pod Identity
+	DefaultTokenAudience = "pods.eks.amazonaws.com"
 )
 
 // RequestRate indicates the number of request allowed per second
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// accessKeyIdSuffixLength is how many trailing characters of the access key
+// id are recorded, enough to correlate with CloudTrail without exposing it
+const accessKeyIdSuffixLength = 4
+
+// Record describes a credential issued by the agent. It never holds the
+// service account token, secret access key or session token.
+type Record struct {
+	Time              time.Time `json:"time"`
+	Namespace         string    `json:"namespace,omitempty"`
+	ServiceAccount    string    `json:"serviceAccount,omitempty"`
+	PodName           string    `json:"podName,omitempty"`
+	PodUID            string    `json:"podUid,omitempty"`
+	AssociationId     string    `json:"associationId,omitempty"`
+	RoleArn           string    `json:"roleArn,omitempty"`
+	AccountId         string    `json:"accountId,omitempty"`
+	AccessKeyIdSuffix string    `json:"accessKeyIdSuffix,omitempty"`
+	CacheHit          bool      `json:"cacheHit"`
+	ClientAddr        string    `json:"clientAddr,omitempty"`
+}
+
+// AccessKeyIdSuffix returns the last characters of accessKeyId to be stored
+// in Record.AccessKeyIdSuffix
+func AccessKeyIdSuffix(accessKeyId string) string {
+	if len(accessKeyId) <= accessKeyIdSuffixLength {
+		return accessKeyId
+	}
+	return accessKeyId[len(accessKeyId)-accessKeyIdSuffixLength:]
+}
+
+// A Logger writes an audit trail of the credentials issued by the agent. It
+// is kept apart from the application logs so it is not affected by the
+// logging verbosity and can be shipped and retained separately.
+type Logger interface {
+	Log(record Record) error
+}
+
+type jsonLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogger creates a Logger that writes each record as a line of JSON to out
+func NewLogger(out io.Writer) Logger {
+	return &jsonLogger{out: out}
+}
+
+func (l *jsonLogger) Log(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to serialize audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(line); err != nil {
+		return fmt.Errorf("unable to write audit record: %w", err)
+	}
+	return nil
+}
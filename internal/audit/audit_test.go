@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLogger_Log(t *testing.T) {
+	testCases := []struct {
+		name         string
+		record       Record
+		expectedLine string
+	}{
+		{
+			name: "complete record",
+			record: Record{
+				Time:              time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Namespace:         "ns",
+				ServiceAccount:    "sa",
+				PodName:           "pod",
+				PodUID:            "uid",
+				AssociationId:     "a-123",
+				RoleArn:           "arn:aws:sts::123456789012:assumed-role/role/session",
+				AccountId:         "123456789012",
+				AccessKeyIdSuffix: "WXYZ",
+				CacheHit:          true,
+				ClientAddr:        "10.0.0.1:1234",
+			},
+			expectedLine: `{"time":"2024-01-02T03:04:05Z","namespace":"ns","serviceAccount":"sa","podName":"pod",` +
+				`"podUid":"uid","associationId":"a-123","roleArn":"arn:aws:sts::123456789012:assumed-role/role/session",` +
+				`"accountId":"123456789012","accessKeyIdSuffix":"WXYZ","cacheHit":true,"clientAddr":"10.0.0.1:1234"}` + "\n",
+		},
+		{
+			name:         "unknown fields are left out",
+			record:       Record{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			expectedLine: `{"time":"2024-01-02T03:04:05Z","cacheHit":false}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			out := &bytes.Buffer{}
+
+			// trigger
+			err := NewLogger(out).Log(tc.record)
+
+			// validate
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(out.String()).To(Equal(tc.expectedLine))
+		})
+	}
+}
+
+func TestAccessKeyIdSuffix(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(AccessKeyIdSuffix("ASIAABCDEFGHWXYZ")).To(Equal("WXYZ"))
+	g.Expect(AccessKeyIdSuffix("XYZ")).To(Equal("XYZ"))
+	g.Expect(AccessKeyIdSuffix("")).To(Equal(""))
+}
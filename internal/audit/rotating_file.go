@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// rotatingFile is a file that is rotated once it grows past maxSize bytes.
+// Rotated files are renamed to <path>.1, <path>.2 and so on up to
+// <path>.<maxBackups>, the oldest one being removed.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewRotatingFile opens path for appending, rotating it once it grows past
+// maxSize bytes and keeping at most maxBackups rotated files. A maxSize of 0
+// disables rotation.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (io.WriteCloser, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		// the record is still written to the current file if it cannot
+		// be rotated, the error is reported once it is written
+		rotateErr = f.rotate()
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// open opens the file at path. Must be called with the lock held
+func (f *rotatingFile) open() error {
+	file, size, err := openFile(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = size
+	return nil
+}
+
+// rotate shifts the backups, moves the current file to the first one and
+// opens a new file, only closing the current file once the new one is
+// open. Must be called with the lock held
+func (f *rotatingFile) rotate() error {
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove %s: %w", f.path, err)
+		}
+	} else {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			err := os.Rename(f.backupPath(i), f.backupPath(i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to rotate %s: %w", f.path, err)
+			}
+		}
+		if err := os.Rename(f.path, f.backupPath(1)); err != nil {
+			return fmt.Errorf("unable to rotate %s: %w", f.path, err)
+		}
+	}
+	file, size, err := openFile(f.path)
+	if err != nil {
+		if f.maxBackups > 0 {
+			// move the current file back so the next rotation starts over
+			_ = os.Rename(f.backupPath(1), f.path)
+		}
+		return err
+	}
+	old := f.file
+	f.file = file
+	f.size = size
+	if err := old.Close(); err != nil {
+		return fmt.Errorf("unable to close rotated %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// openFile opens path for appending, returning its current size
+func openFile(path string) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to open %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, fmt.Errorf("unable to stat %s: %w", path, err)
+	}
+	return file, info.Size(), nil
+}
+
+func (f *rotatingFile) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	testCases := []struct {
+		name          string
+		maxSize       int64
+		maxBackups    int
+		lines         []string
+		expectedFiles map[string]string
+	}{
+		{
+			name:       "rotates once the file is full",
+			maxSize:    10,
+			maxBackups: 2,
+			lines:      []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"},
+			expectedFiles: map[string]string{
+				"audit.log":   "line-4\n",
+				"audit.log.1": "line-3\n",
+				"audit.log.2": "line-2\n",
+			},
+		},
+		{
+			name:       "without backups the file is truncated",
+			maxSize:    10,
+			maxBackups: 0,
+			lines:      []string{"line-1\n", "line-2\n"},
+			expectedFiles: map[string]string{
+				"audit.log": "line-2\n",
+			},
+		},
+		{
+			name:       "rotation disabled",
+			maxSize:    0,
+			maxBackups: 2,
+			lines:      []string{"line-1\n", "line-2\n"},
+			expectedFiles: map[string]string{
+				"audit.log": "line-1\nline-2\n",
+			},
+		},
+		{
+			name:       "lines larger than the maximum size are written whole",
+			maxSize:    4,
+			maxBackups: 1,
+			lines:      []string{"line-1\n", "line-2\n"},
+			expectedFiles: map[string]string{
+				"audit.log":   "line-2\n",
+				"audit.log.1": "line-1\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			dir := t.TempDir()
+			file, err := NewRotatingFile(filepath.Join(dir, "audit.log"), tc.maxSize, tc.maxBackups)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// trigger
+			for _, line := range tc.lines {
+				_, err = file.Write([]byte(line))
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+			g.Expect(file.Close()).To(Succeed())
+
+			// validate
+			entries, err := os.ReadDir(dir)
+			g.Expect(err).ToNot(HaveOccurred())
+			files := map[string]string{}
+			for _, entry := range entries {
+				content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+				g.Expect(err).ToNot(HaveOccurred())
+				files[entry.Name()] = string(content)
+			}
+			g.Expect(files).To(Equal(tc.expectedFiles))
+		})
+	}
+}
+
+func TestRotatingFile_AppendsToExistingFile(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	path := filepath.Join(t.TempDir(), "audit.log")
+	g.Expect(os.WriteFile(path, []byte("line-1\n"), 0600)).To(Succeed())
+
+	// trigger, the existing content counts towards the maximum size
+	file, err := NewRotatingFile(path, 10, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = file.Write([]byte("line-2\n"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(file.Close()).To(Succeed())
+
+	// validate
+	g.Expect(os.ReadFile(path)).To(Equal([]byte("line-2\n")))
+	g.Expect(os.ReadFile(path + ".1")).To(Equal([]byte("line-1\n")))
+}
+
+func TestRotatingFile_KeepsWritingWhenRotationFails(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup, the backup cannot be replaced by the current file
+	path := filepath.Join(t.TempDir(), "audit.log")
+	g.Expect(os.MkdirAll(filepath.Join(path+".1", "some-dir"), 0700)).To(Succeed())
+	file, err := NewRotatingFile(path, 10, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = file.Write([]byte("line-1\n"))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger
+	n, err := file.Write([]byte("line-2\n"))
+
+	// validate, the line is written to the current file
+	g.Expect(err).To(MatchError(ContainSubstring("unable to rotate " + path)))
+	g.Expect(n).To(Equal(len("line-2\n")))
+	g.Expect(file.Close()).To(Succeed())
+	g.Expect(os.ReadFile(path)).To(Equal([]byte("line-1\nline-2\n")))
+}
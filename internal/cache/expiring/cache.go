@@ -667,9 +667,14 @@ type keyAndValue[K comparable, V any] struct {
 type janitor[K comparable, V any] struct {
 	Interval time.Duration
 	stop     chan bool
+	// stopOnce and done let the janitor be stopped both by Close and the
+	// finalizer
+	stopOnce sync.Once
+	done     chan struct{}
 }
 
 func (j *janitor[K, V]) run(c *cache[K, V]) {
+	defer close(j.done)
 	ticker := time.NewTicker(j.Interval)
 	for {
 		select {
@@ -683,13 +688,26 @@ func (j *janitor[K, V]) run(c *cache[K, V]) {
 }
 
 func stopJanitor[K comparable, V any](c *Cache[K, V]) {
-	c.janitor.stop <- true
+	c.janitor.stopOnce.Do(func() { close(c.janitor.stop) })
+}
+
+// Close stops the janitor, waiting for a cleanup in progress to complete.
+// Expired items are then only refreshed or evicted by calling
+// RefreshOrEvictExpired. Closing the cache again does nothing.
+func (c *Cache[K, V]) Close() {
+	if c.janitor == nil {
+		return
+	}
+	runtime.SetFinalizer(c, nil)
+	stopJanitor(c)
+	<-c.janitor.done
 }
 
 func runJanitor[K comparable, V any](c *cache[K, V], ci time.Duration) {
 	j := &janitor[K, V]{
 		Interval: ci,
 		stop:     make(chan bool),
+		done:     make(chan struct{}),
 	}
 	c.janitor = j
 	go j.run(c)
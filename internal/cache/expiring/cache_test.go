@@ -616,6 +616,22 @@ func TestFinal(t *testing.T) {
 	}
 }
 
+func TestClose(t *testing.T) {
+	var refreshed int
+	tc := NewLru[string, any](100, NoExpiration, time.Millisecond)
+	tc.OnRefresh(func(string, any) { refreshed++ })
+
+	tc.Close()
+	tc.Close()
+	tc.SetWithRefreshExpire("asd", "zxc", time.Nanosecond, NoExpiration)
+	time.Sleep(20 * time.Millisecond)
+	if refreshed != 0 {
+		t.Fatalf("janitor refreshed %d items after the cache was closed", refreshed)
+	}
+	// the finalizer must not block on the stopped janitor
+	runtime.GC()
+}
+
 func TestRename(t *testing.T) {
 	tc := NewLru[string, int](100, NoExpiration, 0)
 	tc.Set("foo", 3)
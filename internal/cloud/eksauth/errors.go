@@ -2,7 +2,9 @@ package eksauth
 
 import (
 	"errors"
+	"net/http"
 
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/eksauth/types"
 	"github.com/aws/smithy-go"
 )
@@ -24,3 +26,14 @@ func IsIrrecoverableApiError(err error) (string, bool) {
 	}
 	return errCodeUnknown, false
 }
+
+// IsThrottlingError checks if EKS Auth rejected the call because the agent
+// is sending too many requests
+func IsThrottlingError(err error) bool {
+	var throttlingErr *types.ThrottlingException
+	if errors.As(err, &throttlingErr) {
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusTooManyRequests
+}
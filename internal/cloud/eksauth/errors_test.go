@@ -3,9 +3,12 @@ package eksauth
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"testing"
 
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/eksauth/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	. "github.com/onsi/gomega"
 )
 
@@ -76,3 +79,58 @@ func TestIsIrrecoverableApiError(t *testing.T) {
 		})
 	}
 }
+
+func TestIsThrottlingError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "throttling exception",
+			err:      &types.ThrottlingException{},
+			expected: true,
+		},
+		{
+			name:     "wrapped throttling exception",
+			err:      fmt.Errorf("error, layer 1: %w", &types.ThrottlingException{}),
+			expected: true,
+		},
+		{
+			name:     "too many requests response",
+			err:      responseError(http.StatusTooManyRequests),
+			expected: true,
+		},
+		{
+			name:     "other response",
+			err:      responseError(http.StatusInternalServerError),
+			expected: false,
+		},
+		{
+			name:     "other exception",
+			err:      &types.InternalServerException{},
+			expected: false,
+		},
+		{
+			name:     "unknown error",
+			err:      errors.New("custom error"),
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(IsThrottlingError(test.err)).To(Equal(test.expected))
+		})
+	}
+}
+
+func responseError(statusCode int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+			Err:      errors.New("response error"),
+		},
+	}
+}
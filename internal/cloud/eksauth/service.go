@@ -44,10 +44,17 @@ func NewService(cfg aws.Config) Iface {
 	}
 }
 
-type responseMetadata string
+type responseMetadata struct {
+	associationId  string
+	assumedRoleArn string
+}
 
 func (r responseMetadata) AssociationId() string {
-	return string(r)
+	return r.associationId
+}
+
+func (r responseMetadata) AssumedRoleArn() string {
+	return r.assumedRoleArn
 }
 
 func (s *service) GetIamCredentials(ctx context.Context,
@@ -63,13 +70,20 @@ func (s *service) GetIamCredentials(ctx context.Context,
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to fetch credentials from EKS Auth: %w", err)
 	}
+	return parseAssumeRoleOutput(ctx, creds, time.Since(startRequestTime))
+}
 
+// parseAssumeRoleOutput converts the EKS Auth response into credentials,
+// requestTime is how long EKS Auth took to respond
+func parseAssumeRoleOutput(ctx context.Context, creds *eksauth.AssumeRoleForPodIdentityOutput,
+	requestTime time.Duration) (*credentials.EksCredentialsResponse, credentials.ResponseMetadata, error) {
+	log := logger.FromContext(ctx)
 	if creds.Credentials == nil || creds.AssumedRoleUser == nil {
 		return nil, nil, fmt.Errorf("invalid response from server: credentials or assumed role empty: %v", creds)
 	}
 
 	log.WithFields(logrus.Fields{
-		"request_time_ms":  time.Since(startRequestTime).Milliseconds(),
+		"request_time_ms":  requestTime.Milliseconds(),
 		"fetched_role_arn": *creds.AssumedRoleUser.Arn,
 		"fetched_role_id":  *creds.AssumedRoleUser.AssumeRoleId,
 	}).Infof("Successfully fetched credentials from EKS Auth")
@@ -87,5 +101,8 @@ func (s *service) GetIamCredentials(ctx context.Context,
 		Token:           *creds.Credentials.SessionToken,
 		AccountId:       parsedArn.AccountID,
 		Expiration:      credentials.SdkCompliantExpirationTime{Time: *creds.Credentials.Expiration},
-	}, responseMetadata(*creds.PodIdentityAssociation.AssociationId), nil
+	}, responseMetadata{
+		associationId:  *creds.PodIdentityAssociation.AssociationId,
+		assumedRoleArn: *assumedUserArn,
+	}, nil
 }
@@ -0,0 +1,76 @@
+package eksauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eksauth"
+	"github.com/aws/aws-sdk-go-v2/service/eksauth/types"
+	. "github.com/onsi/gomega"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+)
+
+func TestParseAssumeRoleOutput_DoesNotLogSecrets(t *testing.T) {
+	someCredentials := &types.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLEEXAMPLE"),
+		SecretAccessKey: aws.String(test.SecretAccessKeyForTest),
+		SessionToken:    aws.String(test.SessionTokenForTest),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}
+
+	testCases := []struct {
+		name          string
+		output        *eksauth.AssumeRoleForPodIdentityOutput
+		expectedError string
+	}{
+		{
+			name: "successful response",
+			output: &eksauth.AssumeRoleForPodIdentityOutput{
+				AssumedRoleUser: &types.AssumedRoleUser{
+					Arn:          aws.String("arn:aws:sts::123456789012:assumed-role/some-role/session"),
+					AssumeRoleId: aws.String("AROAEXAMPLE:session"),
+				},
+				Credentials:            someCredentials,
+				PodIdentityAssociation: &types.PodIdentityAssociation{AssociationId: aws.String("a-123")},
+			},
+		},
+		{
+			name: "response without assumed role",
+			output: &eksauth.AssumeRoleForPodIdentityOutput{
+				Credentials: someCredentials,
+			},
+			expectedError: "invalid response from server",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			logs := test.CaptureLogsForTest(t)
+			ctx := context.Background()
+
+			// trigger, errors are logged by the callers
+			creds, _, err := parseAssumeRoleOutput(ctx, tc.output, time.Second)
+			if err != nil {
+				logger.FromContext(ctx).Errorf("Error fetching credentials: %v", err)
+			}
+
+			// validate
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(creds.SecretAccessKey).To(Equal(test.SecretAccessKeyForTest))
+				logger.FromContext(ctx).Debugf("Fetched %+v", *creds)
+			}
+			g.Expect(logs.String()).ToNot(BeEmpty())
+			g.Expect(logs.String()).ToNot(ContainSubstring(test.SecretAccessKeyForTest))
+			g.Expect(logs.String()).ToNot(ContainSubstring(test.SessionTokenForTest[:40]))
+		})
+	}
+}
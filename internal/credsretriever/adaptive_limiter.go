@@ -0,0 +1,101 @@
+package credsretriever
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+var (
+	promServiceQps = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_identity_eks_auth_qps",
+		Help: "Maximum amount of queries per second currently allowed to EKS Auth",
+	})
+	promServiceThrottles = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pod_identity_eks_auth_throttles",
+		Help: "Number of calls to EKS Auth that were throttled",
+	})
+)
+
+const (
+	// adaptiveQPSDecrease is the factor the limit is multiplied by when EKS
+	// Auth throttles a call
+	adaptiveQPSDecrease = 0.5
+	// adaptiveQPSIncrease is how much the limit grows after each call that was
+	// not throttled
+	adaptiveQPSIncrease rate.Limit = 0.1
+)
+
+// adaptiveLimiter is a rate limiter for calls to EKS Auth that follows an
+// additive increase, multiplicative decrease policy: the limit is cut every
+// time a call is throttled and probes upward again as calls succeed, always
+// staying within [minQPS, maxQPS].
+type adaptiveLimiter struct {
+	mu      sync.Mutex
+	limiter *rate.Limiter
+	minQPS  rate.Limit
+	maxQPS  rate.Limit
+}
+
+func newAdaptiveLimiter(minQPS, maxQPS rate.Limit) *adaptiveLimiter {
+	promServiceQps.Set(float64(maxQPS))
+	return &adaptiveLimiter{
+		limiter: rate.NewLimiter(maxQPS, limiterBurst(maxQPS)),
+		minQPS:  minQPS,
+		maxQPS:  maxQPS,
+	}
+}
+
+// Wait blocks until a call is allowed or ctx is done
+func (l *adaptiveLimiter) Wait(ctx context.Context) error {
+	return l.limiter.Wait(ctx)
+}
+
+// Take accounts for a call that cannot be delayed, calls waiting on the
+// limiter are pushed back instead
+func (l *adaptiveLimiter) Take() {
+	l.limiter.Reserve()
+}
+
+// Limit returns the number of calls per second currently allowed
+func (l *adaptiveLimiter) Limit() rate.Limit {
+	return l.limiter.Limit()
+}
+
+// OnThrottled backs the limit off after EKS Auth throttled a call
+func (l *adaptiveLimiter) OnThrottled() {
+	promServiceThrottles.Inc()
+	l.setLimit(func(limit rate.Limit) rate.Limit {
+		return limit * adaptiveQPSDecrease
+	})
+}
+
+// OnSuccess probes the limit upward after a call that was not throttled
+func (l *adaptiveLimiter) OnSuccess() {
+	l.setLimit(func(limit rate.Limit) rate.Limit {
+		return limit + adaptiveQPSIncrease
+	})
+}
+
+func (l *adaptiveLimiter) setLimit(update func(limit rate.Limit) rate.Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := min(max(update(l.limiter.Limit()), l.minQPS), l.maxQPS)
+	if limit == l.limiter.Limit() {
+		return
+	}
+	l.limiter.SetLimit(limit)
+	// the burst follows the limit, otherwise calls saved up while the limit
+	// was higher would still be sent at once after a throttle
+	l.limiter.SetBurst(limiterBurst(limit))
+	promServiceQps.Set(float64(limit))
+}
+
+// limiterBurst is the number of calls allowed at once with limit, at least
+// one so limits below one call per second still let calls through
+func limiterBurst(limit rate.Limit) int {
+	return max(int(limit), 1)
+}
@@ -0,0 +1,93 @@
+package credsretriever
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	tests := []struct {
+		name          string
+		minQPS        rate.Limit
+		maxQPS        rate.Limit
+		feedback      func(l *adaptiveLimiter)
+		expectedLimit rate.Limit
+		expectedBurst int
+	}{
+		{
+			name:          "starts at the maximum",
+			minQPS:        0.1,
+			maxQPS:        3,
+			feedback:      func(l *adaptiveLimiter) {},
+			expectedLimit: 3,
+			expectedBurst: 3,
+		},
+		{
+			name:   "halves the limit when throttled",
+			minQPS: 0.1,
+			maxQPS: 3,
+			feedback: func(l *adaptiveLimiter) {
+				l.OnThrottled()
+				l.OnThrottled()
+			},
+			expectedLimit: 0.75,
+			expectedBurst: 1,
+		},
+		{
+			name:   "does not back off below the minimum",
+			minQPS: 0.5,
+			maxQPS: 3,
+			feedback: func(l *adaptiveLimiter) {
+				for i := 0; i < 10; i++ {
+					l.OnThrottled()
+				}
+			},
+			expectedLimit: 0.5,
+			expectedBurst: 1,
+		},
+		{
+			name:   "probes upward on success",
+			minQPS: 0.1,
+			maxQPS: 3,
+			feedback: func(l *adaptiveLimiter) {
+				l.OnThrottled()
+				for i := 0; i < 5; i++ {
+					l.OnSuccess()
+				}
+			},
+			expectedLimit: 2,
+			expectedBurst: 2,
+		},
+		{
+			name:   "does not probe above the maximum",
+			minQPS: 0.1,
+			maxQPS: 3,
+			feedback: func(l *adaptiveLimiter) {
+				l.OnThrottled()
+				for i := 0; i < 100; i++ {
+					l.OnSuccess()
+				}
+			},
+			expectedLimit: 3,
+			expectedBurst: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			limiter := newAdaptiveLimiter(tc.minQPS, tc.maxQPS)
+
+			// trigger
+			tc.feedback(limiter)
+
+			// validate
+			g.Expect(limiter.Limit()).To(BeNumerically("~", tc.expectedLimit, 0.001))
+			g.Expect(limiter.limiter.Burst()).To(Equal(tc.expectedBurst))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package credsretriever
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var promRefreshQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pod_identity_refresh_queue_depth",
+	Help: "Number of credentials waiting to be renewed",
+})
+
+// refreshQueue is a priority queue of cache entries waiting to be renewed,
+// entries whose credentials expire first are popped first. Each key is
+// queued at most once, pushing a key that is already queued replaces its
+// entry and pushing a key that is being renewed is a no-op.
+type refreshQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	items refreshHeap
+	keys  map[string]*refreshItem
+	// inFlight tracks the keys that were popped but not marked as Done yet
+	inFlight map[string]struct{}
+	// closed is set by Close to release the callers blocked in Pop
+	closed bool
+}
+
+type refreshItem struct {
+	key   string
+	entry cacheEntry
+	// index of the item in the heap, maintained by the heap.Interface methods
+	index int
+}
+
+func newRefreshQueue() *refreshQueue {
+	q := &refreshQueue{
+		keys:     make(map[string]*refreshItem),
+		inFlight: make(map[string]struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push queues the entry for renewal
+func (q *refreshQueue) Push(key string, entry cacheEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.inFlight[key]; ok {
+		return
+	}
+	if item, ok := q.keys[key]; ok {
+		item.entry = entry
+		heap.Fix(&q.items, item.index)
+		return
+	}
+
+	item := &refreshItem{key: key, entry: entry}
+	heap.Push(&q.items, item)
+	q.keys[key] = item
+	promRefreshQueueDepth.Inc()
+	q.cond.Signal()
+}
+
+// Pop blocks until there is an entry in the queue and returns the one
+// whose credentials expire first, or false once the queue is closed.
+// Callers must call Done once they are finished with the key.
+func (q *refreshQueue) Pop() (string, cacheEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.items.Len() == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return "", cacheEntry{}, false
+	}
+	item := heap.Pop(&q.items).(*refreshItem)
+	delete(q.keys, item.key)
+	q.inFlight[item.key] = struct{}{}
+	promRefreshQueueDepth.Dec()
+	return item.key, item.entry, true
+}
+
+// Close releases the callers blocked in Pop, entries still queued are not
+// returned anymore
+func (q *refreshQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// Done marks the renewal of a popped key as finished, allowing it to be
+// queued again
+func (q *refreshQueue) Done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, key)
+}
+
+// Len returns the number of entries waiting to be renewed
+func (q *refreshQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// refreshHeap implements heap.Interface ordering items by the expiration of
+// their credentials
+type refreshHeap []*refreshItem
+
+func (h refreshHeap) Len() int { return len(h) }
+
+func (h refreshHeap) Less(i, j int) bool {
+	return h[i].entry.credentials.Expiration.Time.Before(h[j].entry.credentials.Expiration.Time)
+}
+
+func (h refreshHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *refreshHeap) Push(x any) {
+	item := x.(*refreshItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *refreshHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,116 @@
+package credsretriever
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
+)
+
+func entryExpiringAt(expiration time.Time) cacheEntry {
+	return cacheEntry{
+		credentials: &credentials.EksCredentialsResponse{
+			Expiration: credentials.SdkCompliantExpirationTime{Time: expiration},
+		},
+	}
+}
+
+func TestRefreshQueue(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name         string
+		pushes       []string
+		expirations  []time.Time
+		expectedKeys []string
+	}{
+		{
+			name:         "pops credentials closest to expiry first",
+			pushes:       []string{"b", "c", "a"},
+			expirations:  []time.Time{now.Add(2 * time.Hour), now.Add(3 * time.Hour), now.Add(time.Hour)},
+			expectedKeys: []string{"a", "b", "c"},
+		},
+		{
+			name:         "queues each key once, keeping the latest entry",
+			pushes:       []string{"a", "b", "a"},
+			expirations:  []time.Time{now.Add(time.Hour), now.Add(2 * time.Hour), now.Add(3 * time.Hour)},
+			expectedKeys: []string{"b", "a"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			q := newRefreshQueue()
+			for i, key := range tc.pushes {
+				q.Push(key, entryExpiringAt(tc.expirations[i]))
+			}
+
+			// trigger
+			g.Expect(q.Len()).To(Equal(len(tc.expectedKeys)))
+			var keys []string
+			for q.Len() > 0 {
+				key, _, _ := q.Pop()
+				keys = append(keys, key)
+			}
+
+			// validate
+			g.Expect(keys).To(Equal(tc.expectedKeys))
+		})
+	}
+}
+
+func TestRefreshQueue_PopBlocksUntilPush(t *testing.T) {
+	g := NewWithT(t)
+	q := newRefreshQueue()
+
+	popped := make(chan string)
+	go func() {
+		key, _, _ := q.Pop()
+		popped <- key
+	}()
+	g.Consistently(popped, 100*time.Millisecond).ShouldNot(Receive())
+
+	q.Push("a", entryExpiringAt(time.Now()))
+	g.Eventually(popped).Should(Receive(Equal("a")))
+}
+
+func TestRefreshQueue_IgnoresKeysInFlight(t *testing.T) {
+	g := NewWithT(t)
+	q := newRefreshQueue()
+
+	q.Push("a", entryExpiringAt(time.Now()))
+	key, _, _ := q.Pop()
+	g.Expect(key).To(Equal("a"))
+
+	// key is being renewed, it should not be queued again
+	q.Push("a", entryExpiringAt(time.Now()))
+	g.Expect(q.Len()).To(Equal(0))
+
+	q.Done("a")
+	q.Push("a", entryExpiringAt(time.Now()))
+	g.Expect(q.Len()).To(Equal(1))
+}
+
+func TestRefreshQueue_CloseReleasesPop(t *testing.T) {
+	g := NewWithT(t)
+	q := newRefreshQueue()
+
+	popped := make(chan bool)
+	go func() {
+		_, _, ok := q.Pop()
+		popped <- ok
+	}()
+	g.Consistently(popped, 100*time.Millisecond).ShouldNot(Receive())
+
+	q.Close()
+	g.Eventually(popped).Should(Receive(BeFalse()))
+
+	// entries pushed after closing are not returned
+	q.Push("a", entryExpiringAt(time.Now()))
+	_, _, ok := q.Pop()
+	g.Expect(ok).To(BeFalse())
+}
@@ -0,0 +1,47 @@
+package credsretriever
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+var promRenewalTtl = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pod_identity_renewal_ttl_seconds",
+	Help: "Maximum amount of time credentials are held before being renewed",
+})
+
+// refreshTuner keeps the renewals of a full cache within the refresh rate
+// limit by lengthening the renewal ttl when needed. As the limit backs off
+// when EKS Auth throttles, the renewal ttl follows it.
+type refreshTuner struct {
+	limiter      *adaptiveLimiter
+	maxCacheSize int
+	// configuredRenewalTtl is the renewal ttl asked for in the configuration,
+	// the tuner never renews credentials more often than it
+	configuredRenewalTtl time.Duration
+}
+
+func newRefreshTuner(limiter *adaptiveLimiter, maxCacheSize int, configuredRenewalTtl time.Duration) *refreshTuner {
+	return &refreshTuner{
+		limiter:              limiter,
+		maxCacheSize:         maxCacheSize,
+		configuredRenewalTtl: configuredRenewalTtl,
+	}
+}
+
+// renewalTtl is the maximum amount of time credentials can be held before
+// renewing them at the current refresh rate
+func (t *refreshTuner) renewalTtl() time.Duration {
+	ttl := max(t.configuredRenewalTtl, requiredRenewalTtl(t.maxCacheSize, t.limiter.Limit()))
+	promRenewalTtl.Set(ttl.Seconds())
+	return ttl
+}
+
+// requiredRenewalTtl is the shortest renewal ttl that allows renewing half of
+// a full cache at the given rate
+func requiredRenewalTtl(maxCacheSize int, qps rate.Limit) time.Duration {
+	return time.Duration(float64(maxCacheSize) / 2 / float64(qps) * float64(time.Second))
+}
@@ -0,0 +1,61 @@
+package credsretriever
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+)
+
+func TestRefreshTuner(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxCacheSize       int
+		qps                rate.Limit
+		configuredTtl      time.Duration
+		throttles          int
+		expectedRenewalTtl time.Duration
+	}{
+		{
+			name:               "configured renewal is kept when it keeps up with the cache",
+			maxCacheSize:       2000,
+			qps:                3,
+			configuredTtl:      time.Hour,
+			expectedRenewalTtl: time.Hour,
+		},
+		{
+			name:               "renewal is lengthened to keep up with the cache",
+			maxCacheSize:       2000,
+			qps:                2,
+			configuredTtl:      time.Minute,
+			expectedRenewalTtl: 500 * time.Second,
+		},
+		{
+			name:               "renewal follows the limit when throttled",
+			maxCacheSize:       2000,
+			qps:                2,
+			configuredTtl:      time.Minute,
+			throttles:          1,
+			expectedRenewalTtl: 1000 * time.Second,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			limiter := newAdaptiveLimiter(0.1, tc.qps)
+			tuner := newRefreshTuner(limiter, tc.maxCacheSize, tc.configuredTtl)
+
+			// trigger
+			for i := 0; i < tc.throttles; i++ {
+				limiter.OnThrottled()
+			}
+
+			// validate
+			g.Expect(tuner.renewalTtl()).To(BeNumerically("~", tc.expectedRenewalTtl, time.Millisecond))
+		})
+	}
+}
@@ -3,13 +3,16 @@ package credsretriever
 import (
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/cache/expiring"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/cloud/eksauth"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
 	"golang.org/x/time/rate"
@@ -30,9 +33,17 @@ type cachedCredentialRetriever struct {
 	// credentialsRenewalTtl the maximum amount of time that we can hold
 	// credentials in the cache
 	credentialsRenewalTtl time.Duration
+	// refreshFraction is the fraction of the credentials lifetime after which
+	// they are scheduled for renewal, default is 0.8
+	refreshFraction float64
 	// minCredentialTtl minimum amount of time credentials need to have in order
 	// to store them and consider them valid, default is 15s
 	minCredentialTtl time.Duration
+	// minRefreshTtl is the shortest time credentials are held before being
+	// renewed, default is 1s. The cache reads a refresh ttl of 0 as its
+	// default and a negative one as never, so the refresh ttl of credentials
+	// whose token already expired must not drop to either.
+	minRefreshTtl time.Duration
 	// retryInterval is the least amount of time the cache will to wait to renew
 	// credentials, default is 1m
 	retryInterval time.Duration
@@ -43,21 +54,57 @@ type cachedCredentialRetriever struct {
 	// purposes
 	now internalClock
 	// refreshRateLimiter slows down refreshes to avoid getting throttled by EKS Auth
-	// in case there is some sort of backlog of creds waiting to be refreshed
-	refreshRateLimiter *rate.Limiter
+	// in case there is some sort of backlog of creds waiting to be refreshed.
+	// Cache misses are never delayed by it but use up its budget, and both
+	// back it off when they get throttled
+	refreshRateLimiter *adaptiveLimiter
+	// refreshQueue holds the credentials waiting to be renewed by the refresh
+	// workers, ordered by their expiration
+	refreshQueue *refreshQueue
+	// idleEvictionTimeout is the amount of time an entry can go without being
+	// requested before it stops being renewed, 0 disables idle eviction
+	idleEvictionTimeout time.Duration
+	// podLister lists the pods running on the node, entries fetched for pods
+	// that are no longer running are not renewed. Optional
+	podLister k8s.PodLister
+	// refreshTuner adapts the renewal ttl to the refresh rate, only set when
+	// refresh tuning is RefreshTuningAuto
+	refreshTuner *refreshTuner
+	// workersCtx is cancelled by Close to stop the refresh workers, which
+	// are tracked by workers
+	workersCtx  context.Context
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
 }
 
 type cacheEntry struct {
 	requestLogCtx      context.Context
 	originatingRequest *credentials.EksCredentialsRequest
 	credentials        *credentials.EksCredentialsResponse
+	// metadata is the delegate response metadata for the credentials
+	metadata credentials.ResponseMetadata
+	// tokenExpiration is the exp claim of the originating service account
+	// token, zero if the token does not carry one
+	tokenExpiration time.Time
+	// podUID is the uid of the pod the originating service account token
+	// was issued to, empty if the token does not carry one
+	podUID string
+	// podMissing is set once the pod is missing from the pods listed on the
+	// node, the entry is evicted if it is still missing on the next renewal
+	podMissing bool
+	// lastAccessed is the last time a client requested the credentials,
+	// only tracked when idle eviction is enabled
+	lastAccessed time.Time
 }
 
 // internalClock is used to get the current time
 type internalClock func() time.Time
 
 // type assertion
-var _ credentials.CredentialRetriever = &cachedCredentialRetriever{}
+var (
+	_ credentials.CredentialRetriever = &cachedCredentialRetriever{}
+	_ io.Closer                       = &cachedCredentialRetriever{}
+)
 
 var (
 	promCacheError = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -82,22 +129,90 @@ const (
 	defaultMinCredentialTtl = 15 * time.Second
 	defaultRetryInterval    = 1 * time.Minute
 	defaultMaxRetryJitter   = 1 * time.Minute
+	defaultRefreshFraction  = 0.8
+	defaultRefreshQPS       = 3
+	defaultMinRefreshQPS    = 0.1
 	renewalTimeout          = 1 * time.Minute
+	defaultMinRefreshTtl    = 1 * time.Second
+)
+
+// RefreshTuning selects how the refresh QPS and renewal ttl are sized with
+// respect to the cache size
+type RefreshTuning string
+
+const (
+	// RefreshTuningStatic uses the configured refresh QPS and renewal ttl as
+	// they are, they must be large enough to keep up with the cache size
+	RefreshTuningStatic RefreshTuning = "static"
+	// RefreshTuningAuto lengthens the renewal ttl as much as needed to keep up
+	// with the cache size at the current refresh QPS, which backs off when
+	// EKS Auth throttles renewals
+	RefreshTuningAuto RefreshTuning = "auto"
 )
 
 type CachedCredentialRetrieverOpts struct {
 	Delegate              credentials.CredentialRetriever
 	CredentialsRenewalTtl time.Duration
 	MaxCacheSize          int
-	RefreshQPS            int
-	CleanupInterval       time.Duration
+	// RefreshQPS is the maximum amount of calls per second to the delegate
+	RefreshQPS int
+	// MinRefreshQPS is the lowest the refresh QPS backs off to when the
+	// delegate throttles, defaults to 0.1 or RefreshQPS if smaller
+	MinRefreshQPS   float64
+	CleanupInterval time.Duration
+	// RefreshFraction is the fraction of the credentials lifetime after which
+	// they are renewed, must be within (0, 1]. Defaults to 0.8 when not set.
+	RefreshFraction float64
+	// IdleEvictionTimeout stops renewing credentials that have not been
+	// requested for this long, 0 disables it
+	IdleEvictionTimeout time.Duration
+	// PodLister if set is used to stop renewing credentials of pods that no
+	// longer run on the node
+	PodLister k8s.PodLister
+	// RefreshTuning defaults to RefreshTuningStatic
+	RefreshTuning RefreshTuning
+}
+
+// Validate checks that the options are consistent with each other
+func (o CachedCredentialRetrieverOpts) Validate() error {
+	refreshFraction := o.RefreshFraction
+	if refreshFraction == 0 {
+		refreshFraction = defaultRefreshFraction
+	}
+	if refreshFraction < 0 || refreshFraction > 1 {
+		return fmt.Errorf("credentials renewal fraction (%0.2f) must be within (0, 1]", o.RefreshFraction)
+	}
+	refreshQPS := o.RefreshQPS
+	if refreshQPS <= 0 {
+		refreshQPS = defaultRefreshQPS
+	}
+	if o.MinRefreshQPS < 0 || o.MinRefreshQPS > float64(refreshQPS) {
+		return fmt.Errorf("minimum refresh QPS (%0.2f) must be within [0, %d]", o.MinRefreshQPS, refreshQPS)
+	}
+	switch o.RefreshTuning {
+	case "", RefreshTuningStatic:
+		if float64(refreshQPS)*o.CredentialsRenewalTtl.Seconds() < float64(o.MaxCacheSize/2) {
+			return fmt.Errorf(
+				"refresh QPS is too small (%d) or credentials renewal too small (%0.2fs) to keep up with cache's size (%d), "+
+					"credentials renewal must be at least %0.2fs or refresh tuning set to %q",
+				refreshQPS, o.CredentialsRenewalTtl.Seconds(), o.MaxCacheSize,
+				requiredRenewalTtl(o.MaxCacheSize, rate.Limit(refreshQPS)).Seconds(), RefreshTuningAuto)
+		}
+	case RefreshTuningAuto:
+	default:
+		return fmt.Errorf("unknown refresh tuning %q, must be one of %q or %q",
+			o.RefreshTuning, RefreshTuningStatic, RefreshTuningAuto)
+	}
+	return nil
 }
 
 // NewCachedCredentialRetriever creates a credential retriever that caches
 // credentials up to min(credentialsRenewalTtl, fetchedCredentialExpiration)
-// It renews credentials indefinitely until the association is removed and
-// no longer needed
-func NewCachedCredentialRetriever(opts CachedCredentialRetrieverOpts) credentials.CredentialRetriever {
+// It renews credentials until the association is removed or the service
+// account token they were fetched with expires. The retriever implements
+// io.Closer to stop renewing credentials. Invalid options, as reported by
+// Validate, are returned as an error.
+func NewCachedCredentialRetriever(opts CachedCredentialRetrieverOpts) (credentials.CredentialRetriever, error) {
 	if opts.Delegate == nil {
 		panic("Delegate is not allowed to be empty")
 	}
@@ -106,17 +221,21 @@ func NewCachedCredentialRetriever(opts CachedCredentialRetrieverOpts) credential
 		opts.CleanupInterval = defaultCleanupInterval
 	}
 	if opts.RefreshQPS <= 0 {
-		opts.RefreshQPS = 3
+		opts.RefreshQPS = defaultRefreshQPS
 	}
-	if opts.RefreshQPS*int(opts.CredentialsRenewalTtl.Seconds()) < opts.MaxCacheSize/2 {
-		panic(fmt.Sprintf(
-			"Refresh QPS is too small (%d) or credentials renewal to small (%0.2fs) to keep up with cache's size (%d)",
-			opts.RefreshQPS, opts.CredentialsRenewalTtl.Seconds(), opts.MaxCacheSize))
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid credentials cache configuration: %w", err)
 	}
-	return newCachedCredentialRetriever(opts)
+	return newCachedCredentialRetriever(opts), nil
 }
 
 func newCachedCredentialRetriever(opts CachedCredentialRetrieverOpts) *cachedCredentialRetriever {
+	if opts.RefreshFraction == 0 {
+		opts.RefreshFraction = defaultRefreshFraction
+	}
+	if opts.MinRefreshQPS <= 0 {
+		opts.MinRefreshQPS = min(defaultMinRefreshQPS, float64(opts.RefreshQPS))
+	}
 	internalCache := expiring.NewLru[string, cacheEntry](opts.MaxCacheSize, opts.CredentialsRenewalTtl, opts.CleanupInterval)
 	internalActiveRequestCache := expiring.NewLru[string, error](opts.MaxCacheSize, 0, 0)
 	retriever := &cachedCredentialRetriever{
@@ -124,17 +243,46 @@ func newCachedCredentialRetriever(opts CachedCredentialRetrieverOpts) *cachedCre
 		internalCache:              internalCache,
 		internalActiveRequestCache: internalActiveRequestCache,
 		credentialsRenewalTtl:      opts.CredentialsRenewalTtl,
+		refreshFraction:            opts.RefreshFraction,
 		minCredentialTtl:           defaultMinCredentialTtl,
+		minRefreshTtl:              defaultMinRefreshTtl,
 		retryInterval:              defaultRetryInterval,
 		maxRetryJitter:             defaultMaxRetryJitter,
 		now:                        time.Now,
-		refreshRateLimiter:         rate.NewLimiter(rate.Limit(opts.RefreshQPS), opts.RefreshQPS),
+		refreshRateLimiter:         newAdaptiveLimiter(rate.Limit(opts.MinRefreshQPS), rate.Limit(opts.RefreshQPS)),
+		refreshQueue:               newRefreshQueue(),
+		idleEvictionTimeout:        opts.IdleEvictionTimeout,
+		podLister:                  opts.PodLister,
+	}
+	retriever.workersCtx, retriever.stopWorkers = context.WithCancel(context.Background())
+	if opts.RefreshTuning == RefreshTuningAuto {
+		retriever.refreshTuner = newRefreshTuner(retriever.refreshRateLimiter, opts.MaxCacheSize, opts.CredentialsRenewalTtl)
 	}
 	internalCache.OnRefresh(retriever.onCredentialRenewal)
 	internalCache.OnEvicted(retriever.onCredentialEviction)
+	// one worker per request allowed each second is enough to keep up with
+	// the rate limiter as calls to EKS Auth time out after a second
+	for i := 0; i < max(opts.RefreshQPS, 1); i++ {
+		retriever.workers.Add(1)
+		go func() {
+			defer retriever.workers.Done()
+			retriever.runRefreshWorker()
+		}()
+	}
 	return retriever
 }
 
+// Close stops renewing credentials, it waits for the renewals in progress
+// to be cancelled. Cached credentials are still served until they expire.
+func (r *cachedCredentialRetriever) Close() error {
+	// the janitor is stopped first so it no longer queues renewals
+	r.internalCache.Close()
+	r.stopWorkers()
+	r.refreshQueue.Close()
+	r.workers.Wait()
+	return nil
+}
+
 // GetIamCredentials fetches credentials from the cache if available
 func (r *cachedCredentialRetriever) GetIamCredentials(ctx context.Context,
 	request *credentials.EksCredentialsRequest) (*credentials.EksCredentialsResponse, credentials.ResponseMetadata, error) {
@@ -152,7 +300,8 @@ func (r *cachedCredentialRetriever) GetIamCredentials(ctx context.Context,
 		if val, ok := r.internalCache.Get(request.ServiceAccountToken); ok {
 			if _, withinTtl := r.credentialsInEntryWithinValidTtl(val); withinTtl {
 				log.WithField("cache-hit", 1).Tracef("Using cached credentials")
-				return val.credentials, nil, nil
+				r.markAccessed(request.ServiceAccountToken)
+				return val.credentials, newCacheResponseMetadata(val.metadata, true), nil
 			}
 
 			log.Info("Identified that entry in cache contains credentials with small ttl or invalid ttl, will be deleted")
@@ -184,35 +333,40 @@ func (r *cachedCredentialRetriever) GetIamCredentials(ctx context.Context,
 	log.WithField("cache-hit", 0).Tracef("Could not find entry in cache, requesting creds from delegate")
 	promCacheState.WithLabelValues("miss").Inc()
 
-	iamCredentials, metadata, err := r.callDelegateAndCache(ctx, request)
+	// clients are not kept waiting, but renewals yield to the miss
+	r.refreshRateLimiter.Take()
+	entry, err := r.callDelegateAndCache(ctx, request, r.accessTime())
 	if err != nil {
 		return nil, nil, err
 	}
-	return iamCredentials.credentials, metadata, nil
+	return entry.credentials, newCacheResponseMetadata(entry.metadata, false), nil
 }
 
+// callDelegateAndCache fetches credentials and stores them in the cache.
+// lastAccessed is the last time a client asked for these credentials.
 func (r *cachedCredentialRetriever) callDelegateAndCache(ctx context.Context,
-	request *credentials.EksCredentialsRequest) (cacheEntry, credentials.ResponseMetadata, error) {
+	request *credentials.EksCredentialsRequest, lastAccessed time.Time) (cacheEntry, error) {
 	log := logger.FromContext(ctx)
 
 	newCacheEntry, err := r.fetchCredentialsFromDelegate(ctx, request)
 	if err != nil {
-		return cacheEntry{}, nil, fmt.Errorf("error getting credentials to cache: %w", err)
+		return cacheEntry{}, fmt.Errorf("error getting credentials to cache: %w", err)
 	}
+	newCacheEntry.lastAccessed = lastAccessed
 
 	credsDuration, credentialsValid := r.credentialsInEntryWithinValidTtl(newCacheEntry)
 	if !credentialsValid {
-		return cacheEntry{}, nil, fmt.Errorf("fetched credentials are expired or will expire within the next %0.2f seconds", credsDuration.Seconds())
+		return cacheEntry{}, fmt.Errorf("fetched credentials are expired or will expire within the next %0.2f seconds", credsDuration.Seconds())
 	}
 
-	refreshTtl := minDuration(credsDuration, r.credentialsRenewalTtl)
+	refreshTtl := r.calculateRefreshTtl(newCacheEntry, credsDuration)
 	log.WithField("refreshTtl", refreshTtl).Infof("Storing creds in cache")
 
 	// Store credentials in cache if they are valid. It might be that
 	// the credentials might have been either removed or inserted by another
 	// thread, but it won't matter, we'll just upsert as the cache is thread safe
 	r.internalCache.SetWithRefreshExpire(request.ServiceAccountToken, newCacheEntry, refreshTtl, credsDuration)
-	return newCacheEntry, nil, nil
+	return newCacheEntry, nil
 }
 
 func (r *cachedCredentialRetriever) credentialsInEntryWithinValidTtl(newCacheEntry cacheEntry) (time.Duration, bool) {
@@ -221,65 +375,238 @@ func (r *cachedCredentialRetriever) credentialsInEntryWithinValidTtl(newCacheEnt
 	return credsDuration, credentialsLessThanMinCredTtl
 }
 
+// calculateRefreshTtl returns how long to wait before renewing the credentials
+// in the entry. Credentials are renewed once refreshFraction of their lifetime
+// has passed, but never later than the renewal ttl nor after the
+// originating token expires, as renewing with an expired token always fails.
+func (r *cachedCredentialRetriever) calculateRefreshTtl(entry cacheEntry, credsDuration time.Duration) time.Duration {
+	refreshTtl := minDuration(time.Duration(float64(credsDuration)*r.refreshFraction), r.renewalTtl())
+	if !entry.tokenExpiration.IsZero() {
+		refreshTtl = minDuration(refreshTtl, entry.tokenExpiration.Sub(r.now()))
+	}
+	return max(refreshTtl, r.minRefreshTtl)
+}
+
+// renewalTtl returns the maximum amount of time credentials are held before
+// renewing them
+func (r *cachedCredentialRetriever) renewalTtl() time.Duration {
+	if r.refreshTuner == nil {
+		return r.credentialsRenewalTtl
+	}
+	return r.refreshTuner.renewalTtl()
+}
+
+// accessTime returns the time to record as last access of an entry, zero if
+// idle eviction is disabled
+func (r *cachedCredentialRetriever) accessTime() time.Time {
+	if r.idleEvictionTimeout <= 0 {
+		return time.Time{}
+	}
+	return r.now()
+}
+
+// markAccessed records that a client has requested the credentials stored
+// under key
+func (r *cachedCredentialRetriever) markAccessed(key string) {
+	if r.idleEvictionTimeout <= 0 {
+		return
+	}
+	accessTime := r.accessTime()
+	r.internalCache.Modify(key, func(entry cacheEntry) cacheEntry {
+		entry.lastAccessed = accessTime
+		return entry
+	})
+}
+
+// isIdle indicates whether the entry has not been requested by any client
+// within idleEvictionTimeout
+func (r *cachedCredentialRetriever) isIdle(entry cacheEntry) bool {
+	return r.idleEvictionTimeout > 0 && !entry.lastAccessed.IsZero() &&
+		r.now().Sub(entry.lastAccessed) > r.idleEvictionTimeout
+}
+
+// isPodGone indicates whether the pod the entry was fetched for is no longer
+// running on the node. If pods cannot be listed, or none are listed as the
+// kubelet might not have caught up with the node yet, the pod is assumed to
+// exist.
+func (r *cachedCredentialRetriever) isPodGone(ctx context.Context, entry cacheEntry) bool {
+	if r.podLister == nil || entry.podUID == "" {
+		return false
+	}
+	pods, err := r.podLister.ListPods(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warnf("Unable to list pods, assuming pod %s still exists: %v", entry.podUID, err)
+		return false
+	}
+	if len(pods) == 0 {
+		logger.FromContext(ctx).Warnf("No pods listed on the node, assuming pod %s still exists", entry.podUID)
+		return false
+	}
+	for _, pod := range pods {
+		if pod.UID == entry.podUID {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenExpired indicates whether the token used to fetch the credentials in
+// the entry has expired. Tokens without an exp claim never expire.
+func (r *cachedCredentialRetriever) isTokenExpired(entry cacheEntry) bool {
+	return !entry.tokenExpiration.IsZero() && !r.now().Before(entry.tokenExpiration)
+}
+
 func (r *cachedCredentialRetriever) fetchCredentialsFromDelegate(ctx context.Context,
 	request *credentials.EksCredentialsRequest) (cacheEntry, error) {
 	iamCredentials, metadata, err := r.delegate.GetIamCredentials(ctx, request)
+	// other errors, eg. timeouts or access denied, say nothing about how
+	// fast EKS Auth can be called so the limit is left alone
+	if eksauth.IsThrottlingError(err) {
+		r.refreshRateLimiter.OnThrottled()
+		logger.FromContext(ctx).Warnf("Throttled by EKS Auth, backing off to %0.2f calls per second",
+			float64(r.refreshRateLimiter.Limit()))
+	} else if err == nil {
+		r.refreshRateLimiter.OnSuccess()
+	}
 	if err != nil {
 		return cacheEntry{}, err
 	}
 	requestLogCtx := logger.ContextWithField(logger.CloneToNewIfPresent(ctx, context.Background()),
 		"association-id", metadata.AssociationId())
-	return cacheEntry{
+	entry := cacheEntry{
 		originatingRequest: request,
 		requestLogCtx:      requestLogCtx,
 		credentials:        iamCredentials,
-	}, nil
+		metadata:           metadata,
+	}
+
+	// the token has already been validated at this point so any parsing
+	// problem just results in its expiration and pod being unknown
+	if claims, err := k8s.ParseServiceAccountToken(request.ServiceAccountToken); err == nil {
+		if claims.ExpiresAt != nil {
+			entry.tokenExpiration = claims.ExpiresAt.Time
+		}
+		entry.podUID = claims.Kubernetes.Pod.UID
+	}
+	return entry, nil
 }
 
-// onCredentialRenewal is called by the internalCache whenever it refreshed
-// credentials from the cache.
+// onCredentialRenewal is called by the internalCache whenever credentials
+// require a refresh, it queues them to be renewed by the refresh workers.
 func (r *cachedCredentialRetriever) onCredentialRenewal(key string, entry cacheEntry) {
+	r.refreshQueue.Push(key, entry)
+}
+
+// runRefreshWorker renews queued credentials, soonest to expire first, as
+// fast as the refreshRateLimiter allows, until the retriever is closed
+func (r *cachedCredentialRetriever) runRefreshWorker() {
+	for {
+		key, entry, ok := r.refreshQueue.Pop()
+		if !ok {
+			return
+		}
+		// entries evicted or renewed while they were queued are dropped
+		// before waiting so they do not use up the refresh budget
+		if r.isRenewalDue(key, entry) {
+			if err := r.refreshRateLimiter.Wait(r.workersCtx); err != nil {
+				r.refreshQueue.Done(key)
+				return
+			}
+			r.renewCredentials(key)
+		}
+		r.refreshQueue.Done(key)
+	}
+}
+
+// isRenewalDue checks that the queued entry still requires renewal, as it
+// might have been evicted or renewed while it was waiting in the queue
+func (r *cachedCredentialRetriever) isRenewalDue(key string, entry cacheEntry) bool {
+	current, refresh, _, ok := r.internalCache.GetWithRenewExpiry(key)
+	return ok && current.credentials == entry.credentials && !refresh.After(r.now())
+}
+
+// renewCredentials fetches new credentials for the entry stored under key,
+// evicting it if it is no longer needed or the credentials cannot be
+// renewed. The entry is read again as clients might have requested it
+// since it was queued.
+func (r *cachedCredentialRetriever) renewCredentials(key string) {
+	entry, ok := r.internalCache.Get(key)
+	if !ok {
+		return
+	}
 	ctx, cancel := context.WithTimeout(
 		logger.ContextWithField(entry.requestLogCtx, "from", "renewal-thread"), renewalTimeout)
 	defer cancel()
+	// closing the retriever cancels renewals in progress
+	defer context.AfterFunc(r.workersCtx, cancel)()
 	log := logger.FromContext(ctx)
-	if r.refreshRateLimiter.Allow() {
-		err := r.refreshRateLimiter.Wait(ctx)
-		if err != nil {
-			log.Errorf("Problem waiting, will schedule refresh to next sweep")
-			return
-		}
-		_, _, err = r.callDelegateAndCache(ctx, entry.originatingRequest)
-		if err == nil {
-			// if we retrieved the credentials successfully, exit we don't need to do anything else
-			promCacheState.WithLabelValues("hit").Inc()
-			return
-		}
 
-		errCode, isIrrecoverableError := eksauth.IsIrrecoverableApiError(err)
-		if isIrrecoverableError {
-			log.Infof("Removing credentials from cache, got non recoverable error: %s", err.Error())
-			promCacheError.WithLabelValues("NonRecoverable", errCode).Inc()
-			r.internalCache.Delete(entry.originatingRequest.ServiceAccountToken)
+	if r.isTokenExpired(entry) {
+		log.Infof("Removing credentials from cache, service account token expired at %v", entry.tokenExpiration)
+		promCacheState.WithLabelValues("token_expired").Inc()
+		r.internalCache.Delete(key)
+		return
+	}
+	if r.isPodGone(ctx, entry) {
+		if entry.podMissing {
+			log.Infof("Removing credentials from cache, pod %s is no longer running on the node", entry.podUID)
+			promCacheState.WithLabelValues("pod_deleted").Inc()
+			r.internalCache.Delete(key)
 			return
 		}
-		promCacheError.WithLabelValues("Recoverable", errCode).Inc()
-		log.Infof("Could not renew, will try to keep existing creds. Error is recoverable: %s", err.Error())
-	} else {
-		log.Infof("Rate limited! Will try to keep creds locally")
+		// the pods listed can be partial, eg. while the kubelet restarts, so
+		// the pod must be missing twice in a row before evicting the entry
+		log.Infof("Pod %s is not listed on the node, checking again before removing its credentials", entry.podUID)
+		entry.podMissing = true
+		r.keepCredentials(ctx, key, entry)
+		return
+	}
+	// the pod is listed again, the entry might be kept if renewing it fails
+	entry.podMissing = false
+	if r.isIdle(entry) {
+		log.Infof("Removing credentials from cache, not requested since %v", entry.lastAccessed)
+		promCacheState.WithLabelValues("idle").Inc()
+		r.internalCache.Delete(key)
+		return
+	}
+
+	_, err := r.callDelegateAndCache(ctx, entry.originatingRequest, entry.lastAccessed)
+	if err == nil {
+		// if we retrieved the credentials successfully, exit we don't need to do anything else
+		promCacheState.WithLabelValues("hit").Inc()
+		return
 	}
 
-	// if there was an error, try to keep the old credentials in the agent if they haven't expired
+	errCode, isIrrecoverableError := eksauth.IsIrrecoverableApiError(err)
+	if isIrrecoverableError {
+		log.Infof("Removing credentials from cache, got non recoverable error: %s", err.Error())
+		promCacheError.WithLabelValues("NonRecoverable", errCode).Inc()
+		r.internalCache.Delete(entry.originatingRequest.ServiceAccountToken)
+		return
+	}
+	promCacheError.WithLabelValues("Recoverable", errCode).Inc()
+	log.Infof("Could not renew, will try to keep existing creds. Error is recoverable: %s", err.Error())
+	r.keepCredentials(ctx, key, entry)
+}
+
+// keepCredentials keeps the credentials in the entry until they are renewed
+// again after the retry interval, evicting them if they are about to expire
+func (r *cachedCredentialRetriever) keepCredentials(ctx context.Context, key string, entry cacheEntry) {
+	log := logger.FromContext(ctx)
 	oldCreds := entry.credentials
 	oldCredsDuration := oldCreds.Expiration.Time.Sub(r.now())
 	if oldCredsDuration > r.minCredentialTtl {
 		calculatedRetryInterval := r.retryInterval + time.Duration(rand.Int63n(int64(r.maxRetryJitter)))
 		newRefreshTtl := minDuration(oldCredsDuration, calculatedRetryInterval)
+		if !entry.tokenExpiration.IsZero() {
+			newRefreshTtl = max(minDuration(newRefreshTtl, entry.tokenExpiration.Sub(r.now())), r.minRefreshTtl)
+		}
 		log.WithField("ttl", newRefreshTtl).
 			Infof("Credentials still valid for at least %0.2fs, keeping them will try again after ttl expires", oldCredsDuration.Seconds())
 		r.internalCache.SetWithRefreshExpire(key, entry, newRefreshTtl, oldCredsDuration)
 	} else {
 		log.Infof("Evicting credentials since they are too old")
+		r.internalCache.Delete(key)
 	}
 }
 
@@ -296,3 +623,33 @@ func minDuration(a time.Duration, b time.Duration) time.Duration {
 		return a
 	}
 }
+
+// cacheResponseMetadata is the metadata of credentials returned by the
+// cache, wrapping the metadata returned by the delegate when they were
+// fetched
+type cacheResponseMetadata struct {
+	delegate credentials.ResponseMetadata
+	hit      bool
+}
+
+func newCacheResponseMetadata(delegate credentials.ResponseMetadata, hit bool) credentials.CacheResponseMetadata {
+	return cacheResponseMetadata{delegate: delegate, hit: hit}
+}
+
+func (m cacheResponseMetadata) AssociationId() string {
+	if m.delegate == nil {
+		return ""
+	}
+	return m.delegate.AssociationId()
+}
+
+func (m cacheResponseMetadata) AssumedRoleArn() string {
+	if m.delegate == nil {
+		return ""
+	}
+	return m.delegate.AssumedRoleArn()
+}
+
+func (m cacheResponseMetadata) CacheHit() bool {
+	return m.hit
+}
@@ -7,9 +7,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eksauth/types"
+	"github.com/golang-jwt/jwt/v5"
 	. "github.com/onsi/gomega"
-	_ "go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials/mockcreds"
 	"go.uber.org/mock/gomock"
@@ -21,6 +25,10 @@ func (receiver responseMetadataTest) AssociationId() string {
 	return string(receiver)
 }
 
+func (receiver responseMetadataTest) AssumedRoleArn() string {
+	return "arn:aws:sts::123456789012:assumed-role/some-role/" + string(receiver)
+}
+
 func TestCachedCredentialRetriever_GetIamCredentials_Fetching(t *testing.T) {
 	sampleResponse := credentials.EksCredentialsResponse{
 		Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
@@ -254,7 +262,7 @@ func TestCachedCredentialRetriever_GetIamCredentials_Refresh(t *testing.T) {
 		Expiration: credentials.SdkCompliantExpirationTime{Time: now.Add(time.Hour)},
 	}
 	shortDurationCreds := credentials.EksCredentialsResponse{
-		Expiration: credentials.SdkCompliantExpirationTime{Time: now.Add(50 * time.Millisecond)},
+		Expiration: credentials.SdkCompliantExpirationTime{Time: now.Add(200 * time.Millisecond)},
 	}
 	const ttlToRefreshDuration = 50 * time.Millisecond
 	tests := []struct {
@@ -348,9 +356,13 @@ func TestCachedCredentialRetriever_GetIamCredentials_Refresh(t *testing.T) {
 					// first check on getting creds (make sure they are valid)
 					case 1:
 						return now
-					// second call when the entry expires for creds, mark them as expired
+					// second call when the worker checks the renewal is due,
+					// which the cache schedules with the real clock
 					case 2:
-						return now.Add(100 * time.Millisecond)
+						return time.Now()
+					// third call when the entry expires for creds, mark them as expired
+					case 3:
+						return now.Add(300 * time.Millisecond)
 					default:
 						panic("should not reach here")
 					}
@@ -383,6 +395,7 @@ func TestCachedCredentialRetriever_GetIamCredentials_Refresh(t *testing.T) {
 			retriever := newCachedCredentialRetriever(opts)
 			retriever.retryInterval = ttlToRefreshDuration
 			retriever.minCredentialTtl = ttlToRefreshDuration / 10
+			retriever.minRefreshTtl = ttlToRefreshDuration / 10
 			retriever.maxRetryJitter = 1
 			if test.timerBuilder != nil {
 				counter := 0
@@ -524,3 +537,604 @@ func TestCachedCredentialRetriever_GetIamCredentials_ActiveRequestCaching(t *tes
 		})
 	}
 }
+
+func TestCachedCredentialRetriever_GetIamCredentials_TokenAwareRefresh(t *testing.T) {
+	now := time.Now()
+	oneHourCreds := credentials.EksCredentialsResponse{
+		Expiration: credentials.SdkCompliantExpirationTime{Time: now.Add(time.Hour)},
+	}
+	tests := []struct {
+		name                   string
+		token                  string
+		refreshFraction        float64
+		expectedRenewLessThan  time.Duration
+		expectedRenewMoreThan  time.Duration
+		expectedTokenExpiresAt time.Time
+	}{
+		{
+			name:                  "renews at the configured fraction of the credentials lifetime",
+			token:                 "some.jwt.token",
+			refreshFraction:       0.5,
+			expectedRenewLessThan: 30 * time.Minute,
+			expectedRenewMoreThan: 29 * time.Minute,
+		},
+		{
+			name:                  "uses the default fraction if none is configured",
+			token:                 "some.jwt.token",
+			expectedRenewLessThan: 48 * time.Minute,
+			expectedRenewMoreThan: 47 * time.Minute,
+		},
+		{
+			name:                   "does not renew after the service account token expires",
+			token:                  test.CreateTokenForTest(now.Add(10*time.Minute), now, now),
+			refreshFraction:        1,
+			expectedRenewLessThan:  10 * time.Minute,
+			expectedRenewMoreThan:  9 * time.Minute,
+			expectedTokenExpiresAt: now.Add(10 * time.Minute).Truncate(time.Second),
+		},
+		{
+			name:                   "renews right away once the service account token expired",
+			token:                  test.CreateTokenForTest(now.Add(-time.Minute), now.Add(-time.Hour), now.Add(-time.Hour)),
+			refreshFraction:        1,
+			expectedRenewLessThan:  defaultMinRefreshTtl,
+			expectedRenewMoreThan:  0,
+			expectedTokenExpiresAt: now.Add(-time.Minute).Truncate(time.Second),
+		},
+		{
+			name:                   "token expiring after the renewal does not affect it",
+			token:                  test.CreateTokenForTest(now.Add(24*time.Hour), now, now),
+			refreshFraction:        0.5,
+			expectedRenewLessThan:  30 * time.Minute,
+			expectedRenewMoreThan:  29 * time.Minute,
+			expectedTokenExpiresAt: now.Add(24 * time.Hour).Truncate(time.Second),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			ctx := context.Background()
+
+			// setup
+			delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+			delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+				Return(&oneHourCreds, responseMetadataTest("test"), nil)
+			retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+				Delegate:              delegate,
+				CredentialsRenewalTtl: 3 * time.Hour,
+				MaxCacheSize:          5,
+				CleanupInterval:       defaultCleanupInterval,
+				RefreshQPS:            1,
+				RefreshFraction:       tc.refreshFraction,
+			})
+			request := &credentials.EksCredentialsRequest{ServiceAccountToken: tc.token}
+
+			// trigger
+			_, _, err := retriever.GetIamCredentials(ctx, request)
+
+			// validate
+			g.Expect(err).ToNot(HaveOccurred())
+			entry, renew, _, found := retriever.internalCache.GetWithRenewExpiry(tc.token)
+			g.Expect(found).To(BeTrue())
+			g.Expect(entry.tokenExpiration).To(BeTemporally("==", tc.expectedTokenExpiresAt))
+			g.Expect(time.Until(renew)).To(BeNumerically("<=", tc.expectedRenewLessThan))
+			g.Expect(time.Until(renew)).To(BeNumerically(">", tc.expectedRenewMoreThan))
+		})
+	}
+}
+
+type fakePodLister struct {
+	pods []k8s.Pod
+	err  error
+}
+
+func (f fakePodLister) ListPods(ctx context.Context) ([]k8s.Pod, error) {
+	return f.pods, f.err
+}
+
+func TestCachedCredentialRetriever_renewCredentials_Eviction(t *testing.T) {
+	const token = "some.jwt.token"
+	var (
+		renewedCreds = credentials.EksCredentialsResponse{
+			AccountId:  "renewed",
+			Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+		}
+		runningPods = fakePodLister{pods: []k8s.Pod{{Name: "some-pod", UID: "some-pod-uid"}}}
+	)
+
+	tests := []struct {
+		name                string
+		modifyEntry         func(entry *cacheEntry)
+		idleEvictionTimeout time.Duration
+		podLister           k8s.PodLister
+		expectRenewal       bool
+		// expectPodMissing means the entry is kept without renewal as its
+		// pod is missing for the first time
+		expectPodMissing bool
+	}{
+		{
+			name: "evicts entries whose service account token expired",
+			modifyEntry: func(entry *cacheEntry) {
+				entry.tokenExpiration = time.Now().Add(-time.Second)
+			},
+		},
+		{
+			name:                "evicts entries that were not requested recently",
+			idleEvictionTimeout: time.Minute,
+			modifyEntry: func(entry *cacheEntry) {
+				entry.lastAccessed = time.Now().Add(-2 * time.Minute)
+			},
+		},
+		{
+			name:                "renews entries that were requested recently",
+			idleEvictionTimeout: time.Minute,
+			modifyEntry: func(entry *cacheEntry) {
+				entry.lastAccessed = time.Now().Add(-30 * time.Second)
+			},
+			expectRenewal: true,
+		},
+		{
+			name:      "keeps entries whose pod is missing for the first time",
+			podLister: fakePodLister{pods: []k8s.Pod{{Name: "other-pod", UID: "other-pod-uid"}}},
+			modifyEntry: func(entry *cacheEntry) {
+				entry.podUID = "some-pod-uid"
+			},
+			expectPodMissing: true,
+		},
+		{
+			name:      "evicts entries whose pod is missing twice in a row",
+			podLister: fakePodLister{pods: []k8s.Pod{{Name: "other-pod", UID: "other-pod-uid"}}},
+			modifyEntry: func(entry *cacheEntry) {
+				entry.podUID = "some-pod-uid"
+				entry.podMissing = true
+			},
+		},
+		{
+			name:      "renews entries whose pod is listed again",
+			podLister: runningPods,
+			modifyEntry: func(entry *cacheEntry) {
+				entry.podUID = "some-pod-uid"
+				entry.podMissing = true
+			},
+			expectRenewal: true,
+		},
+		{
+			name:      "renews entries if no pods are listed",
+			podLister: fakePodLister{},
+			modifyEntry: func(entry *cacheEntry) {
+				entry.podUID = "some-pod-uid"
+				entry.podMissing = true
+			},
+			expectRenewal: true,
+		},
+		{
+			name:      "renews entries whose pod is still running",
+			podLister: runningPods,
+			modifyEntry: func(entry *cacheEntry) {
+				entry.podUID = "some-pod-uid"
+			},
+			expectRenewal: true,
+		},
+		{
+			name:      "renews entries if pods cannot be listed",
+			podLister: fakePodLister{err: fmt.Errorf("kubelet unavailable")},
+			modifyEntry: func(entry *cacheEntry) {
+				entry.podUID = "some-pod-uid"
+			},
+			expectRenewal: true,
+		},
+		{
+			name:          "renews entries without pod information",
+			podLister:     fakePodLister{},
+			expectRenewal: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+			if tc.expectRenewal {
+				delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+					Return(&renewedCreds, responseMetadataTest("test"), nil)
+			}
+			retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+				Delegate:              delegate,
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          5,
+				RefreshQPS:            5,
+				IdleEvictionTimeout:   tc.idleEvictionTimeout,
+				PodLister:             tc.podLister,
+			})
+			entry := cacheEntry{
+				requestLogCtx:      context.Background(),
+				originatingRequest: &credentials.EksCredentialsRequest{ServiceAccountToken: token},
+				credentials: &credentials.EksCredentialsResponse{
+					Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+				},
+			}
+			if tc.modifyEntry != nil {
+				tc.modifyEntry(&entry)
+			}
+			retriever.internalCache.SetWithRefreshExpire(token, entry, time.Minute, time.Hour)
+
+			// trigger
+			retriever.renewCredentials(token)
+
+			// validate
+			cachedEntry, found := retriever.internalCache.Get(token)
+			g.Expect(found).To(Equal(tc.expectRenewal || tc.expectPodMissing))
+			if tc.expectRenewal {
+				g.Expect(*cachedEntry.credentials).To(Equal(renewedCreds))
+				g.Expect(cachedEntry.lastAccessed).To(Equal(entry.lastAccessed))
+				g.Expect(cachedEntry.podMissing).To(BeFalse())
+			}
+			if tc.expectPodMissing {
+				g.Expect(cachedEntry.credentials).To(Equal(entry.credentials))
+				g.Expect(cachedEntry.podMissing).To(BeTrue())
+			}
+		})
+	}
+}
+
+func TestCachedCredentialRetriever_renewCredentials_DoesNotLogSecrets(t *testing.T) {
+	token := test.CreateTokenForTest(time.Now().Add(time.Hour), time.Now(), time.Now())
+	leakyResponse := fmt.Sprintf("%+v", credentials.EksCredentialsResponse{
+		SecretAccessKey: test.SecretAccessKeyForTest,
+		Token:           test.SessionTokenForTest,
+	})
+
+	tests := []struct {
+		name          string
+		delegateError error
+	}{
+		{
+			name:          "recoverable error",
+			delegateError: fmt.Errorf("invalid response from server: %s for %s", leakyResponse, token),
+		},
+		{
+			name: "non recoverable error",
+			delegateError: &types.AccessDeniedException{
+				Message: aws.String(fmt.Sprintf("token %s is not allowed, got %s", token, leakyResponse)),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			logs := test.CaptureLogsForTest(t)
+			delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+			delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).Return(nil, nil, tc.delegateError)
+			retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+				Delegate:              delegate,
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          5,
+				RefreshQPS:            5,
+			})
+			entry := cacheEntry{
+				requestLogCtx:      logger.ContextWithField(context.Background(), "token", token),
+				originatingRequest: &credentials.EksCredentialsRequest{ServiceAccountToken: token},
+				credentials: &credentials.EksCredentialsResponse{
+					SecretAccessKey: test.SecretAccessKeyForTest,
+					Token:           test.SessionTokenForTest,
+					Expiration:      credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+				},
+			}
+			retriever.internalCache.SetWithRefreshExpire(token, entry, time.Minute, time.Hour)
+
+			// trigger
+			retriever.renewCredentials(token)
+
+			// validate
+			g.Expect(logs.String()).To(ContainSubstring("[REDACTED]"))
+			g.Expect(logs.String()).ToNot(ContainSubstring(token))
+			g.Expect(logs.String()).ToNot(ContainSubstring(test.SecretAccessKeyForTest))
+			g.Expect(logs.String()).ToNot(ContainSubstring(test.SessionTokenForTest[:40]))
+		})
+	}
+}
+
+func TestCachedCredentialRetriever_runRefreshWorker_RenewsCurrentEntry(t *testing.T) {
+	g := NewWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	const token = "some.jwt.token"
+
+	// setup
+	renewed := make(chan struct{})
+	delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+	delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, request *credentials.EksCredentialsRequest) (*credentials.EksCredentialsResponse, credentials.ResponseMetadata, error) {
+			close(renewed)
+			return &credentials.EksCredentialsResponse{
+				AccountId:  "renewed",
+				Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+			}, responseMetadataTest("test"), nil
+		})
+	retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+		Delegate:              delegate,
+		CredentialsRenewalTtl: time.Hour,
+		MaxCacheSize:          5,
+		RefreshQPS:            1,
+		IdleEvictionTimeout:   time.Minute,
+	})
+	defer retriever.Close()
+	queued := cacheEntry{
+		requestLogCtx:      context.Background(),
+		originatingRequest: &credentials.EksCredentialsRequest{ServiceAccountToken: token},
+		credentials: &credentials.EksCredentialsResponse{
+			Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+		},
+		lastAccessed: time.Now().Add(-2 * time.Minute),
+	}
+	// the entry was requested again after it was queued
+	current := queued
+	current.lastAccessed = time.Now()
+	retriever.internalCache.SetWithRefreshExpire(token, current, time.Nanosecond, time.Hour)
+
+	// trigger
+	retriever.refreshQueue.Push(token, queued)
+
+	// validate, the queued entry would be idle but the current one is not
+	g.Eventually(renewed).Should(BeClosed())
+	g.Eventually(func() string {
+		entry, _ := retriever.internalCache.Get(token)
+		return entry.credentials.AccountId
+	}).Should(Equal("renewed"))
+	entry, _ := retriever.internalCache.Get(token)
+	g.Expect(entry.lastAccessed).To(Equal(current.lastAccessed))
+}
+
+func TestCachedCredentialRetriever_Close(t *testing.T) {
+	g := NewWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	const token = "some.jwt.token"
+
+	// setup, the delegate is not expected to be called
+	delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+	retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+		Delegate:              delegate,
+		CredentialsRenewalTtl: time.Hour,
+		MaxCacheSize:          5,
+		RefreshQPS:            2,
+		CleanupInterval:       time.Millisecond,
+	})
+	entry := cacheEntry{
+		requestLogCtx:      context.Background(),
+		originatingRequest: &credentials.EksCredentialsRequest{ServiceAccountToken: token},
+		credentials: &credentials.EksCredentialsResponse{
+			Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+		},
+	}
+	retriever.internalCache.SetWithRefreshExpire(token, entry, time.Nanosecond, time.Hour)
+
+	// trigger
+	closed := make(chan error)
+	go func() { closed <- retriever.Close() }()
+
+	// validate, the janitor no longer queues renewals and the workers no
+	// longer renew credentials
+	g.Eventually(closed).Should(Receive(BeNil()))
+	retriever.internalCache.SetWithRefreshExpire("other.jwt.token", entry, time.Nanosecond, time.Hour)
+	retriever.refreshQueue.Push(token, entry)
+	g.Consistently(retriever.refreshQueue.Len, 100*time.Millisecond).Should(Equal(1))
+}
+
+func TestCachedCredentialRetriever_GetIamCredentials_TracksAccess(t *testing.T) {
+	g := NewWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	// setup
+	now := time.Now()
+	delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+	delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+		Return(&credentials.EksCredentialsResponse{
+			Expiration: credentials.SdkCompliantExpirationTime{Time: now.Add(time.Hour)},
+		}, responseMetadataTest("test"), nil).Times(1)
+	retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+		Delegate:              delegate,
+		CredentialsRenewalTtl: time.Hour,
+		MaxCacheSize:          5,
+		RefreshQPS:            1,
+		IdleEvictionTimeout:   time.Minute,
+	})
+	retriever.now = func() time.Time { return now }
+	request := &credentials.EksCredentialsRequest{
+		ServiceAccountToken: test.CreateTokenWithClaimsForTest(k8s.ServiceAccountClaims{
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour))},
+			Kubernetes: k8s.KubernetesClaims{
+				Namespace: "some-namespace",
+				Pod:       k8s.ObjectClaim{Name: "some-pod", UID: "some-pod-uid"},
+			},
+		}),
+	}
+
+	// trigger, first call is a miss and second one a hit
+	_, _, err := retriever.GetIamCredentials(ctx, request)
+	g.Expect(err).ToNot(HaveOccurred())
+	entry, _ := retriever.internalCache.Get(request.ServiceAccountToken)
+	g.Expect(entry.lastAccessed).To(Equal(now))
+	g.Expect(entry.podUID).To(Equal("some-pod-uid"))
+
+	now = now.Add(30 * time.Second)
+	_, _, err = retriever.GetIamCredentials(ctx, request)
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	entry, _ = retriever.internalCache.Get(request.ServiceAccountToken)
+	g.Expect(entry.lastAccessed).To(Equal(now))
+}
+
+func TestCachedCredentialRetriever_GetIamCredentials_AdaptsRefreshQPS(t *testing.T) {
+	g := NewWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	// setup
+	delegate := mockcreds.NewMockCredentialRetriever(ctrl)
+	gomock.InOrder(
+		delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+			Return(nil, nil, fmt.Errorf("wrapped: %w", &types.ThrottlingException{})),
+		delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+			Return(nil, nil, &types.InternalServerException{}),
+		delegate.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
+			Return(&credentials.EksCredentialsResponse{
+				Expiration: credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+			}, responseMetadataTest("test"), nil),
+	)
+	retriever := newCachedCredentialRetriever(CachedCredentialRetrieverOpts{
+		Delegate:              delegate,
+		CredentialsRenewalTtl: time.Hour,
+		MaxCacheSize:          5,
+		RefreshQPS:            4,
+	})
+	request := &credentials.EksCredentialsRequest{ServiceAccountToken: "some.jwt.token"}
+
+	// trigger and validate, a throttled miss backs off the limit
+	_, _, err := retriever.GetIamCredentials(ctx, request)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(retriever.refreshRateLimiter.Limit()).To(BeNumerically("~", 2, 0.001))
+
+	// other errors leave it alone
+	_, _, err = retriever.GetIamCredentials(ctx, request)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(retriever.refreshRateLimiter.Limit()).To(BeNumerically("~", 2, 0.001))
+
+	// and a successful one probes it back up
+	_, _, err = retriever.GetIamCredentials(ctx, request)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(retriever.refreshRateLimiter.Limit()).To(BeNumerically("~", 2.1, 0.001))
+}
+
+func TestCachedCredentialRetrieverOpts_Validate(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           CachedCredentialRetrieverOpts
+		expectedErrMsg string
+	}{
+		{
+			name: "refresh QPS and renewal keep up with cache size",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          2000,
+				RefreshQPS:            1,
+			},
+		},
+		{
+			name: "default refresh QPS is used when not set",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: 10 * time.Minute,
+				MaxCacheSize:          3600,
+			},
+		},
+		{
+			name: "renewal is too small for cache size",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: 10 * time.Second,
+				MaxCacheSize:          2000,
+				RefreshQPS:            3,
+			},
+			expectedErrMsg: "credentials renewal must be at least 333.33s or refresh tuning set to \"auto\"",
+		},
+		{
+			name: "auto tuning accepts any renewal and refresh QPS",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: 10 * time.Second,
+				MaxCacheSize:          2000,
+				RefreshQPS:            3,
+				RefreshTuning:         RefreshTuningAuto,
+			},
+		},
+		{
+			name: "minimum refresh QPS above maximum",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          2000,
+				RefreshQPS:            3,
+				MinRefreshQPS:         5,
+			},
+			expectedErrMsg: "minimum refresh QPS (5.00) must be within [0, 3]",
+		},
+		{
+			name: "unknown refresh tuning",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          2000,
+				RefreshTuning:         "fast",
+			},
+			expectedErrMsg: "unknown refresh tuning \"fast\"",
+		},
+		{
+			name: "negative refresh fraction",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          2000,
+				RefreshFraction:       -0.5,
+			},
+			expectedErrMsg: "credentials renewal fraction (-0.50) must be within (0, 1]",
+		},
+		{
+			name: "refresh fraction out of range",
+			opts: CachedCredentialRetrieverOpts{
+				CredentialsRenewalTtl: time.Hour,
+				MaxCacheSize:          2000,
+				RefreshFraction:       1.5,
+			},
+			expectedErrMsg: "credentials renewal fraction (1.50) must be within (0, 1]",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			err := tc.opts.Validate()
+
+			// validate
+			if tc.expectedErrMsg != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.expectedErrMsg))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestNewCachedCredentialRetriever_InvalidOpts(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	ctrl := gomock.NewController(t)
+	opts := CachedCredentialRetrieverOpts{
+		Delegate:              mockcreds.NewMockCredentialRetriever(ctrl),
+		CredentialsRenewalTtl: time.Hour,
+		MaxCacheSize:          2000,
+		RefreshFraction:       1.5,
+	}
+
+	// trigger
+	retriever, err := NewCachedCredentialRetriever(opts)
+
+	// validate
+	g.Expect(retriever).To(BeNil())
+	g.Expect(err).To(MatchError("invalid credentials cache configuration: " +
+		"credentials renewal fraction (1.50) must be within (0, 1]"))
+}
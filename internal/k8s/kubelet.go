@@ -0,0 +1,197 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultKubeletTimeout = 5 * time.Second
+	// defaultPodListTtl is how long a pod list fetched from the kubelet is
+	// reused before asking for a new one
+	defaultPodListTtl = 30 * time.Second
+)
+
+// Pod is the subset of the kubernetes pod object used by the agent
+type Pod struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	UID       string   `json:"uid"`
+	IPs       []string `json:"ips"`
+}
+
+// A PodLister lists the pods running on the node
+type PodLister interface {
+	ListPods(ctx context.Context) ([]Pod, error)
+}
+
+// KubeletPodListerOpts configures how the kubelet pods endpoint is called
+type KubeletPodListerOpts struct {
+	// PodsUrl is the kubelet endpoint serving the pods running on the
+	// node, eg. http://localhost:10255/pods
+	PodsUrl string
+	// TokenFile contains a bearer token sent along the request, if empty no
+	// token is sent
+	TokenFile string
+	// CAFile holds the certificates used to verify the kubelet serving
+	// certificate, the system ones are used if empty. Kubelets usually serve
+	// the authenticated port with a self-signed certificate.
+	CAFile string
+	// InsecureSkipVerify disables the verification of the kubelet serving
+	// certificate
+	InsecureSkipVerify bool
+}
+
+type kubeletPodLister struct {
+	podsUrl   string
+	tokenFile string
+	client    http.Client
+	// podListTtl is how long the last fetched list is served from memory
+	podListTtl time.Duration
+	now        func() time.Time
+	// fetches coalesces the concurrent requests to the kubelet
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	pods      []Pod
+	fetchedAt time.Time
+}
+
+// NewKubeletPodLister creates a PodLister that reads pods from the kubelet
+// pods endpoint. Results are cached for a short period of time so callers
+// can invoke it for every entry they need to check.
+func NewKubeletPodLister(opts KubeletPodListerOpts) (PodLister, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		caCerts, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read kubelet CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no certificate found in kubelet CA file %s", opts.CAFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &kubeletPodLister{
+		podsUrl:    opts.PodsUrl,
+		tokenFile:  opts.TokenFile,
+		client:     http.Client{Timeout: defaultKubeletTimeout, Transport: transport},
+		podListTtl: defaultPodListTtl,
+		now:        time.Now,
+	}, nil
+}
+
+// kubeletPodList is the subset of the v1.PodList returned by the kubelet
+type kubeletPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"metadata"`
+		Status struct {
+			PodIPs []struct {
+				IP string `json:"ip"`
+			} `json:"podIPs"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func (k *kubeletPodLister) ListPods(ctx context.Context) ([]Pod, error) {
+	if pods, ok := k.cachedPods(); ok {
+		return pods, nil
+	}
+	return k.RefreshPods(ctx)
+}
+
+// RefreshPods fetches the pods from the kubelet even if the cached list has
+// not expired yet. The lock is only held to swap the list, not while it is
+// fetched, concurrent callers wait on the same request to the kubelet.
+func (k *kubeletPodLister) RefreshPods(ctx context.Context) ([]Pod, error) {
+	// the request is not tied to the caller, a cancelled caller must not
+	// abort it for the other callers waiting on it
+	fetched := k.fetches.DoChan("", func() (interface{}, error) {
+		pods, err := k.fetchPods(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		k.pods = pods
+		k.fetchedAt = k.now()
+		return pods, nil
+	})
+	select {
+	case res := <-fetched:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]Pod), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cachedPods returns the last fetched list if it has not expired yet
+func (k *kubeletPodLister) cachedPods() ([]Pod, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.fetchedAt.IsZero() || k.now().Sub(k.fetchedAt) >= k.podListTtl {
+		return nil, false
+	}
+	return k.pods, true
+}
+
+func (k *kubeletPodLister) fetchPods(ctx context.Context) ([]Pod, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.podsUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kubelet request: %w", err)
+	}
+	if k.tokenFile != "" {
+		token, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read kubelet token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pods from kubelet: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code listing pods from kubelet, expected %d, got %d",
+			http.StatusOK, res.StatusCode)
+	}
+
+	var podList kubeletPodList
+	if err = json.NewDecoder(res.Body).Decode(&podList); err != nil {
+		return nil, fmt.Errorf("unable to decode kubelet pod list: %w", err)
+	}
+
+	pods := make([]Pod, len(podList.Items))
+	for i, item := range podList.Items {
+		pods[i] = Pod{
+			Name:      item.Metadata.Name,
+			Namespace: item.Metadata.Namespace,
+			UID:       item.Metadata.UID,
+		}
+		for _, podIP := range item.Status.PodIPs {
+			pods[i].IPs = append(pods[i].IPs, podIP.IP)
+		}
+	}
+	return pods, nil
+}
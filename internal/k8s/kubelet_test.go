@@ -0,0 +1,250 @@
+package k8s
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+const samplePodList = `{
+  "kind": "PodList",
+  "apiVersion": "v1",
+  "items": [
+    {
+      "metadata": {"name": "pod-a", "namespace": "ns-a", "uid": "uid-a"},
+      "status": {"podIP": "10.0.0.1", "podIPs": [{"ip": "10.0.0.1"}, {"ip": "fd00::1"}]}
+    },
+    {
+      "metadata": {"name": "pod-b", "namespace": "ns-b", "uid": "uid-b"},
+      "status": {}
+    }
+  ]
+}`
+
+func TestKubeletPodLister_ListPods(t *testing.T) {
+	expectedPods := []Pod{
+		{Name: "pod-a", Namespace: "ns-a", UID: "uid-a", IPs: []string{"10.0.0.1", "fd00::1"}},
+		{Name: "pod-b", Namespace: "ns-b", UID: "uid-b"},
+	}
+
+	testCases := []struct {
+		name             string
+		statusCode       int
+		body             string
+		token            string
+		expectedPods     []Pod
+		expectedErrorMsg string
+	}{
+		{
+			name:         "lists pods from kubelet",
+			statusCode:   http.StatusOK,
+			body:         samplePodList,
+			expectedPods: expectedPods,
+		},
+		{
+			name:         "sends the bearer token if configured",
+			statusCode:   http.StatusOK,
+			body:         samplePodList,
+			token:        "some-token",
+			expectedPods: expectedPods,
+		},
+		{
+			name:             "fails on unexpected status code",
+			statusCode:       http.StatusUnauthorized,
+			expectedErrorMsg: "expected 200, got 401",
+		},
+		{
+			name:             "fails on invalid body",
+			statusCode:       http.StatusOK,
+			body:             "not-json",
+			expectedErrorMsg: "unable to decode kubelet pod list",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.token != "" {
+					g.Expect(r.Header.Get("Authorization")).To(Equal("Bearer " + tc.token))
+				}
+				w.WriteHeader(tc.statusCode)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer kubelet.Close()
+
+			tokenFile := ""
+			if tc.token != "" {
+				tokenFile = filepath.Join(t.TempDir(), "token")
+				g.Expect(os.WriteFile(tokenFile, []byte(tc.token+"\n"), 0600)).To(Succeed())
+			}
+			lister, err := NewKubeletPodLister(KubeletPodListerOpts{PodsUrl: kubelet.URL + "/pods", TokenFile: tokenFile})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// trigger
+			pods, err := lister.ListPods(context.Background())
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.expectedErrorMsg))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(pods).To(Equal(tc.expectedPods))
+		})
+	}
+}
+
+func TestKubeletPodLister_ListPods_Caching(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	calls := 0
+	kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(samplePodList))
+	}))
+	defer kubelet.Close()
+
+	now := time.Now()
+	podLister, err := NewKubeletPodLister(KubeletPodListerOpts{PodsUrl: kubelet.URL})
+	g.Expect(err).ToNot(HaveOccurred())
+	lister := podLister.(*kubeletPodLister)
+	lister.now = func() time.Time { return now }
+
+	// trigger & validate
+	_, err = lister.ListPods(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = lister.ListPods(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(calls).To(Equal(1))
+
+	now = now.Add(defaultPodListTtl)
+	_, err = lister.ListPods(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(calls).To(Equal(2))
+}
+
+func TestKubeletPodLister_ListPods_Concurrent(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup, the kubelet answers once all the callers are waiting
+	var calls atomic.Int32
+	release := make(chan struct{})
+	kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		_, _ = w.Write([]byte(samplePodList))
+	}))
+	defer kubelet.Close()
+	lister, err := NewKubeletPodLister(KubeletPodListerOpts{PodsUrl: kubelet.URL})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := lister.ListPods(context.Background())
+			errs <- err
+		}()
+	}
+	g.Eventually(calls.Load).Should(Equal(int32(1)))
+
+	// a cancelled caller stops waiting without aborting the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = lister.(*kubeletPodLister).RefreshPods(ctx)
+	g.Expect(err).To(MatchError(context.Canceled))
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	// validate
+	for err := range errs {
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(calls.Load()).To(Equal(int32(1)))
+}
+
+func TestKubeletPodLister_ListPods_Tls(t *testing.T) {
+	kubelet := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(samplePodList))
+	}))
+	defer kubelet.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kubelet.Certificate().Raw})
+	if err := os.WriteFile(caFile, caCert, 0600); err != nil {
+		t.Fatalf("unable to write CA file: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		opts             KubeletPodListerOpts
+		expectedErrorMsg string
+	}{
+		{
+			name: "verifies the kubelet certificate with the CA file",
+			opts: KubeletPodListerOpts{CAFile: caFile},
+		},
+		{
+			name: "skips verifying the kubelet certificate",
+			opts: KubeletPodListerOpts{InsecureSkipVerify: true},
+		},
+		{
+			name:             "rejects a self-signed kubelet certificate by default",
+			expectedErrorMsg: "certificate signed by unknown authority",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			tc.opts.PodsUrl = kubelet.URL
+			lister, err := NewKubeletPodLister(tc.opts)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// trigger
+			pods, err := lister.ListPods(context.Background())
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.expectedErrorMsg))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(pods).To(HaveLen(2))
+		})
+	}
+}
+
+func TestNewKubeletPodLister_InvalidCAFile(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	g.Expect(os.WriteFile(caFile, []byte("not-a-certificate"), 0600)).To(Succeed())
+
+	// trigger
+	_, err := NewKubeletPodLister(KubeletPodListerOpts{PodsUrl: "https://localhost:10250/pods", CAFile: caFile})
+
+	// validate
+	g.Expect(err).To(MatchError("no certificate found in kubelet CA file " + caFile))
+}
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// minPodListRefreshInterval limits how often the pod list is fetched again
+// when looking up a pod that is not in it, eg. because it just started
+const minPodListRefreshInterval = 1 * time.Second
+
+// A PodIPLookup resolves the IPs of a pod running on the node
+type PodIPLookup interface {
+	// LookupPod returns the pod along with its IPs and UID, ErrPodNotFound
+	// if the pod does not run on the node
+	LookupPod(ctx context.Context, namespace, name string) (Pod, error)
+}
+
+// ErrPodNotFound is returned when the pod does not run on the node
+var ErrPodNotFound = fmt.Errorf("pod not found on the node")
+
+// refreshingPodLister is implemented by pod listers that cache the list and
+// can be asked to fetch it again
+type refreshingPodLister interface {
+	PodLister
+	RefreshPods(ctx context.Context) ([]Pod, error)
+}
+
+type podListerIPLookup struct {
+	lister PodLister
+
+	mu          sync.Mutex
+	refreshedAt time.Time
+	now         func() time.Time
+}
+
+// NewPodIPLookup creates a PodIPLookup that finds pods in the list returned
+// by lister. If the lister caches the list, like the kubelet one does, the
+// list is fetched again when the pod is not in it.
+func NewPodIPLookup(lister PodLister) PodIPLookup {
+	return &podListerIPLookup{lister: lister, now: time.Now}
+}
+
+func (l *podListerIPLookup) LookupPod(ctx context.Context, namespace, name string) (Pod, error) {
+	pods, err := l.lister.ListPods(ctx)
+	if err != nil {
+		return Pod{}, err
+	}
+	if pod, ok := findPod(pods, namespace, name); ok {
+		return pod, nil
+	}
+
+	refresher, ok := l.lister.(refreshingPodLister)
+	if !ok || !l.allowRefresh() {
+		return Pod{}, ErrPodNotFound
+	}
+	pods, err = refresher.RefreshPods(ctx)
+	if err != nil {
+		return Pod{}, err
+	}
+	if pod, ok := findPod(pods, namespace, name); ok {
+		return pod, nil
+	}
+	return Pod{}, ErrPodNotFound
+}
+
+func (l *podListerIPLookup) allowRefresh() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.now().Sub(l.refreshedAt) < minPodListRefreshInterval {
+		return false
+	}
+	l.refreshedAt = l.now()
+	return true
+}
+
+func findPod(pods []Pod, namespace, name string) (Pod, bool) {
+	for _, pod := range pods {
+		if pod.Namespace == namespace && pod.Name == name && len(pod.IPs) != 0 {
+			return pod, true
+		}
+	}
+	return Pod{}, false
+}
+
+type staticPodLister struct {
+	pods []Pod
+}
+
+// NewStaticPodLister creates a PodLister that serves the pods in a JSON file
+// holding a list of Pod, mostly useful for testing
+func NewStaticPodLister(file string) (PodLister, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pods []Pod
+	if err := json.Unmarshal(content, &pods); err != nil {
+		return nil, fmt.Errorf("unable to decode pods in %s: %w", file, err)
+	}
+	return staticPodLister{pods: pods}, nil
+}
+
+func (s staticPodLister) ListPods(ctx context.Context) ([]Pod, error) {
+	return s.pods, nil
+}
@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPodIPLookup_LookupPod(t *testing.T) {
+	podsFile := filepath.Join(t.TempDir(), "pods.json")
+	err := os.WriteFile(podsFile, []byte(`[
+  {"name": "pod-a", "namespace": "ns-a", "uid": "uid-a", "ips": ["10.0.0.1", "fd00::1"]},
+  {"name": "pod-b", "namespace": "ns-b"}
+]`), 0600)
+	if err != nil {
+		t.Fatalf("unable to write pods file: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		namespace        string
+		podName          string
+		expectedPod      Pod
+		expectedErrorMsg string
+	}{
+		{
+			name:      "finds the pod",
+			namespace: "ns-a",
+			podName:   "pod-a",
+			expectedPod: Pod{
+				Name:      "pod-a",
+				Namespace: "ns-a",
+				UID:       "uid-a",
+				IPs:       []string{"10.0.0.1", "fd00::1"},
+			},
+		},
+		{
+			name:             "pod in another namespace",
+			namespace:        "ns-b",
+			podName:          "pod-a",
+			expectedErrorMsg: ErrPodNotFound.Error(),
+		},
+		{
+			name:             "pod without IPs",
+			namespace:        "ns-b",
+			podName:          "pod-b",
+			expectedErrorMsg: ErrPodNotFound.Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			lister, err := NewStaticPodLister(podsFile)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// trigger
+			pod, err := NewPodIPLookup(lister).LookupPod(context.Background(), tc.namespace, tc.podName)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(pod).To(Equal(tc.expectedPod))
+			}
+		})
+	}
+}
+
+func TestPodIPLookup_RefreshesKubeletPods(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup, the second list includes a pod that just started
+	var calls atomic.Int32
+	kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pods := `{"items": []}`
+		if calls.Add(1) > 1 {
+			pods = `{"items": [{"metadata": {"name": "new-pod", "namespace": "ns"}, "status": {"podIPs": [{"ip": "10.0.0.2"}]}}]}`
+		}
+		_, _ = fmt.Fprint(w, pods)
+	}))
+	defer kubelet.Close()
+	lister, err := NewKubeletPodLister(KubeletPodListerOpts{PodsUrl: kubelet.URL})
+	g.Expect(err).ToNot(HaveOccurred())
+	lookup := NewPodIPLookup(lister)
+
+	// trigger
+	pod, err := lookup.LookupPod(context.Background(), "ns", "new-pod")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pod.IPs).To(Equal([]string{"10.0.0.2"}))
+	_, err = lookup.LookupPod(context.Background(), "ns", "unknown-pod")
+
+	// validate, the list was fetched again for the new pod but not right
+	// after for the unknown one
+	g.Expect(err).To(MatchError(ErrPodNotFound))
+	g.Expect(calls.Load()).To(Equal(int32(2)))
+}
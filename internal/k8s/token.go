@@ -0,0 +1,40 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var tokenParser = jwt.NewParser()
+
+// ServiceAccountClaims are the claims kubernetes adds to projected service
+// account tokens on top of the registered ones
+type ServiceAccountClaims struct {
+	jwt.RegisteredClaims
+	Kubernetes KubernetesClaims `json:"kubernetes.io"`
+}
+
+// KubernetesClaims identify the pod and service account the token was
+// issued to
+type KubernetesClaims struct {
+	Namespace      string      `json:"namespace"`
+	Pod            ObjectClaim `json:"pod"`
+	ServiceAccount ObjectClaim `json:"serviceaccount"`
+}
+
+// ObjectClaim references a kubernetes object by name and uid
+type ObjectClaim struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// ParseServiceAccountToken parses the token claims without verifying its
+// signature
+func ParseServiceAccountToken(token string) (*ServiceAccountClaims, error) {
+	claims := &ServiceAccountClaims{}
+	if _, _, err := tokenParser.ParseUnverified(token, claims); err != nil {
+		return nil, fmt.Errorf("unable to parse service account token: %w", err)
+	}
+	return claims, nil
+}
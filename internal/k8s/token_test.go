@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/gomega"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+)
+
+func TestParseServiceAccountToken(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	kubernetesClaims := KubernetesClaims{
+		Namespace:      "some-namespace",
+		Pod:            ObjectClaim{Name: "some-pod", UID: "some-pod-uid"},
+		ServiceAccount: ObjectClaim{Name: "some-sa", UID: "some-sa-uid"},
+	}
+
+	testCases := []struct {
+		name             string
+		token            string
+		expectedClaims   KubernetesClaims
+		expectedExpiry   time.Time
+		expectedErrorMsg string
+	}{
+		{
+			name: "parses kubernetes claims",
+			token: test.CreateTokenWithClaimsForTest(ServiceAccountClaims{
+				RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expiry)},
+				Kubernetes:       kubernetesClaims,
+			}),
+			expectedClaims: kubernetesClaims,
+			expectedExpiry: expiry,
+		},
+		{
+			name:           "token without kubernetes claims",
+			token:          test.CreateTokenForTest(expiry, time.Now(), time.Now()),
+			expectedExpiry: expiry,
+		},
+		{
+			name:             "token cannot be parsed",
+			token:            "some.jwt.token",
+			expectedErrorMsg: "unable to parse service account token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			claims, err := ParseServiceAccountToken(tc.token)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.expectedErrorMsg))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(claims.Kubernetes).To(Equal(tc.expectedClaims))
+			g.Expect(claims.ExpiresAt.Time).To(BeTemporally("==", tc.expectedExpiry))
+		})
+	}
+}
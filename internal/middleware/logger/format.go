@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Format is the encoding of the logs
+type Format string
+
+const (
+	// FormatJson writes every entry as a JSON object
+	FormatJson Format = "json"
+	// FormatLogfmt writes every entry as key=value pairs
+	FormatLogfmt Format = "logfmt"
+	// FormatText writes entries for humans, colored on terminals
+	FormatText Format = "text"
+)
+
+// newFormatter creates the formatter for format. fieldMap renames fields in
+// the output, both the ones logrus adds (time, level, msg, func, file) and
+// the ones added by the agent, eg. client-addr=client_ip
+func newFormatter(format Format, fieldMap map[string]string) (logrus.Formatter, error) {
+	builtins := logrus.FieldMap{}
+	custom := map[string]string{}
+	for from, to := range fieldMap {
+		switch from {
+		case logrus.FieldKeyTime:
+			builtins[logrus.FieldKeyTime] = to
+		case logrus.FieldKeyLevel:
+			builtins[logrus.FieldKeyLevel] = to
+		case logrus.FieldKeyMsg:
+			builtins[logrus.FieldKeyMsg] = to
+		case logrus.FieldKeyFunc:
+			builtins[logrus.FieldKeyFunc] = to
+		case logrus.FieldKeyFile:
+			builtins[logrus.FieldKeyFile] = to
+		default:
+			custom[from] = to
+		}
+	}
+
+	var formatter logrus.Formatter
+	switch format {
+	case FormatJson, "":
+		formatter = &logrus.JSONFormatter{FieldMap: builtins}
+	case FormatLogfmt:
+		formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, FieldMap: builtins}
+	case FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true, FieldMap: builtins}
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected one of %s, %s or %s", format, FormatJson, FormatLogfmt, FormatText)
+	}
+	if len(custom) == 0 {
+		return formatter, nil
+	}
+	return fieldRenamingFormatter{formatter: formatter, fieldMap: custom}, nil
+}
+
+// fieldRenamingFormatter renames the fields of entries before formatting them
+type fieldRenamingFormatter struct {
+	formatter logrus.Formatter
+	fieldMap  map[string]string
+}
+
+func (f fieldRenamingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		if renamed, ok := f.fieldMap[key]; ok {
+			key = renamed
+		}
+		data[key] = value
+	}
+	// entries are copied before being formatted, so the fields can be
+	// replaced without affecting the logger they came from
+	entry.Data = data
+	return f.formatter.Format(entry)
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewFormatter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		format        Format
+		fieldMap      map[string]string
+		expectedParts []string
+		expectedError string
+	}{
+		{
+			name:          "json",
+			format:        FormatJson,
+			expectedParts: []string{`"level":"info"`, `"msg":"some message"`, `"client-addr":"10.0.0.1"`},
+		},
+		{
+			name:          "json by default",
+			expectedParts: []string{`"level":"info"`, `"msg":"some message"`},
+		},
+		{
+			name:          "logfmt",
+			format:        FormatLogfmt,
+			expectedParts: []string{`level=info`, `msg="some message"`, `client-addr=10.0.0.1`},
+		},
+		{
+			name:          "text",
+			format:        FormatText,
+			expectedParts: []string{`level=info`, `msg="some message"`},
+		},
+		{
+			name:     "renamed fields",
+			format:   FormatJson,
+			fieldMap: map[string]string{"msg": "message", "level": "severity", "client-addr": "client_ip"},
+			expectedParts: []string{
+				`"severity":"info"`, `"message":"some message"`, `"client_ip":"10.0.0.1"`,
+			},
+		},
+		{
+			name:          "unknown format",
+			format:        "xml",
+			expectedError: `unknown log format "xml", expected one of json, logfmt or text`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			formatter, err := newFormatter(tc.format, tc.fieldMap)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			buffer := &bytes.Buffer{}
+			log := logrus.New()
+			log.SetOutput(buffer)
+			log.SetFormatter(formatter)
+			entry := log.WithField("client-addr", "10.0.0.1")
+
+			// trigger
+			entry.Info("some message")
+
+			// validate
+			for _, part := range tc.expectedParts {
+				g.Expect(buffer.String()).To(ContainSubstring(part))
+			}
+			// the fields of the entry the log came from are left untouched
+			g.Expect(entry.Data).To(HaveKey("client-addr"))
+		})
+	}
+}
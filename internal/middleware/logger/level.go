@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// levelOverride tracks a temporary change of the logging level, which is
+// reverted to the configured level once it expires
+var levelOverride struct {
+	mu            sync.Mutex
+	configured    logrus.Level
+	revertAt      time.Time
+	revertTimer   *time.Timer
+	overrideCount uint64
+}
+
+// LevelStatus describes the current logging level
+type LevelStatus struct {
+	Level string `json:"level"`
+	// ConfiguredLevel is the level set on start, restored at RevertAt
+	ConfiguredLevel string `json:"configuredLevel"`
+	// RevertAt is when a temporary level expires, nil if there is none
+	RevertAt *time.Time `json:"revertAt,omitempty"`
+}
+
+// CurrentLevel returns the logging level and whether it was temporarily
+// changed
+func CurrentLevel() LevelStatus {
+	levelOverride.mu.Lock()
+	defer levelOverride.mu.Unlock()
+	status := LevelStatus{
+		Level:           logger.GetLevel().String(),
+		ConfiguredLevel: levelOverride.configured.String(),
+	}
+	if levelOverride.revertTimer != nil {
+		revertAt := levelOverride.revertAt
+		status.RevertAt = &revertAt
+	}
+	return status
+}
+
+// OverrideLevel changes the logging level for duration, after which the
+// configured level is restored. Overriding again replaces the previous
+// override.
+func OverrideLevel(level logrus.Level, duration time.Duration) LevelStatus {
+	levelOverride.mu.Lock()
+	if levelOverride.revertTimer != nil {
+		levelOverride.revertTimer.Stop()
+	}
+	levelOverride.overrideCount++
+	overrideId := levelOverride.overrideCount
+	logger.SetLevel(level)
+	revertAt := time.Now().Add(duration)
+	levelOverride.revertAt = revertAt
+	levelOverride.revertTimer = time.AfterFunc(duration, func() {
+		revertLevel(overrideId)
+	})
+	levelOverride.mu.Unlock()
+
+	logger.WithField("revert-at", revertAt).Warnf("Logging level temporarily set to %s", level)
+	return CurrentLevel()
+}
+
+// ResetLevel restores the configured logging level
+func ResetLevel() LevelStatus {
+	levelOverride.mu.Lock()
+	overrideId := levelOverride.overrideCount
+	levelOverride.mu.Unlock()
+	revertLevel(overrideId)
+	return CurrentLevel()
+}
+
+// revertLevel restores the configured level unless the override was
+// replaced by a newer one
+func revertLevel(overrideId uint64) {
+	levelOverride.mu.Lock()
+	defer levelOverride.mu.Unlock()
+	if overrideId != levelOverride.overrideCount || levelOverride.revertTimer == nil {
+		return
+	}
+	levelOverride.revertTimer.Stop()
+	levelOverride.revertTimer = nil
+	logger.SetLevel(levelOverride.configured)
+	logger.Warnf("Logging level restored to %s", levelOverride.configured)
+}
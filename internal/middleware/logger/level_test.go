@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOverrideLevel(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	Initialize("info")
+
+	// trigger
+	status := OverrideLevel(logrus.DebugLevel, time.Hour)
+
+	// validate
+	g.Expect(status.Level).To(Equal("debug"))
+	g.Expect(status.ConfiguredLevel).To(Equal("info"))
+	g.Expect(status.RevertAt).ToNot(BeNil())
+	g.Expect(logger.IsLevelEnabled(logrus.DebugLevel)).To(BeTrue())
+
+	// a new override replaces the previous one, which no longer reverts
+	OverrideLevel(logrus.TraceLevel, 50*time.Millisecond)
+	g.Expect(CurrentLevel().Level).To(Equal("trace"))
+	g.Eventually(func() string { return CurrentLevel().Level }).Should(Equal("info"))
+	g.Expect(CurrentLevel().RevertAt).To(BeNil())
+}
+
+func TestResetLevel(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	Initialize("warn")
+	OverrideLevel(logrus.TraceLevel, time.Hour)
+
+	// trigger
+	status := ResetLevel()
+
+	// validate
+	g.Expect(status).To(Equal(LevelStatus{Level: "warning", ConfiguredLevel: "warning"}))
+	g.Expect(logger.IsLevelEnabled(logrus.InfoLevel)).To(BeFalse())
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -16,6 +17,12 @@ const contextKey loggerKey = "logger"
 var logger *logrus.Logger
 
 func Initialize(loggingVerbosity string) {
+	InitializeWithFormat(loggingVerbosity, FormatJson, nil)
+}
+
+// InitializeWithFormat sets up the logger writing entries in the given
+// format, with fields renamed as in fieldMap, see newFormatter
+func InitializeWithFormat(loggingVerbosity string, format Format, fieldMap map[string]string) {
 	level, err := logrus.ParseLevel(loggingVerbosity)
 	// Signal that we are about to enter the desired verbosity
 	log.Printf("Setting logging verbosity level to: %s (%d)\n", loggingVerbosity, level)
@@ -24,15 +31,33 @@ func Initialize(loggingVerbosity string) {
 		log.Fatalf("Invalid logging verbosity: %v", err)
 	}
 
+	formatter, err := newFormatter(format, fieldMap)
+	if err != nil {
+		log.Fatalf("Invalid logging format: %v", err)
+	}
+
 	logger = logrus.New()
 	// Set logrus formatter
-	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetFormatter(formatter)
 
 	// Set log level to output all levels
 	logger.SetLevel(level)
+	levelOverride.mu.Lock()
+	levelOverride.configured = level
+	levelOverride.mu.Unlock()
 
 	// Set log output to stdout
 	logger.SetOutput(os.Stdout)
+
+	// Scrub credentials from every entry
+	logger.AddHook(RedactionHook{})
+}
+
+// SetOutput changes where logs are written, returning the previous output
+func SetOutput(out io.Writer) io.Writer {
+	previous := logger.Out
+	logger.SetOutput(out)
+	return previous
 }
 
 // InjectLogger injects logger in the requests' context
@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces secrets removed from log entries
+const Redacted = "[REDACTED]"
+
+const (
+	// secretAccessKeyLength is the length of AWS secret access keys
+	secretAccessKeyLength = 40
+	// minSessionTokenLength is shorter than any AWS session token but much
+	// longer than ids, arns or hashes that are useful in logs
+	minSessionTokenLength = 100
+)
+
+var (
+	// jwtPattern matches JWTs, their base64url encoded header always starts
+	// with eyJ, as in {"
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// labeledSecretPattern matches secrets next to the field name holding
+	// them, as printed by %v, %+v or JSON, eg. SecretAccessKey:"...". The
+	// scheme of authorization headers, eg. Bearer, is kept and the
+	// credentials following it are matched, also when the header values are
+	// printed as a list by %v.
+	labeledSecretPattern = regexp.MustCompile(
+		`((?i:secret_?access_?key|session_?token|x-amz-security-token|authorization)|\bToken)` +
+			`("?\s*[:=]\s*\[??"?)((?i:bearer|basic)\s+)?(` + regexp.QuoteMeta(Redacted) + `|[^\s",&}\[\]]+)`)
+	// base64RunPattern matches candidate secret access keys and session
+	// tokens, which are checked by looksLikeSecret
+	base64RunPattern = regexp.MustCompile(`[A-Za-z0-9/+=]+`)
+	// sensitiveFields are log fields whose values are never logged
+	sensitiveFields = map[string]bool{
+		"authorization":     true,
+		"token":             true,
+		"secretaccesskey":   true,
+		"secret-access-key": true,
+		"sessiontoken":      true,
+		"session-token":     true,
+	}
+)
+
+// RedactionHook scrubs service account tokens, AWS secret access keys and
+// session tokens from the message and fields of every log entry, so
+// credentials do not leak in logs even if they end up in an error
+type RedactionHook struct{}
+
+func (RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (RedactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	// entries are copied before firing hooks, so the fields can be replaced
+	// without affecting the logger they came from
+	for key, value := range entry.Data {
+		if sensitiveFields[strings.ToLower(key)] {
+			entry.Data[key] = Redacted
+			continue
+		}
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case error:
+			text = v.Error()
+		case fmt.Stringer:
+			text = v.String()
+		default:
+			continue
+		}
+		if redacted := Redact(text); redacted != text {
+			entry.Data[key] = redacted
+		}
+	}
+	return nil
+}
+
+// Redact removes JWTs, AWS secret access keys and session tokens from s
+func Redact(s string) string {
+	s = jwtPattern.ReplaceAllString(s, Redacted)
+	s = labeledSecretPattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := labeledSecretPattern.FindStringSubmatch(match)
+		if groups[4] == Redacted {
+			return match
+		}
+		return groups[1] + groups[2] + groups[3] + Redacted
+	})
+	return base64RunPattern.ReplaceAllStringFunc(s, func(run string) string {
+		if looksLikeSecret(run) {
+			return Redacted
+		}
+		return run
+	})
+}
+
+// looksLikeSecret checks if a run of base64 characters could be a secret
+// access key or a session token, which mix upper and lower case letters and
+// digits unlike words, ids or hex encoded hashes
+func looksLikeSecret(run string) bool {
+	if len(run) != secretAccessKeyLength && len(run) < minSessionTokenLength {
+		return false
+	}
+	var upper, lower, digit bool
+	for _, r := range run {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
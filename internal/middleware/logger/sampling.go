@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// SuppressedLinesField is added to sampled entries with the amount of
+// identical entries that were dropped since the previous one was written
+const SuppressedLinesField = "suppressed-lines"
+
+// maxSampledKeys bounds the memory used to track sampled entries, entries
+// with new keys are written without sampling while the limit is reached
+const maxSampledKeys = 10000
+
+var promSuppressedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pod_identity_log_lines_suppressed",
+	Help: "Log lines dropped by sampling",
+}, []string{"level"})
+
+// SamplingOpts configures the sampling of repetitive log entries. Entries
+// are identified by their level, message and the values of KeyFields. In
+// every Interval the First entries with the same key are written and then
+// only one out of every Thereafter, the rest are dropped. Warnings and
+// errors are never dropped.
+type SamplingOpts struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+	// KeyFields are the fields that tell entries with the same message
+	// apart, eg. association-id to sample each association separately
+	KeyFields []string
+}
+
+// EnableSampling starts sampling the entries of the logger, see
+// SamplingOpts. It is a no-op if opts.Interval is 0.
+func EnableSampling(opts SamplingOpts) {
+	if opts.Interval <= 0 {
+		return
+	}
+	logger.SetFormatter(newSamplingFormatter(logger.Formatter, opts, time.Now))
+}
+
+type sampledKey struct {
+	key         string
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+// samplingFormatter drops entries by formatting them to nothing, which is
+// the only way logrus offers to skip writing an entry once it is logged
+type samplingFormatter struct {
+	formatter logrus.Formatter
+	opts      SamplingOpts
+	now       func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*list.Element
+	// windows orders the sampledKey of keys by the start of their window,
+	// oldest first, so keys can be forgotten without going over all of them
+	windows *list.List
+}
+
+func newSamplingFormatter(formatter logrus.Formatter, opts SamplingOpts, now func() time.Time) *samplingFormatter {
+	return &samplingFormatter{
+		formatter: formatter,
+		opts:      opts,
+		now:       now,
+		keys:      map[string]*list.Element{},
+		windows:   list.New(),
+	}
+}
+
+func (f *samplingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level <= logrus.WarnLevel {
+		return f.formatter.Format(entry)
+	}
+	write, suppressed := f.sample(f.key(entry))
+	if !write {
+		promSuppressedLines.WithLabelValues(entry.Level.String()).Inc()
+		return nil, nil
+	}
+	if suppressed > 0 {
+		// entries are copied before being formatted, so the fields can be
+		// replaced without affecting the logger they came from
+		data := make(logrus.Fields, len(entry.Data)+1)
+		for key, value := range entry.Data {
+			data[key] = value
+		}
+		data[SuppressedLinesField] = suppressed
+		entry.Data = data
+	}
+	return f.formatter.Format(entry)
+}
+
+func (f *samplingFormatter) key(entry *logrus.Entry) string {
+	var key strings.Builder
+	key.WriteString(entry.Level.String())
+	key.WriteString("|")
+	key.WriteString(entry.Message)
+	for _, field := range f.opts.KeyFields {
+		key.WriteString("|")
+		if value, ok := entry.Data[field]; ok {
+			key.WriteString(fmt.Sprint(value))
+		}
+	}
+	return key.String()
+}
+
+// sample decides if the entry with key is written, and if so how many
+// entries with the same key were dropped since the last one was written
+func (f *samplingFormatter) sample(key string) (bool, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+
+	elem, ok := f.keys[key]
+	if !ok {
+		if len(f.keys) >= maxSampledKeys {
+			f.pruneKeys(now)
+		}
+		if len(f.keys) >= maxSampledKeys {
+			return true, 0
+		}
+		elem = f.windows.PushBack(&sampledKey{key: key, windowStart: now})
+		f.keys[key] = elem
+	}
+	sampled := elem.Value.(*sampledKey)
+	if now.Sub(sampled.windowStart) >= f.opts.Interval {
+		sampled.windowStart = now
+		sampled.count = 0
+		f.windows.MoveToBack(elem)
+	}
+
+	sampled.count++
+	if sampled.count > f.opts.First &&
+		(f.opts.Thereafter <= 0 || (sampled.count-f.opts.First)%f.opts.Thereafter != 0) {
+		sampled.suppressed++
+		return false, 0
+	}
+	suppressed := sampled.suppressed
+	sampled.suppressed = 0
+	return true, suppressed
+}
+
+// pruneKeys forgets the keys whose window ended, the entries they
+// suppressed are then only accounted for in promSuppressedLines. Only the
+// keys with ended windows are visited. Must be called with the lock held
+func (f *samplingFormatter) pruneKeys(now time.Time) {
+	for elem := f.windows.Front(); elem != nil; elem = f.windows.Front() {
+		sampled := elem.Value.(*sampledKey)
+		if now.Sub(sampled.windowStart) < f.opts.Interval {
+			return
+		}
+		f.windows.Remove(elem)
+		delete(f.keys, sampled.key)
+	}
+}
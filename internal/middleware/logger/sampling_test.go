@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSamplingFormatter(t *testing.T) {
+	type logLine struct {
+		level       logrus.Level
+		association string
+		advance     time.Duration
+	}
+	repeat := func(n int, line logLine) []logLine {
+		lines := make([]logLine, n)
+		for i := range lines {
+			lines[i] = line
+		}
+		return lines
+	}
+	info := logLine{level: logrus.InfoLevel, association: "a-1"}
+
+	testCases := []struct {
+		name               string
+		opts               SamplingOpts
+		lines              []logLine
+		expectedWritten    int
+		expectedSuppressed []string
+	}{
+		{
+			name:            "writes the first lines of every interval",
+			opts:            SamplingOpts{Interval: time.Minute, First: 2},
+			lines:           repeat(5, info),
+			expectedWritten: 2,
+		},
+		{
+			name:            "writes one out of every thereafter lines",
+			opts:            SamplingOpts{Interval: time.Minute, First: 2, Thereafter: 3},
+			lines:           repeat(8, info),
+			expectedWritten: 4,
+			expectedSuppressed: []string{
+				`"suppressed-lines":2`,
+				`"suppressed-lines":2`,
+			},
+		},
+		{
+			name: "reports suppressed lines once a new interval starts",
+			opts: SamplingOpts{Interval: time.Minute, First: 1},
+			lines: append(repeat(3, info),
+				logLine{level: logrus.InfoLevel, association: "a-1", advance: time.Minute}),
+			expectedWritten:    2,
+			expectedSuppressed: []string{`"suppressed-lines":2`},
+		},
+		{
+			name: "samples every key separately",
+			opts: SamplingOpts{Interval: time.Minute, First: 1, KeyFields: []string{"association-id"}},
+			lines: append(repeat(3, info),
+				repeat(3, logLine{level: logrus.InfoLevel, association: "a-2"})...),
+			expectedWritten: 2,
+		},
+		{
+			name:            "keys ignore fields not listed",
+			opts:            SamplingOpts{Interval: time.Minute, First: 1},
+			lines:           append(repeat(3, info), repeat(3, logLine{level: logrus.InfoLevel, association: "a-2"})...),
+			expectedWritten: 1,
+		},
+		{
+			name:            "always writes warnings and errors",
+			opts:            SamplingOpts{Interval: time.Minute, First: 1},
+			lines:           append(repeat(3, logLine{level: logrus.WarnLevel}), repeat(3, logLine{level: logrus.ErrorLevel})...),
+			expectedWritten: 6,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			now := time.Now()
+			buffer := &bytes.Buffer{}
+			log := logrus.New()
+			log.SetOutput(buffer)
+			log.SetLevel(logrus.TraceLevel)
+			log.SetFormatter(newSamplingFormatter(&logrus.JSONFormatter{}, tc.opts, func() time.Time { return now }))
+
+			// trigger
+			for _, line := range tc.lines {
+				now = now.Add(line.advance)
+				log.WithField("association-id", line.association).Log(line.level, "Storing creds in cache")
+			}
+
+			// validate
+			written := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+			g.Expect(written).To(HaveLen(tc.expectedWritten))
+			var suppressed []string
+			for _, line := range written {
+				if _, counter, ok := strings.Cut(line, `"suppressed-lines":`); ok {
+					count, _, _ := strings.Cut(counter, ",")
+					suppressed = append(suppressed, `"suppressed-lines":`+strings.TrimSuffix(count, "}"))
+				}
+			}
+			if tc.expectedSuppressed == nil {
+				g.Expect(suppressed).To(BeEmpty())
+			} else {
+				g.Expect(suppressed).To(Equal(tc.expectedSuppressed))
+			}
+		})
+	}
+}
+
+func TestSamplingFormatter_BoundsTrackedKeys(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	now := time.Now()
+	formatter := newSamplingFormatter(&logrus.JSONFormatter{},
+		SamplingOpts{Interval: time.Minute, First: 1}, func() time.Time { return now })
+	for i := 0; i < maxSampledKeys; i++ {
+		formatter.sample(strconv.Itoa(i))
+	}
+
+	// trigger, new keys are not sampled until old ones can be forgotten
+	full, _ := formatter.sample("new")
+	fullAgain, _ := formatter.sample("new")
+	now = now.Add(time.Minute)
+	pruned, _ := formatter.sample("new")
+	prunedAgain, _ := formatter.sample("new")
+
+	// validate
+	g.Expect(full).To(BeTrue())
+	g.Expect(fullAgain).To(BeTrue())
+	g.Expect(pruned).To(BeTrue())
+	g.Expect(prunedAgain).To(BeFalse())
+	g.Expect(formatter.keys).To(HaveLen(1))
+}
+
+func TestSamplingFormatter_PrunesKeysWithEndedWindows(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	now := time.Now()
+	formatter := newSamplingFormatter(&logrus.JSONFormatter{},
+		SamplingOpts{Interval: time.Minute, First: 1}, func() time.Time { return now })
+	for i := 0; i < maxSampledKeys; i++ {
+		formatter.sample(strconv.Itoa(i))
+	}
+	now = now.Add(time.Minute)
+	// the window of the first key starts again
+	formatter.sample("0")
+
+	// trigger
+	formatter.sample("new")
+
+	// validate, only the keys whose window ended are forgotten
+	g.Expect(formatter.keys).To(HaveLen(2))
+	g.Expect(formatter.keys).To(HaveKey("0"))
+	g.Expect(formatter.keys).To(HaveKey("new"))
+	g.Expect(formatter.windows.Len()).To(Equal(2))
+}
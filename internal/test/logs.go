@@ -0,0 +1,44 @@
+package test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+)
+
+const (
+	// SecretAccessKeyForTest and SessionTokenForTest look like real
+	// credentials, to check they are not leaked in logs
+	SecretAccessKeyForTest = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	SessionTokenForTest    = "IQoJb3JpZ2luX2VjEXAMPLE2luX2VjEBYaCXVzLXdlc3QtMiJHMEUCIQDtqstfDEaRfZKFK5Z2n2CN" +
+		"aNXbNiP2hEW9BVwqbVh4AIgLJxEXAMPLEGNxN9kW1bmeDbpQ8bqlsLFWuLjf0A9PKwuT3HO5UqxAQiU//////////"
+)
+
+// LogBuffer holds the logs written during a test
+type LogBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *LogBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// CaptureLogsForTest redirects the logs to the returned buffer until the
+// test finishes
+func CaptureLogsForTest(t *testing.T) *LogBuffer {
+	buffer := &LogBuffer{}
+	previous := logger.SetOutput(buffer)
+	t.Cleanup(func() { logger.SetOutput(previous) })
+	return buffer
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OidcServer is a local stand-in for a cluster OIDC issuer, it serves the
+// discovery document and the JWKS with the keys set on it
+type OidcServer struct {
+	*httptest.Server
+	mu           sync.Mutex
+	keys         map[string]*rsa.PublicKey
+	jwksRequests int
+}
+
+func NewOidcServerForTest(keys map[string]*rsa.PublicKey) *OidcServer {
+	s := &OidcServer{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   s.URL,
+			"jwks_uri": s.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.jwksRequests++
+		_, _ = w.Write(JwksForTest(s.keys))
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// DiscoveryUrl is the URL of the discovery document
+func (s *OidcServer) DiscoveryUrl() string {
+	return s.URL + "/.well-known/openid-configuration"
+}
+
+// SetKeys replaces the served keys, eg. to simulate a key rotation
+func (s *OidcServer) SetKeys(keys map[string]*rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+// JwksRequests returns how many times the JWKS was fetched
+func (s *OidcServer) JwksRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jwksRequests
+}
+
+// JwksForTest encodes the keys as a JWKS document
+func JwksForTest(keys map[string]*rsa.PublicKey) []byte {
+	type jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+	jwks := struct {
+		Keys []jwk `json:"keys"`
+	}{Keys: []jwk{}}
+	for kid, key := range keys {
+		jwks.Keys = append(jwks.Keys, jwk{
+			Kid: kid,
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	document, _ := json.Marshal(jwks)
+	return document
+}
+
+// CreateSignedTokenForTest signs the claims with key as RS256, setting kid
+// in the token header
+func CreateSignedTokenForTest(key *rsa.PrivateKey, kid string, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, _ := token.SignedString(key)
+	return signed
+}
@@ -5,17 +5,22 @@ import (
 	"time"
 )
 
-func CreateTokenForTest(expiry time.Time, iat time.Time, nbf time.Time) string {
-	someJwtSigningKey := []byte("signingKey")
+const someJwtSigningKey = "signingKey"
 
-	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+func CreateTokenForTest(expiry time.Time, iat time.Time, nbf time.Time) string {
+	return CreateTokenWithClaimsForTest(jwt.RegisteredClaims{
 		ExpiresAt: jwt.NewNumericDate(expiry),
 		IssuedAt:  jwt.NewNumericDate(iat),
 		NotBefore: jwt.NewNumericDate(nbf),
 		Issuer:    "some-issuer",
 		Subject:   "some-subject",
 		Audience:  []string{"some-audience"},
-	}).SignedString(someJwtSigningKey)
+	})
+}
 
+// CreateTokenWithClaimsForTest signs the given claims, useful when the test
+// requires claims other than the registered ones
+func CreateTokenWithClaimsForTest(claims jwt.Claims) string {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(someJwtSigningKey))
 	return token
 }
@@ -0,0 +1,283 @@
+package validation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+	"golang.org/x/sync/singleflight"
+)
+
+// A KeySet resolves the public keys service account tokens are signed with
+type KeySet interface {
+	// Keyfunc returns the key that should have signed the token
+	Keyfunc(ctx context.Context, token *jwt.Token) (interface{}, error)
+}
+
+const (
+	defaultJwksRefreshInterval = 1 * time.Hour
+	// minJwksRefreshInterval limits how often keys are reloaded when a
+	// token signed with an unknown key shows up, forged tokens would
+	// otherwise trigger a reload each
+	minJwksRefreshInterval = 10 * time.Second
+	jwksFetchTimeout       = 5 * time.Second
+)
+
+type JwksKeySetOpts struct {
+	// File is the path of a JWKS document, it is read again on every refresh
+	File string
+	// DiscoveryUrl is the URL of an OIDC discovery document, eg.
+	// <issuer>/.well-known/openid-configuration, whose jwks_uri the keys are
+	// fetched from. Ignored if File is set
+	DiscoveryUrl string
+	// RefreshInterval is how often keys are reloaded, default is 1h. Keys are
+	// also reloaded when a token is signed with an unknown key, so rotated
+	// keys are picked up without waiting for it
+	RefreshInterval time.Duration
+}
+
+// jwksKeySet caches the keys of a JWKS document. When the document cannot be
+// loaded the keys that were previously loaded keep being used.
+type jwksKeySet struct {
+	mu   sync.Mutex
+	keys map[string]interface{}
+	// loadedAt is when keys were last loaded successfully, attemptedAt
+	// when loading them last completed, successfully or not
+	loadedAt        time.Time
+	attemptedAt     time.Time
+	refreshInterval time.Duration
+	// refreshes coalesces the concurrent reloads of the keys
+	refreshes singleflight.Group
+	load      func(ctx context.Context) ([]byte, error)
+	now       func() time.Time
+}
+
+// NewJwksKeySet creates a KeySet that loads the keys lazily from a file or an
+// OIDC discovery URL
+func NewJwksKeySet(opts JwksKeySetOpts) KeySet {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = defaultJwksRefreshInterval
+	}
+	keySet := &jwksKeySet{
+		refreshInterval: opts.RefreshInterval,
+		now:             time.Now,
+	}
+	if opts.File != "" {
+		keySet.load = func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(opts.File)
+		}
+	} else {
+		client := &http.Client{Timeout: jwksFetchTimeout}
+		keySet.load = func(ctx context.Context) ([]byte, error) {
+			return fetchJwksFromDiscovery(ctx, client, opts.DiscoveryUrl)
+		}
+	}
+	return keySet
+}
+
+func (s *jwksKeySet) Keyfunc(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token does not specify a key id")
+	}
+
+	key, ok, stale := s.lookup(kid)
+	if stale {
+		// the reload is not tied to the request, a cancelled request must
+		// neither abort it for the other requests waiting on it
+		refreshed := s.refreshes.DoChan("", func() (interface{}, error) {
+			s.refresh(context.WithoutCancel(ctx))
+			return nil, nil
+		})
+		select {
+		case <-refreshed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		key, ok, _ = s.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no known key with id %s", kid)
+	}
+	return key, nil
+}
+
+// lookup returns the key with id kid, and whether the keys should be
+// reloaded first because it is unknown or they are due for a refresh.
+// Reloads are attempted at most every minJwksRefreshInterval.
+func (s *jwksKeySet) lookup(kid string) (interface{}, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	key, ok := s.keys[kid]
+	if now.Sub(s.attemptedAt) < minJwksRefreshInterval {
+		return key, ok, false
+	}
+	return key, ok, !ok || now.Sub(s.loadedAt) >= s.refreshInterval
+}
+
+// refresh loads the keys again, keeping the current ones on failure. The
+// lock is only held to swap the keys, not while they are loaded, requests
+// looking up keys meanwhile wait on the same refresh.
+func (s *jwksKeySet) refresh(ctx context.Context) {
+	log := logger.FromContext(ctx)
+	keys, err := s.loadKeys(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attemptedAt = s.now()
+	if err != nil {
+		log.Errorf("Unable to load service account token signing keys, keeping %d known keys: %v", len(s.keys), err)
+		return
+	}
+	log.Infof("Loaded %d service account token signing keys", len(keys))
+	s.keys = keys
+	s.loadedAt = s.attemptedAt
+}
+
+func (s *jwksKeySet) loadKeys(ctx context.Context) (map[string]interface{}, error) {
+	document, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseJwks(document)
+	if err != nil {
+		return nil, fmt.Errorf("parsing keys: %w", err)
+	}
+	return keys, nil
+}
+
+func fetchJwksFromDiscovery(ctx context.Context, client *http.Client, discoveryUrl string) ([]byte, error) {
+	document, err := httpGet(ctx, client, discoveryUrl)
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	var discovery struct {
+		JwksUri string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(document, &discovery); err != nil {
+		return nil, fmt.Errorf("parsing discovery document: %w", err)
+	}
+	if discovery.JwksUri == "" {
+		return nil, fmt.Errorf("discovery document has no jwks_uri")
+	}
+	return httpGet(ctx, client, discovery.JwksUri)
+}
+
+func httpGet(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJwks returns the signing keys in the JWKS document by key id, keys of
+// unsupported types are skipped
+func parseJwks(document []byte) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(document, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		var key interface{}
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaPublicKey()
+		case "EC":
+			key, err = jwk.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil || !e.IsInt64() {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+	}
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) == 0 {
+		return nil, fmt.Errorf("value is empty")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
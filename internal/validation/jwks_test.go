@@ -0,0 +1,235 @@
+package validation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/gomega"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
+)
+
+func generateKeyForTest(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	return key
+}
+
+func TestValidateEksCredentialRequest_Signature(t *testing.T) {
+	signingKey := generateKeyForTest(t)
+	forgingKey := generateKeyForTest(t)
+	oidcServer := test.NewOidcServerForTest(map[string]*rsa.PublicKey{"some-kid": &signingKey.PublicKey})
+	defer oidcServer.Close()
+	claims := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+
+	testCases := []struct {
+		name  string
+		token string
+		error string
+	}{
+		{
+			name:  "passes on token signed with a known key",
+			token: test.CreateSignedTokenForTest(signingKey, "some-kid", claims),
+		},
+		{
+			name:  "forged token",
+			token: test.CreateSignedTokenForTest(forgingKey, "some-kid", claims),
+			error: "Service account token signature cannot be verified: token signature is invalid: crypto/rsa: verification error",
+		},
+		{
+			name:  "token signed with an unknown key",
+			token: test.CreateSignedTokenForTest(signingKey, "other-kid", claims),
+			error: "Service account token signature cannot be verified: token is unverifiable: error while executing keyfunc: no known key with id other-kid",
+		},
+		{
+			name:  "token without key id",
+			token: test.CreateSignedTokenForTest(signingKey, "", claims),
+			error: "Service account token signature cannot be verified: token is unverifiable: error while executing keyfunc: token does not specify a key id",
+		},
+		{
+			name:  "token signed with a symmetric key",
+			token: test.CreateTokenWithClaimsForTest(claims),
+			error: "Service account token signature cannot be verified: token signature is invalid: signing method HS256 is invalid",
+		},
+	}
+
+	validator := DefaultCredentialValidator{
+		KeySet: NewJwksKeySet(JwksKeySetOpts{DiscoveryUrl: oidcServer.DiscoveryUrl()}),
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// setup
+			g := NewWithT(t)
+			request := &credentials.EksCredentialsRequest{
+				ServiceAccountToken: tc.token,
+				RequestTargetHost:   configuration.DefaultIpv4TargetHost,
+			}
+
+			// trigger
+			err := validator.ValidateEksCredentialRequest(context.Background(), request)
+
+			// validate
+			if tc.error != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(tc.error))
+			} else {
+				g.Expect(err).To(Not(HaveOccurred()))
+			}
+		})
+	}
+}
+
+func TestJwksKeySet_Rotation(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup
+	oldKey := generateKeyForTest(t)
+	newKey := generateKeyForTest(t)
+	oidcServer := test.NewOidcServerForTest(map[string]*rsa.PublicKey{"old-kid": &oldKey.PublicKey})
+	defer oidcServer.Close()
+	now := time.Now()
+	keySet := NewJwksKeySet(JwksKeySetOpts{DiscoveryUrl: oidcServer.DiscoveryUrl()}).(*jwksKeySet)
+	keySet.now = func() time.Time { return now }
+	tokenWithKid := func(kid string) *jwt.Token {
+		return &jwt.Token{Header: map[string]interface{}{"kid": kid}}
+	}
+
+	// trigger, keys are loaded on first use and cached
+	_, err := keySet.Keyfunc(ctx, tokenWithKid("old-kid"))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = keySet.Keyfunc(ctx, tokenWithKid("old-kid"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(oidcServer.JwksRequests()).To(Equal(1))
+
+	// rotate, unknown keys do not trigger a reload right after one
+	oidcServer.SetKeys(map[string]*rsa.PublicKey{"new-kid": &newKey.PublicKey})
+	_, err = keySet.Keyfunc(ctx, tokenWithKid("new-kid"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(oidcServer.JwksRequests()).To(Equal(1))
+
+	// but do once some time passed
+	now = now.Add(minJwksRefreshInterval)
+	key, err := keySet.Keyfunc(ctx, tokenWithKid("new-kid"))
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(key).To(Equal(&newKey.PublicKey))
+	g.Expect(oidcServer.JwksRequests()).To(Equal(2))
+}
+
+func TestJwksKeySet_File(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup
+	key := generateKeyForTest(t)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	g.Expect(os.WriteFile(jwksFile, test.JwksForTest(map[string]*rsa.PublicKey{"some-kid": &key.PublicKey}), 0600)).To(Succeed())
+	now := time.Now()
+	keySet := NewJwksKeySet(JwksKeySetOpts{File: jwksFile, RefreshInterval: time.Minute}).(*jwksKeySet)
+	keySet.now = func() time.Time { return now }
+	token := &jwt.Token{Header: map[string]interface{}{"kid": "some-kid"}}
+
+	// trigger
+	_, err := keySet.Keyfunc(ctx, token)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// the file can no longer be read when keys are refreshed
+	g.Expect(os.Remove(jwksFile)).To(Succeed())
+	now = now.Add(time.Minute)
+	loadedKey, err := keySet.Keyfunc(ctx, token)
+
+	// validate, keys loaded before are kept
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loadedKey).To(Equal(&key.PublicKey))
+}
+
+func TestJwksKeySet_RetriesFailedRefresh(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup
+	key := generateKeyForTest(t)
+	now := time.Now()
+	loads := 0
+	var loadErr error
+	keySet := NewJwksKeySet(JwksKeySetOpts{RefreshInterval: time.Minute}).(*jwksKeySet)
+	keySet.now = func() time.Time { return now }
+	keySet.load = func(ctx context.Context) ([]byte, error) {
+		loads++
+		return test.JwksForTest(map[string]*rsa.PublicKey{"some-kid": &key.PublicKey}), loadErr
+	}
+	token := &jwt.Token{Header: map[string]interface{}{"kid": "some-kid"}}
+	_, err := keySet.Keyfunc(ctx, token)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// the refresh fails
+	loadErr = errors.New("some error")
+	now = now.Add(time.Minute)
+	_, err = keySet.Keyfunc(ctx, token)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loads).To(Equal(2))
+
+	// trigger, the next refresh is attempted without waiting for the
+	// refresh interval
+	loadErr = nil
+	now = now.Add(minJwksRefreshInterval)
+	_, err = keySet.Keyfunc(ctx, token)
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loads).To(Equal(3))
+	g.Expect(keySet.loadedAt).To(Equal(now))
+}
+
+func TestJwksKeySet_ConcurrentRefresh(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup, the keys load once the test lets them
+	key := generateKeyForTest(t)
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	var loads atomic.Int32
+	keySet := NewJwksKeySet(JwksKeySetOpts{}).(*jwksKeySet)
+	keySet.load = func(ctx context.Context) ([]byte, error) {
+		loads.Add(1)
+		close(loading)
+		<-release
+		return test.JwksForTest(map[string]*rsa.PublicKey{"some-kid": &key.PublicKey}), ctx.Err()
+	}
+	token := &jwt.Token{Header: map[string]interface{}{"kid": "some-kid"}}
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := keySet.Keyfunc(cancelledCtx, token)
+		cancelledErr <- err
+	}()
+	<-loading
+
+	// trigger, a request waits on the ongoing refresh while the one that
+	// started it is cancelled
+	loadedKey := make(chan interface{})
+	go func() {
+		key, _ := keySet.Keyfunc(context.Background(), token)
+		loadedKey <- key
+	}()
+	cancel()
+	g.Expect(<-cancelledErr).To(MatchError(context.Canceled))
+	close(release)
+
+	// validate, the refresh completed for the other request
+	g.Expect(<-loadedKey).To(Equal(&key.PublicKey))
+	g.Expect(loads.Load()).To(Equal(int32(1)))
+}
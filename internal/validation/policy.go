@@ -0,0 +1,180 @@
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/errors"
+)
+
+// An AccessPolicy decides which service accounts can fetch credentials
+// through the agent
+type AccessPolicy interface {
+	// Authorize returns an errors.AccessDeniedError if the service account
+	// is not allowed to fetch credentials
+	Authorize(ctx context.Context, namespace, serviceAccount string) error
+}
+
+var promPolicyDenials = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pod_identity_access_policy_denials",
+	Help: "Requests denied by the access policy",
+}, []string{"reason"})
+
+const defaultPolicyReloadInterval = 30 * time.Second
+
+// AccessPolicyRules is the content of the access policy file, eg.
+//
+//	{
+//	  "namespaces": {"deny": ["kube-*"]},
+//	  "serviceAccounts": {"allow": ["team-a:*", "team-b:app-*"]}
+//	}
+//
+// Patterns use path.Match syntax, service account patterns are matched
+// against <namespace>:<name>. A service account is allowed when it matches no
+// deny pattern and, if allow patterns are listed, at least one of them.
+type AccessPolicyRules struct {
+	Namespaces      AllowDenyList `json:"namespaces"`
+	ServiceAccounts AllowDenyList `json:"serviceAccounts"`
+}
+
+type AllowDenyList struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// validate checks that all patterns are well-formed so matching never fails
+func (l AllowDenyList) validate() error {
+	for _, pattern := range append(append([]string{}, l.Allow...), l.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// permits returns the pattern denying value, if any
+func (l AllowDenyList) permits(value string) (string, bool) {
+	for _, pattern := range l.Deny {
+		if matched, _ := path.Match(pattern, value); matched {
+			return fmt.Sprintf("matches deny pattern %q", pattern), false
+		}
+	}
+	if len(l.Allow) == 0 {
+		return "", true
+	}
+	for _, pattern := range l.Allow {
+		if matched, _ := path.Match(pattern, value); matched {
+			return "", true
+		}
+	}
+	return "matches no allow pattern", false
+}
+
+func (r AccessPolicyRules) Authorize(ctx context.Context, namespace, serviceAccount string) error {
+	if namespace == "" || serviceAccount == "" {
+		promPolicyDenials.WithLabelValues("unknown_identity").Inc()
+		return errors.NewAccessDeniedError("Service account token does not name a namespace and service account")
+	}
+	if reason, ok := r.Namespaces.permits(namespace); !ok {
+		promPolicyDenials.WithLabelValues("namespace").Inc()
+		return errors.NewAccessDeniedError(fmt.Sprintf("Namespace %s is not allowed by the access policy, it %s", namespace, reason))
+	}
+	qualifiedName := namespace + ":" + serviceAccount
+	if reason, ok := r.ServiceAccounts.permits(qualifiedName); !ok {
+		promPolicyDenials.WithLabelValues("service_account").Inc()
+		return errors.NewAccessDeniedError(fmt.Sprintf("Service account %s is not allowed by the access policy, it %s", qualifiedName, reason))
+	}
+	return nil
+}
+
+// fileAccessPolicy enforces the rules in a file, reloading them when the file
+// changes. If the changed file is invalid the previous rules are kept.
+type fileAccessPolicy struct {
+	mu             sync.Mutex
+	file           string
+	rules          AccessPolicyRules
+	modTime        time.Time
+	checkedAt      time.Time
+	reloadInterval time.Duration
+	now            func() time.Time
+}
+
+// NewFileAccessPolicy loads the access policy rules in file, which is checked
+// for changes at most once every reloadInterval
+func NewFileAccessPolicy(file string, reloadInterval time.Duration) (AccessPolicy, error) {
+	if reloadInterval <= 0 {
+		reloadInterval = defaultPolicyReloadInterval
+	}
+	p := &fileAccessPolicy{
+		file:           file,
+		reloadInterval: reloadInterval,
+		now:            time.Now,
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.load(info.ModTime()); err != nil {
+		return nil, err
+	}
+	p.checkedAt = p.now()
+	return p, nil
+}
+
+func (p *fileAccessPolicy) Authorize(ctx context.Context, namespace, serviceAccount string) error {
+	return p.currentRules(ctx).Authorize(ctx, namespace, serviceAccount)
+}
+
+func (p *fileAccessPolicy) currentRules(ctx context.Context) AccessPolicyRules {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.now().Sub(p.checkedAt) < p.reloadInterval {
+		return p.rules
+	}
+	p.checkedAt = p.now()
+
+	log := logger.FromContext(ctx).WithField("policy-file", p.file)
+	info, err := os.Stat(p.file)
+	if err != nil {
+		log.Errorf("Unable to check access policy for changes, keeping current one: %v", err)
+		return p.rules
+	}
+	if info.ModTime().Equal(p.modTime) {
+		return p.rules
+	}
+	if err := p.load(info.ModTime()); err != nil {
+		log.Errorf("Unable to reload access policy, keeping current one: %v", err)
+		return p.rules
+	}
+	log.Info("Reloaded access policy")
+	return p.rules
+}
+
+// load reads the rules from the file. Must be called with the lock held
+func (p *fileAccessPolicy) load(modTime time.Time) error {
+	content, err := os.ReadFile(p.file)
+	if err != nil {
+		return err
+	}
+	var rules AccessPolicyRules
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return fmt.Errorf("parsing access policy: %w", err)
+	}
+	if err := rules.Namespaces.validate(); err != nil {
+		return fmt.Errorf("namespaces: %w", err)
+	}
+	if err := rules.ServiceAccounts.validate(); err != nil {
+		return fmt.Errorf("serviceAccounts: %w", err)
+	}
+	p.rules = rules
+	p.modTime = modTime
+	return nil
+}
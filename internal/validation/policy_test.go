@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/gomega"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
+)
+
+func TestAccessPolicyRules_Authorize(t *testing.T) {
+	rules := AccessPolicyRules{
+		Namespaces: AllowDenyList{Deny: []string{"kube-*"}},
+		ServiceAccounts: AllowDenyList{
+			Allow: []string{"team-a:*", "team-b:app-*"},
+			Deny:  []string{"*:admin"},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		rules          AccessPolicyRules
+		namespace      string
+		serviceAccount string
+		error          string
+	}{
+		{
+			name:           "allowed service account",
+			rules:          rules,
+			namespace:      "team-b",
+			serviceAccount: "app-frontend",
+		},
+		{
+			name:           "empty policy allows everything",
+			namespace:      "kube-system",
+			serviceAccount: "admin",
+		},
+		{
+			name:           "denied namespace",
+			rules:          rules,
+			namespace:      "kube-system",
+			serviceAccount: "some-sa",
+			error:          "Access Denied. Namespace kube-system is not allowed by the access policy, it matches deny pattern \"kube-*\"",
+		},
+		{
+			name:           "denied service account",
+			rules:          rules,
+			namespace:      "team-a",
+			serviceAccount: "admin",
+			error:          "Access Denied. Service account team-a:admin is not allowed by the access policy, it matches deny pattern \"*:admin\"",
+		},
+		{
+			name:           "service account not allowed",
+			rules:          rules,
+			namespace:      "team-b",
+			serviceAccount: "batch",
+			error:          "Access Denied. Service account team-b:batch is not allowed by the access policy, it matches no allow pattern",
+		},
+		{
+			name:  "unknown identity",
+			rules: rules,
+			error: "Access Denied. Service account token does not name a namespace and service account",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			err := tc.rules.Authorize(context.Background(), tc.namespace, tc.serviceAccount)
+
+			// validate
+			if tc.error != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(tc.error))
+			} else {
+				g.Expect(err).To(Not(HaveOccurred()))
+			}
+		})
+	}
+}
+
+func TestFileAccessPolicy(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy := func(content string, modTime time.Time) {
+		g.Expect(os.WriteFile(policyFile, []byte(content), 0600)).To(Succeed())
+		g.Expect(os.Chtimes(policyFile, modTime, modTime)).To(Succeed())
+	}
+	now := time.Now()
+	writePolicy(`{"namespaces": {"deny": ["team-a"]}}`, now)
+	policy, err := NewFileAccessPolicy(policyFile, time.Minute)
+	g.Expect(err).ToNot(HaveOccurred())
+	policy.(*fileAccessPolicy).now = func() time.Time { return now }
+	g.Expect(policy.Authorize(ctx, "team-a", "some-sa")).To(HaveOccurred())
+
+	// trigger, changes are picked up once the reload interval passes
+	writePolicy(`{"namespaces": {"deny": ["team-b"]}}`, now.Add(time.Second))
+	g.Expect(policy.Authorize(ctx, "team-a", "some-sa")).To(HaveOccurred())
+	now = now.Add(2 * time.Minute)
+	g.Expect(policy.Authorize(ctx, "team-a", "some-sa")).ToNot(HaveOccurred())
+	g.Expect(policy.Authorize(ctx, "team-b", "some-sa")).To(HaveOccurred())
+
+	// an invalid policy does not replace the current one
+	writePolicy(`{"namespaces": {"deny": ["[team"]}}`, now.Add(2*time.Second))
+	now = now.Add(2 * time.Minute)
+
+	// validate
+	g.Expect(policy.Authorize(ctx, "team-a", "some-sa")).ToNot(HaveOccurred())
+	g.Expect(policy.Authorize(ctx, "team-b", "some-sa")).To(HaveOccurred())
+
+	// and is rejected on start
+	_, err = NewFileAccessPolicy(policyFile, time.Minute)
+	g.Expect(err).To(MatchError(ContainSubstring("namespaces: invalid pattern \"[team\"")))
+}
+
+func TestValidateEksCredentialRequest_Policy(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	validator := DefaultCredentialValidator{
+		Policy: AccessPolicyRules{Namespaces: AllowDenyList{Allow: []string{"team-a"}}},
+	}
+	requestFor := func(namespace string) *credentials.EksCredentialsRequest {
+		return &credentials.EksCredentialsRequest{
+			ServiceAccountToken: test.CreateTokenWithClaimsForTest(k8s.ServiceAccountClaims{
+				RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+				Kubernetes: k8s.KubernetesClaims{
+					Namespace:      namespace,
+					ServiceAccount: k8s.ObjectClaim{Name: "some-sa"},
+				},
+			}),
+			RequestTargetHost: configuration.DefaultIpv4TargetHost,
+		}
+	}
+
+	// trigger
+	allowedErr := validator.ValidateEksCredentialRequest(context.Background(), requestFor("team-a"))
+	deniedErr := validator.ValidateEksCredentialRequest(context.Background(), requestFor("team-b"))
+
+	// validate
+	g.Expect(allowedErr).ToNot(HaveOccurred())
+	g.Expect(deniedErr).To(MatchError(
+		"Access Denied. Namespace team-b is not allowed by the access policy, it matches no allow pattern"))
+}
@@ -2,14 +2,18 @@ package validation
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	_ "github.com/golang-jwt/jwt/v5"
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/errors"
 	"net"
+	"slices"
+	"strings"
 )
 
 // A RequestValidator validates the requests that are expected by the agent
@@ -22,8 +26,28 @@ type DefaultCredentialValidator struct {
 	// If not specified, we will use configuration.DefaultIpv4TargetHost and
 	// configuration.DefaultIpv6TargetHost
 	TargetHosts []string
+	// Audience if set must be one of the token audiences, usually
+	// configuration.DefaultTokenAudience
+	Audience string
+	// Issuers if set lists the accepted token issuers, usually the cluster
+	// OIDC issuer
+	Issuers []string
+	// ValidateSubject checks that the token subject names a service account,
+	// as in system:serviceaccount:<namespace>:<name>
+	ValidateSubject bool
+	// KeySet if set is used to verify the token signature, otherwise the
+	// signature is left for EKS Auth to verify
+	KeySet KeySet
+	// Policy if set decides which service accounts, as named in the token
+	// kubernetes.io claims, can fetch credentials
+	Policy AccessPolicy
+	// PodIPLookup if set is used to check that the request comes from the
+	// pod named in the token kubernetes.io claims
+	PodIPLookup k8s.PodIPLookup
 }
 
+const serviceAccountSubjectPrefix = "system:serviceaccount:"
+
 var (
 	jwtParser               = jwt.NewParser()
 	jwtValidator            = jwt.NewValidator()
@@ -33,6 +57,11 @@ var (
 	}
 )
 
+// jwtVerifier only checks signatures, claims are validated separately
+var jwtVerifier = jwt.NewParser(
+	jwt.WithoutClaimsValidation(),
+	jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+
 // ValidateEksCredentialRequest is called to validate whether a request from the user is valid or not
 func (cv DefaultCredentialValidator) ValidateEksCredentialRequest(ctx context.Context, credsRequest *credentials.EksCredentialsRequest) error {
 	log := logger.FromContext(ctx)
@@ -43,7 +72,12 @@ func (cv DefaultCredentialValidator) ValidateEksCredentialRequest(ctx context.Co
 		return err
 	}
 
-	err = cv.validateToken(credsRequest)
+	claims, err := cv.validateToken(ctx, credsRequest)
+	if err != nil {
+		return err
+	}
+
+	err = cv.validateRemoteAddr(ctx, credsRequest.RemoteAddr, claims)
 	if err != nil {
 		return err
 	}
@@ -52,24 +86,115 @@ func (cv DefaultCredentialValidator) ValidateEksCredentialRequest(ctx context.Co
 	return nil
 }
 
-// validateToken checks if the JWT token is parseable
-func (cv DefaultCredentialValidator) validateToken(credsRequest *credentials.EksCredentialsRequest) error {
+// validateToken checks if the JWT token is parseable and, when configured,
+// signed by one of the KeySet keys and allowed by the Policy
+func (cv DefaultCredentialValidator) validateToken(ctx context.Context, credsRequest *credentials.EksCredentialsRequest) (*k8s.ServiceAccountClaims, error) {
 	// just verify the token is parseable, we will detect if it's valid or not on the service
 	if credsRequest.ServiceAccountToken == "" {
-		return errors.NewRequestValidationError("Service account token cannot be empty")
+		return nil, errors.NewRequestValidationError("Service account token cannot be empty")
 	}
-	parsedToken, _, err := jwtParser.ParseUnverified(credsRequest.ServiceAccountToken, &jwt.RegisteredClaims{})
+	claims := &k8s.ServiceAccountClaims{}
+	parsedToken, _, err := jwtParser.ParseUnverified(credsRequest.ServiceAccountToken, claims)
 	if err != nil {
-		return errors.NewRequestValidationError(fmt.Sprintf("Service account token cannot be parsed: %v", err))
+		return nil, errors.NewRequestValidationError(fmt.Sprintf("Service account token cannot be parsed: %v", err))
 	}
 
 	err = jwtValidator.Validate(parsedToken.Claims)
 	if err != nil {
-		return errors.NewRequestValidationError(fmt.Sprintf("Service account token failed basic claim validations: %v", err))
+		return nil, errors.NewRequestValidationError(fmt.Sprintf("Service account token failed basic claim validations: %v", err))
+	}
+
+	err = cv.validateClaims(&claims.RegisteredClaims)
+	if err != nil {
+		return nil, errors.NewRequestValidationError(fmt.Sprintf("Service account token failed claim validations: %v", err))
+	}
+
+	if cv.KeySet != nil {
+		_, err = jwtVerifier.Parse(credsRequest.ServiceAccountToken, func(token *jwt.Token) (interface{}, error) {
+			return cv.KeySet.Keyfunc(ctx, token)
+		})
+		if err != nil {
+			return nil, errors.NewRequestValidationError(fmt.Sprintf("Service account token signature cannot be verified: %v", err))
+		}
+	}
+
+	if cv.Policy != nil {
+		if err = cv.Policy.Authorize(ctx, claims.Kubernetes.Namespace, claims.Kubernetes.ServiceAccount.Name); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// validateClaims checks the audience, issuer and subject of the token
+// against the configured ones, so tokens that are not meant for the agent
+// or come from another cluster are rejected before calling EKS Auth
+func (cv DefaultCredentialValidator) validateClaims(claims *jwt.RegisteredClaims) error {
+	if cv.Audience != "" && !slices.Contains(claims.Audience, cv.Audience) {
+		return fmt.Errorf("audience %v does not include %s", []string(claims.Audience), cv.Audience)
+	}
+	if len(cv.Issuers) != 0 && !slices.Contains(cv.Issuers, claims.Issuer) {
+		return fmt.Errorf("issuer %s is not one of %v", claims.Issuer, cv.Issuers)
+	}
+	if cv.ValidateSubject && !isServiceAccountSubject(claims.Subject) {
+		return fmt.Errorf("subject %s is not of the form %s<namespace>:<name>", claims.Subject, serviceAccountSubjectPrefix)
 	}
 	return nil
 }
 
+// isServiceAccountSubject checks if subject has the
+// system:serviceaccount:<namespace>:<name> shape
+func isServiceAccountSubject(subject string) bool {
+	rest, ok := strings.CutPrefix(subject, serviceAccountSubjectPrefix)
+	if !ok {
+		return false
+	}
+	namespace, name, ok := strings.Cut(rest, ":")
+	return ok && namespace != "" && name != "" && !strings.Contains(name, ":")
+}
+
+// validateRemoteAddr checks that the request comes from one of the IPs of
+// the pod the token was issued to, so tokens leaked to other processes on
+// the node cannot be used to fetch the pod's credentials. The pod UID is
+// compared as well, so a token issued to a deleted pod cannot be used by a
+// new pod reusing its name.
+func (cv DefaultCredentialValidator) validateRemoteAddr(ctx context.Context, remoteAddr string, claims *k8s.ServiceAccountClaims) error {
+	if cv.PodIPLookup == nil {
+		return nil
+	}
+	namespace, podName := claims.Kubernetes.Namespace, claims.Kubernetes.Pod.Name
+	if namespace == "" || podName == "" {
+		return errors.NewAccessDeniedError("Service account token is not bound to a pod")
+	}
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	remoteIP := net.ParseIP(host)
+	if remoteIP == nil {
+		return errors.NewAccessDeniedError(fmt.Sprintf("Unable to determine the address of the caller from %s", remoteAddr))
+	}
+
+	pod, err := cv.PodIPLookup.LookupPod(ctx, namespace, podName)
+	if goerrors.Is(err, k8s.ErrPodNotFound) {
+		return errors.NewAccessDeniedError(fmt.Sprintf("Pod %s/%s is not running on the node", namespace, podName))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to look up the IPs of pod %s/%s: %w", namespace, podName, err)
+	}
+	if uid := claims.Kubernetes.Pod.UID; uid != "" && uid != pod.UID {
+		logger.FromContext(ctx).Debugf("Token pod UID %s does not match pod UID %s", uid, pod.UID)
+		return errors.NewAccessDeniedError(fmt.Sprintf("Pod %s/%s is not the pod the token was issued to", namespace, podName))
+	}
+	for _, podIP := range pod.IPs {
+		if remoteIP.Equal(net.ParseIP(podIP)) {
+			return nil
+		}
+	}
+	logger.FromContext(ctx).Debugf("Caller %s does not match pod IPs %v", remoteIP, pod.IPs)
+	return errors.NewAccessDeniedError(fmt.Sprintf("Caller %s is not pod %s/%s", remoteIP, namespace, podName))
+}
+
 // validateRequestTargetHost checks whether the request address matches the
 // assign bind address for the agent
 func (cv DefaultCredentialValidator) validateRequestTargetHost(ctx context.Context, requestTargetHost string) error {
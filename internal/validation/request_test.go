@@ -2,14 +2,19 @@ package validation
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	. "github.com/onsi/gomega"
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/errors"
 )
 
 func TestValidateEksCredentialRequest(t *testing.T) {
@@ -117,3 +122,229 @@ func TestValidateEksCredentialRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEksCredentialRequest_Claims(t *testing.T) {
+	validator := DefaultCredentialValidator{
+		Audience:        configuration.DefaultTokenAudience,
+		Issuers:         []string{"https://oidc.eks.us-west-2.amazonaws.com/id/SOMEID"},
+		ValidateSubject: true,
+	}
+	validClaims := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			Issuer:    "https://oidc.eks.us-west-2.amazonaws.com/id/SOMEID",
+			Subject:   "system:serviceaccount:some-namespace:some-sa",
+			Audience:  []string{"some-audience", configuration.DefaultTokenAudience},
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		validator    DefaultCredentialValidator
+		modifyClaims func(claims *jwt.RegisteredClaims)
+		error        string
+	}{
+		{
+			name:         "passes on valid claims",
+			validator:    validator,
+			modifyClaims: func(claims *jwt.RegisteredClaims) {},
+		},
+		{
+			name:      "passes on any claims when checks are disabled",
+			validator: DefaultCredentialValidator{},
+			modifyClaims: func(claims *jwt.RegisteredClaims) {
+				claims.Audience = nil
+				claims.Issuer = "some-issuer"
+				claims.Subject = "some-subject"
+			},
+		},
+		{
+			name:      "audience does not include the expected one",
+			validator: validator,
+			modifyClaims: func(claims *jwt.RegisteredClaims) {
+				claims.Audience = []string{"sts.amazonaws.com"}
+			},
+			error: "Service account token failed claim validations: audience [sts.amazonaws.com] does not include pods.eks.amazonaws.com",
+		},
+		{
+			name:      "issuer is not allowed",
+			validator: validator,
+			modifyClaims: func(claims *jwt.RegisteredClaims) {
+				claims.Issuer = "https://oidc.eks.us-west-2.amazonaws.com/id/OTHERID"
+			},
+			error: "Service account token failed claim validations: issuer https://oidc.eks.us-west-2.amazonaws.com/id/OTHERID " +
+				"is not one of [https://oidc.eks.us-west-2.amazonaws.com/id/SOMEID]",
+		},
+		{
+			name:      "subject is not a service account",
+			validator: validator,
+			modifyClaims: func(claims *jwt.RegisteredClaims) {
+				claims.Subject = "system:node:some-node"
+			},
+			error: "Service account token failed claim validations: subject system:node:some-node " +
+				"is not of the form system:serviceaccount:<namespace>:<name>",
+		},
+		{
+			name:      "subject misses the service account name",
+			validator: validator,
+			modifyClaims: func(claims *jwt.RegisteredClaims) {
+				claims.Subject = "system:serviceaccount:some-namespace:"
+			},
+			error: "Service account token failed claim validations: subject system:serviceaccount:some-namespace: " +
+				"is not of the form system:serviceaccount:<namespace>:<name>",
+		},
+		{
+			name:      "subject has extra segments",
+			validator: validator,
+			modifyClaims: func(claims *jwt.RegisteredClaims) {
+				claims.Subject = "system:serviceaccount:some-namespace:some-sa:extra"
+			},
+			error: "Service account token failed claim validations: subject system:serviceaccount:some-namespace:some-sa:extra " +
+				"is not of the form system:serviceaccount:<namespace>:<name>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// setup
+			g := NewWithT(t)
+			claims := validClaims()
+			tc.modifyClaims(&claims)
+			request := &credentials.EksCredentialsRequest{
+				ServiceAccountToken: test.CreateTokenWithClaimsForTest(claims),
+				RequestTargetHost:   configuration.DefaultIpv4TargetHost,
+			}
+
+			// trigger
+			err := tc.validator.ValidateEksCredentialRequest(context.Background(), request)
+
+			// validate
+			if tc.error != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(tc.error))
+			} else {
+				g.Expect(err).To(Not(HaveOccurred()))
+			}
+		})
+	}
+}
+
+type fakePodIPLookup struct {
+	pod k8s.Pod
+	err error
+}
+
+func (f fakePodIPLookup) LookupPod(ctx context.Context, namespace, name string) (k8s.Pod, error) {
+	return f.pod, f.err
+}
+
+func TestValidateEksCredentialRequest_RemoteAddr(t *testing.T) {
+	podLookup := fakePodIPLookup{pod: k8s.Pod{
+		Name:      "some-pod",
+		Namespace: "some-namespace",
+		UID:       "some-uid",
+		IPs:       []string{"10.0.0.1", "fd00::1"},
+	}}
+	podToken := test.CreateTokenWithClaimsForTest(k8s.ServiceAccountClaims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		Kubernetes: k8s.KubernetesClaims{
+			Namespace: "some-namespace",
+			Pod:       k8s.ObjectClaim{Name: "some-pod", UID: "some-uid"},
+		},
+	})
+	recreatedPodLookup := podLookup
+	recreatedPodLookup.pod.UID = "other-uid"
+
+	testCases := []struct {
+		name       string
+		lookup     k8s.PodIPLookup
+		token      string
+		remoteAddr string
+		error      string
+		httpStatus int
+	}{
+		{
+			name:       "passes when called from the pod IPv4",
+			lookup:     podLookup,
+			token:      podToken,
+			remoteAddr: "10.0.0.1:41234",
+		},
+		{
+			name:       "passes when called from the pod IPv6",
+			lookup:     podLookup,
+			token:      podToken,
+			remoteAddr: "[fd00::1]:41234",
+		},
+		{
+			name:       "passes from any address when disabled",
+			token:      podToken,
+			remoteAddr: "10.0.0.2:41234",
+		},
+		{
+			name:       "called from another address",
+			lookup:     podLookup,
+			token:      podToken,
+			remoteAddr: "10.0.0.2:41234",
+			error:      "Access Denied. Caller 10.0.0.2 is not pod some-namespace/some-pod",
+			httpStatus: http.StatusForbidden,
+		},
+		{
+			name:       "pod was recreated with the same name",
+			lookup:     recreatedPodLookup,
+			token:      podToken,
+			remoteAddr: "10.0.0.1:41234",
+			error:      "Access Denied. Pod some-namespace/some-pod is not the pod the token was issued to",
+			httpStatus: http.StatusForbidden,
+		},
+		{
+			name:       "pod is not running on the node",
+			lookup:     fakePodIPLookup{err: k8s.ErrPodNotFound},
+			token:      podToken,
+			remoteAddr: "10.0.0.1:41234",
+			error:      "Access Denied. Pod some-namespace/some-pod is not running on the node",
+			httpStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token not bound to a pod",
+			lookup:     podLookup,
+			token:      test.CreateTokenForTest(time.Now().Add(1*time.Hour), time.Now(), time.Now()),
+			remoteAddr: "10.0.0.1:41234",
+			error:      "Access Denied. Service account token is not bound to a pod",
+			httpStatus: http.StatusForbidden,
+		},
+		{
+			name:       "pod IPs cannot be looked up",
+			lookup:     fakePodIPLookup{err: fmt.Errorf("kubelet unavailable")},
+			token:      podToken,
+			remoteAddr: "10.0.0.1:41234",
+			error:      "unable to look up the IPs of pod some-namespace/some-pod: kubelet unavailable",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// setup
+			g := NewWithT(t)
+			request := &credentials.EksCredentialsRequest{
+				ServiceAccountToken: tc.token,
+				RequestTargetHost:   configuration.DefaultIpv4TargetHost,
+				RemoteAddr:          tc.remoteAddr,
+			}
+
+			// trigger
+			err := DefaultCredentialValidator{PodIPLookup: tc.lookup}.ValidateEksCredentialRequest(context.Background(), request)
+
+			// validate
+			if tc.error != "" {
+				g.Expect(err).To(MatchError(tc.error))
+				var hcpe errors.HttpCodeProvidingError
+				if tc.httpStatus != 0 {
+					g.Expect(goerrors.As(err, &hcpe)).To(BeTrue())
+					g.Expect(hcpe.HttpStatus()).To(Equal(tc.httpStatus))
+				}
+			} else {
+				g.Expect(err).To(Not(HaveOccurred()))
+			}
+		})
+	}
+}
@@ -104,3 +104,82 @@ func (mr *MockResponseMetadataMockRecorder) AssociationId() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssociationId", reflect.TypeOf((*MockResponseMetadata)(nil).AssociationId))
 }
+
+// AssumedRoleArn mocks base method.
+func (m *MockResponseMetadata) AssumedRoleArn() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssumedRoleArn")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// AssumedRoleArn indicates an expected call of AssumedRoleArn.
+func (mr *MockResponseMetadataMockRecorder) AssumedRoleArn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssumedRoleArn", reflect.TypeOf((*MockResponseMetadata)(nil).AssumedRoleArn))
+}
+
+// MockCacheResponseMetadata is a mock of CacheResponseMetadata interface.
+type MockCacheResponseMetadata struct {
+	ctrl     *gomock.Controller
+	recorder *MockCacheResponseMetadataMockRecorder
+}
+
+// MockCacheResponseMetadataMockRecorder is the mock recorder for MockCacheResponseMetadata.
+type MockCacheResponseMetadataMockRecorder struct {
+	mock *MockCacheResponseMetadata
+}
+
+// NewMockCacheResponseMetadata creates a new mock instance.
+func NewMockCacheResponseMetadata(ctrl *gomock.Controller) *MockCacheResponseMetadata {
+	mock := &MockCacheResponseMetadata{ctrl: ctrl}
+	mock.recorder = &MockCacheResponseMetadataMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCacheResponseMetadata) EXPECT() *MockCacheResponseMetadataMockRecorder {
+	return m.recorder
+}
+
+// AssociationId mocks base method.
+func (m *MockCacheResponseMetadata) AssociationId() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssociationId")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// AssociationId indicates an expected call of AssociationId.
+func (mr *MockCacheResponseMetadataMockRecorder) AssociationId() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssociationId", reflect.TypeOf((*MockCacheResponseMetadata)(nil).AssociationId))
+}
+
+// AssumedRoleArn mocks base method.
+func (m *MockCacheResponseMetadata) AssumedRoleArn() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssumedRoleArn")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// AssumedRoleArn indicates an expected call of AssumedRoleArn.
+func (mr *MockCacheResponseMetadataMockRecorder) AssumedRoleArn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssumedRoleArn", reflect.TypeOf((*MockCacheResponseMetadata)(nil).AssumedRoleArn))
+}
+
+// CacheHit mocks base method.
+func (m *MockCacheResponseMetadata) CacheHit() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CacheHit")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// CacheHit indicates an expected call of CacheHit.
+func (mr *MockCacheResponseMetadataMockRecorder) CacheHit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CacheHit", reflect.TypeOf((*MockCacheResponseMetadata)(nil).CacheHit))
+}
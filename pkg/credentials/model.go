@@ -22,12 +22,24 @@ type CredentialRetriever interface {
 // in the response
 type ResponseMetadata interface {
 	AssociationId() string
+	AssumedRoleArn() string
+}
+
+// CacheResponseMetadata is implemented by the ResponseMetadata of
+// credentials that may have been served from a cache
+type CacheResponseMetadata interface {
+	ResponseMetadata
+	// CacheHit indicates whether the credentials were served from the cache
+	CacheHit() bool
 }
 
 type EksCredentialsRequest struct {
 	ServiceAccountToken string
 	ClusterName         string
 	RequestTargetHost   string
+	// RemoteAddr is the address the request came from, as in
+	// http.Request.RemoteAddr
+	RemoteAddr string
 }
 
 type EksCredentialsResponse struct {
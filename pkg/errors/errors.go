@@ -2,13 +2,18 @@ package errors
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/eksauth/types"
 	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/sirupsen/logrus"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 )
@@ -58,7 +63,81 @@ func NewAccessDeniedError(reason string) *AccessDeniedError {
 	}
 }
 
+// Stable error codes sent in structured error responses, clients can act on
+// them programmatically so they must never change
+const (
+	ErrCodeInvalidRequest      = "InvalidRequest"
+	ErrCodeAccessDenied        = "AccessDenied"
+	ErrCodeInvalidToken        = "InvalidToken"
+	ErrCodeExpiredToken        = "ExpiredToken"
+	ErrCodeAssociationNotFound = "AssociationNotFound"
+	ErrCodeThrottled           = "Throttled"
+	ErrCodeServiceUnavailable  = "ServiceUnavailable"
+	ErrCodeServiceError        = "ServiceError"
+	ErrCodeTimeout             = "Timeout"
+	ErrCodeInternal            = "InternalError"
+)
+
+// defaultRetryAfter is how long throttled clients are asked to wait when EKS
+// Auth does not say
+const defaultRetryAfter = 1
+
+// retryableErrCodes are the error codes of requests that can succeed if sent
+// again later
+var retryableErrCodes = map[string]bool{
+	ErrCodeThrottled:          true,
+	ErrCodeServiceUnavailable: true,
+	ErrCodeServiceError:       true,
+	ErrCodeTimeout:            true,
+}
+
+// ErrorResponse describes an error fetching credentials to the client
+type ErrorResponse struct {
+	// Code is one of the stable ErrCode* agent error codes
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+	// UpstreamCode is the EKS Auth error code, if the error came from it
+	UpstreamCode string `json:"UpstreamCode,omitempty"`
+	// RequestId is the EKS Auth request id, if the error came from it
+	RequestId string `json:"RequestId,omitempty"`
+	// Retryable hints whether the same request can succeed later
+	Retryable bool `json:"Retryable"`
+	// RetryAfterSeconds is how long to wait before retrying, also sent as
+	// the Retry-After header
+	RetryAfterSeconds int `json:"RetryAfterSeconds,omitempty"`
+	// HttpStatus is the status code of the response
+	HttpStatus int `json:"-"`
+}
+
+// Write sends the error to the client, as a JSON body if structured is set or
+// as plain text otherwise
+func (r *ErrorResponse) Write(resp http.ResponseWriter, structured bool) {
+	if r.RetryAfterSeconds > 0 {
+		resp.Header().Set("Retry-After", strconv.Itoa(r.RetryAfterSeconds))
+	}
+	if !structured {
+		http.Error(resp, r.Message, r.HttpStatus)
+		return
+	}
+	body, err := json.Marshal(r)
+	if err != nil {
+		http.Error(resp, r.Message, r.HttpStatus)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.WriteHeader(r.HttpStatus)
+	_, _ = resp.Write(body)
+}
+
 func HandleCredentialFetchingError(ctx context.Context, err error) (string, int) {
+	errResp := DescribeCredentialFetchingError(ctx, err)
+	return errResp.Message, errResp.HttpStatus
+}
+
+// DescribeCredentialFetchingError builds the response sent to the client when
+// credentials could not be fetched
+func DescribeCredentialFetchingError(ctx context.Context, err error) *ErrorResponse {
 	log := logger.FromContext(ctx)
 	defer func() {
 		log.Errorf("Error fetching credentials: %v", err)
@@ -67,7 +146,11 @@ func HandleCredentialFetchingError(ctx context.Context, err error) (string, int)
 	// first try to get validation errors, if there is one short-circuit and return
 	var hcpe HttpCodeProvidingError
 	if errors.As(err, &hcpe) {
-		return err.Error(), hcpe.HttpStatus()
+		return &ErrorResponse{
+			Code:       validationErrorCode(err),
+			Message:    err.Error(),
+			HttpStatus: hcpe.HttpStatus(),
+		}
 	}
 
 	// grab some metadata about the service failure if there is any
@@ -80,7 +163,10 @@ func HandleCredentialFetchingError(ctx context.Context, err error) (string, int)
 	}
 
 	var errMsg []string
-	httpCode := http.StatusInternalServerError
+	errResp := &ErrorResponse{
+		Code:       ErrCodeInternal,
+		HttpStatus: http.StatusInternalServerError,
+	}
 
 	var re *awshttp.ResponseError
 	if errors.As(err, &re) {
@@ -89,19 +175,98 @@ func HandleCredentialFetchingError(ctx context.Context, err error) (string, int)
 		})
 		// response error does not necessarily imply that there was an HTTP code response
 		if re.HTTPStatusCode() != 0 {
-			httpCode = re.HTTPStatusCode()
+			errResp.HttpStatus = re.HTTPStatusCode()
 		}
+		errResp.RequestId = re.RequestID
 		errMsg = append(errMsg, "["+re.RequestID+"]")
 	}
 
 	var ae smithy.APIError
-	if errors.As(err, &ae) {
+	switch {
+	case errors.As(err, &ae):
 		errMsg = append(errMsg, fmt.Sprintf("(%s): %s, fault: %s", ae.ErrorCode(), ae.ErrorMessage(), ae.ErrorFault().String()))
+		errResp.UpstreamCode = ae.ErrorCode()
+		errResp.Code, errResp.HttpStatus = classifyApiError(ae, errResp.HttpStatus)
+	case errResp.HttpStatus == http.StatusTooManyRequests:
+		errResp.Code = ErrCodeThrottled
+	case isTimeout(err):
+		errResp.Code, errResp.HttpStatus = ErrCodeTimeout, http.StatusGatewayTimeout
+	case isUnreachable(err):
+		errResp.Code, errResp.HttpStatus = ErrCodeServiceUnavailable, http.StatusServiceUnavailable
+	}
+	errResp.Retryable = retryableErrCodes[errResp.Code]
+	if errResp.Code == ErrCodeThrottled || errResp.Code == ErrCodeServiceUnavailable {
+		errResp.RetryAfterSeconds = retryAfterSeconds(re)
 	}
 
 	if len(errMsg) == 0 {
-		return err.Error(), httpCode
+		errResp.Message = err.Error()
 	} else {
-		return strings.Join(errMsg, ": "), httpCode
+		errResp.Message = strings.Join(errMsg, ": ")
+	}
+	return errResp
+}
+
+func validationErrorCode(err error) string {
+	var ade *AccessDeniedError
+	if errors.As(err, &ade) {
+		return ErrCodeAccessDenied
+	}
+	return ErrCodeInvalidRequest
+}
+
+// classifyApiError maps EKS Auth exceptions to agent error codes and the
+// status sent to the client, fallbackStatus is used for unknown client faults
+func classifyApiError(ae smithy.APIError, fallbackStatus int) (string, int) {
+	switch ae.(type) {
+	case *types.InvalidTokenException:
+		return ErrCodeInvalidToken, http.StatusUnauthorized
+	case *types.ExpiredTokenException:
+		return ErrCodeExpiredToken, http.StatusUnauthorized
+	case *types.AccessDeniedException:
+		return ErrCodeAccessDenied, http.StatusForbidden
+	case *types.ResourceNotFoundException:
+		return ErrCodeAssociationNotFound, http.StatusNotFound
+	case *types.InvalidParameterException, *types.InvalidRequestException:
+		return ErrCodeInvalidRequest, http.StatusBadRequest
+	case *types.ThrottlingException:
+		return ErrCodeThrottled, http.StatusTooManyRequests
+	case *types.ServiceUnavailableException:
+		return ErrCodeServiceUnavailable, http.StatusServiceUnavailable
+	case *types.InternalServerException:
+		return ErrCodeServiceError, http.StatusBadGateway
+	}
+	if fallbackStatus == http.StatusTooManyRequests {
+		return ErrCodeThrottled, http.StatusTooManyRequests
+	}
+	if ae.ErrorFault() == smithy.FaultServer || fallbackStatus >= http.StatusInternalServerError {
+		return ErrCodeServiceError, http.StatusBadGateway
+	}
+	return ErrCodeInvalidRequest, fallbackStatus
+}
+
+// isTimeout checks if the call to EKS Auth did not complete in time
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// isUnreachable checks if the request could not be sent to EKS Auth
+func isUnreachable(err error) bool {
+	var sendErr *smithyhttp.RequestSendError
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &sendErr) || errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+// retryAfterSeconds returns the Retry-After sent by EKS Auth, if any, or
+// defaultRetryAfter
+func retryAfterSeconds(re *awshttp.ResponseError) int {
+	if re == nil || re.Response == nil || re.Response.Response == nil {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(re.Response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return seconds
 	}
+	return defaultRetryAfter
 }
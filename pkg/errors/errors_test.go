@@ -3,7 +3,10 @@ package errors
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -32,7 +35,7 @@ func Test_HandleCredentialFetchingError(t *testing.T) {
 			expectedHttpCode: 500,
 		},
 		{
-			name: "operational with response, no reply",
+			name: "operational with response, request could not be sent",
 			inputError: &smithy.OperationError{
 				ServiceID:     "Some Service",
 				OperationName: "SomeOperation",
@@ -48,10 +51,10 @@ func Test_HandleCredentialFetchingError(t *testing.T) {
 					},
 				},
 			},
-			expectedHttpCode: 500,
+			expectedHttpCode: 503,
 		},
 		{
-			name: "error from server, returns valid code",
+			name: "error from server, returns precise code",
 			inputError: &smithy.OperationError{
 				ServiceID:     "Some Service",
 				OperationName: "SomeOperation",
@@ -67,7 +70,7 @@ func Test_HandleCredentialFetchingError(t *testing.T) {
 					},
 				},
 			},
-			expectedHttpCode: 400,
+			expectedHttpCode: 401,
 		},
 		{
 			name:             "validation error",
@@ -90,3 +93,304 @@ func Test_HandleCredentialFetchingError(t *testing.T) {
 		})
 	}
 }
+
+func Test_DescribeCredentialFetchingError(t *testing.T) {
+	throttledResponse := &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}}
+	throttledResponse.Header.Set("Retry-After", "5")
+
+	testCases := []struct {
+		name             string
+		inputError       error
+		expectedResponse ErrorResponse
+	}{
+		{
+			name:       "validation error",
+			inputError: NewRequestValidationError("some-invalid-request"),
+			expectedResponse: ErrorResponse{
+				Code:       ErrCodeInvalidRequest,
+				Message:    "some-invalid-request",
+				HttpStatus: http.StatusBadRequest,
+			},
+		},
+		{
+			name:       "access denied error",
+			inputError: fmt.Errorf("wrapping error: %w", NewAccessDeniedError("some-reason")),
+			expectedResponse: ErrorResponse{
+				Code:       ErrCodeAccessDenied,
+				Message:    "wrapping error: Access Denied. some-reason",
+				HttpStatus: http.StatusForbidden,
+			},
+		},
+		{
+			name: "upstream error",
+			inputError: &awshttp.ResponseError{
+				RequestID: "some-request-id",
+				ResponseError: &http2.ResponseError{
+					Response: &http2.Response{Response: &http.Response{StatusCode: 400}},
+					Err:      &types.ResourceNotFoundException{Message: aws.String("some-msg")},
+				},
+			},
+			expectedResponse: ErrorResponse{
+				Code:         ErrCodeAssociationNotFound,
+				Message:      "[some-request-id]: (ResourceNotFoundException): some-msg, fault: client",
+				UpstreamCode: "ResourceNotFoundException",
+				RequestId:    "some-request-id",
+				HttpStatus:   http.StatusNotFound,
+			},
+		},
+		{
+			name: "throttled upstream",
+			inputError: &awshttp.ResponseError{
+				RequestID: "some-request-id",
+				ResponseError: &http2.ResponseError{
+					Response: &http2.Response{Response: throttledResponse},
+					Err:      &types.ThrottlingException{Message: aws.String("slow down")},
+				},
+			},
+			expectedResponse: ErrorResponse{
+				Code:              ErrCodeThrottled,
+				Message:           "[some-request-id]: (ThrottlingException): slow down, fault: client",
+				UpstreamCode:      "ThrottlingException",
+				RequestId:         "some-request-id",
+				Retryable:         true,
+				RetryAfterSeconds: 5,
+				HttpStatus:        http.StatusTooManyRequests,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			errResp := DescribeCredentialFetchingError(context.Background(), tc.inputError)
+
+			// validate
+			g.Expect(*errResp).To(Equal(tc.expectedResponse))
+		})
+	}
+}
+
+func Test_DescribeCredentialFetchingError_Statuses(t *testing.T) {
+	upstreamError := func(statusCode int, err error) error {
+		return &smithy.OperationError{
+			ServiceID:     "EKS Auth",
+			OperationName: "AssumeRoleForPodIdentity",
+			Err: &awshttp.ResponseError{
+				RequestID: "some-request-id",
+				ResponseError: &http2.ResponseError{
+					Response: &http2.Response{Response: &http.Response{StatusCode: statusCode}},
+					Err:      err,
+				},
+			},
+		}
+	}
+	sendError := func(err error) error {
+		return &smithy.OperationError{
+			ServiceID:     "EKS Auth",
+			OperationName: "AssumeRoleForPodIdentity",
+			Err:           &http2.RequestSendError{Err: err},
+		}
+	}
+
+	testCases := []struct {
+		name              string
+		inputError        error
+		expectedCode      string
+		expectedHttpCode  int
+		expectedRetryable bool
+		expectedRetry     int
+	}{
+		{
+			name:             "access denied exception",
+			inputError:       upstreamError(400, &types.AccessDeniedException{}),
+			expectedCode:     ErrCodeAccessDenied,
+			expectedHttpCode: http.StatusForbidden,
+		},
+		{
+			name:             "expired token exception",
+			inputError:       upstreamError(400, &types.ExpiredTokenException{}),
+			expectedCode:     ErrCodeExpiredToken,
+			expectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			name:              "internal server exception",
+			inputError:        upstreamError(500, &types.InternalServerException{}),
+			expectedCode:      ErrCodeServiceError,
+			expectedHttpCode:  http.StatusBadGateway,
+			expectedRetryable: true,
+		},
+		{
+			name:             "invalid parameter exception",
+			inputError:       upstreamError(400, &types.InvalidParameterException{}),
+			expectedCode:     ErrCodeInvalidRequest,
+			expectedHttpCode: http.StatusBadRequest,
+		},
+		{
+			name:             "invalid request exception",
+			inputError:       upstreamError(400, &types.InvalidRequestException{}),
+			expectedCode:     ErrCodeInvalidRequest,
+			expectedHttpCode: http.StatusBadRequest,
+		},
+		{
+			name:             "invalid token exception",
+			inputError:       upstreamError(400, &types.InvalidTokenException{}),
+			expectedCode:     ErrCodeInvalidToken,
+			expectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			name:             "resource not found exception",
+			inputError:       upstreamError(400, &types.ResourceNotFoundException{}),
+			expectedCode:     ErrCodeAssociationNotFound,
+			expectedHttpCode: http.StatusNotFound,
+		},
+		{
+			name:              "service unavailable exception",
+			inputError:        upstreamError(503, &types.ServiceUnavailableException{}),
+			expectedCode:      ErrCodeServiceUnavailable,
+			expectedHttpCode:  http.StatusServiceUnavailable,
+			expectedRetryable: true,
+			expectedRetry:     1,
+		},
+		{
+			name:              "throttling exception",
+			inputError:        upstreamError(400, &types.ThrottlingException{}),
+			expectedCode:      ErrCodeThrottled,
+			expectedHttpCode:  http.StatusTooManyRequests,
+			expectedRetryable: true,
+			expectedRetry:     1,
+		},
+		{
+			name:              "unmodeled too many requests response",
+			inputError:        upstreamError(429, fmt.Errorf("some-error")),
+			expectedCode:      ErrCodeThrottled,
+			expectedHttpCode:  http.StatusTooManyRequests,
+			expectedRetryable: true,
+			expectedRetry:     1,
+		},
+		{
+			name: "unknown server fault",
+			inputError: upstreamError(500, &smithy.GenericAPIError{
+				Code:  "SomeException",
+				Fault: smithy.FaultServer,
+			}),
+			expectedCode:      ErrCodeServiceError,
+			expectedHttpCode:  http.StatusBadGateway,
+			expectedRetryable: true,
+		},
+		{
+			name: "unknown client fault",
+			inputError: upstreamError(409, &smithy.GenericAPIError{
+				Code:  "SomeException",
+				Fault: smithy.FaultClient,
+			}),
+			expectedCode:     ErrCodeInvalidRequest,
+			expectedHttpCode: http.StatusConflict,
+		},
+		{
+			name:              "context deadline exceeded",
+			inputError:        sendError(context.DeadlineExceeded),
+			expectedCode:      ErrCodeTimeout,
+			expectedHttpCode:  http.StatusGatewayTimeout,
+			expectedRetryable: true,
+		},
+		{
+			name:              "network timeout",
+			inputError:        sendError(&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}),
+			expectedCode:      ErrCodeTimeout,
+			expectedHttpCode:  http.StatusGatewayTimeout,
+			expectedRetryable: true,
+		},
+		{
+			name:              "dial failure",
+			inputError:        &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")},
+			expectedCode:      ErrCodeServiceUnavailable,
+			expectedHttpCode:  http.StatusServiceUnavailable,
+			expectedRetryable: true,
+			expectedRetry:     1,
+		},
+		{
+			name:              "dns failure",
+			inputError:        fmt.Errorf("wrapped: %w", &net.DNSError{Err: "no such host", Name: "eks-auth"}),
+			expectedCode:      ErrCodeServiceUnavailable,
+			expectedHttpCode:  http.StatusServiceUnavailable,
+			expectedRetryable: true,
+			expectedRetry:     1,
+		},
+		{
+			name:             "internal bug",
+			inputError:       fmt.Errorf("request to fetch credentials is empty, this is most likely a bug"),
+			expectedCode:     ErrCodeInternal,
+			expectedHttpCode: http.StatusInternalServerError,
+		},
+		{
+			name:             "invalid request",
+			inputError:       NewRequestValidationError("Service account token cannot be empty"),
+			expectedCode:     ErrCodeInvalidRequest,
+			expectedHttpCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			errResp := DescribeCredentialFetchingError(context.Background(), tc.inputError)
+
+			// validate
+			g.Expect(errResp.Code).To(Equal(tc.expectedCode))
+			g.Expect(errResp.HttpStatus).To(Equal(tc.expectedHttpCode))
+			g.Expect(errResp.Retryable).To(Equal(tc.expectedRetryable))
+			g.Expect(errResp.RetryAfterSeconds).To(Equal(tc.expectedRetry))
+		})
+	}
+}
+
+func TestErrorResponse_Write(t *testing.T) {
+	errResp := &ErrorResponse{
+		Code:              ErrCodeThrottled,
+		Message:           "some-msg",
+		UpstreamCode:      "ThrottlingException",
+		Retryable:         true,
+		RetryAfterSeconds: 2,
+		HttpStatus:        http.StatusTooManyRequests,
+	}
+
+	testCases := []struct {
+		name                string
+		structured          bool
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "plain text",
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "some-msg\n",
+		},
+		{
+			name:                "structured",
+			structured:          true,
+			expectedContentType: "application/json",
+			expectedBody: `{"Code":"Throttled","Message":"some-msg","UpstreamCode":"ThrottlingException",` +
+				`"Retryable":true,"RetryAfterSeconds":2}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			recorder := httptest.NewRecorder()
+
+			// trigger
+			errResp.Write(recorder, tc.structured)
+
+			// validate
+			g.Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			g.Expect(recorder.Header().Get("Content-Type")).To(Equal(tc.expectedContentType))
+			g.Expect(recorder.Header().Get("Retry-After")).To(Equal("2"))
+			g.Expect(recorder.Body.String()).To(Equal(tc.expectedBody))
+		})
+	}
+}
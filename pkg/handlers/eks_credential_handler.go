@@ -3,15 +3,19 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/audit"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/cloud/eksauth"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/credsretriever"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/validation"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
@@ -28,6 +32,11 @@ type EksCredentialHandler struct {
 	RequestValidator validation.RequestValidator
 	// CredentialRetriever will call EksAuthService to retrieve credentials
 	CredentialRetriever credentials.CredentialRetriever
+	// StructuredErrors sends errors as JSON bodies even to clients that do
+	// not accept application/json
+	StructuredErrors bool
+	// AuditLogger if set records every credential issued by the handler
+	AuditLogger audit.Logger
 }
 
 type EksCredentialHandlerOpts struct {
@@ -36,6 +45,59 @@ type EksCredentialHandlerOpts struct {
 	CredentialRenewal time.Duration
 	MaxCacheSize      int
 	RefreshQPS        int
+	MinRefreshQPS     float64
+	RefreshFraction   float64
+	IdleEviction      time.Duration
+	PodLister         k8s.PodLister
+	RefreshTuning     credsretriever.RefreshTuning
+	// TargetHosts are the addresses requests must be sent to, see
+	// validation.DefaultCredentialValidator
+	TargetHosts []string
+	// TokenAudience, TokenIssuers and ValidateTokenSubject configure the
+	// claim checks done on service account tokens, see
+	// validation.DefaultCredentialValidator
+	TokenAudience        string
+	TokenIssuers         []string
+	ValidateTokenSubject bool
+	// TokenKeySet if set is used to verify service account token signatures
+	TokenKeySet validation.KeySet
+	// AccessPolicy if set restricts which service accounts can fetch
+	// credentials
+	AccessPolicy validation.AccessPolicy
+	// PodIPLookup if set is used to check that requests come from the pod
+	// the service account token was issued to
+	PodIPLookup k8s.PodIPLookup
+	// StructuredErrors see EksCredentialHandler.StructuredErrors
+	StructuredErrors bool
+	// AuditLogger see EksCredentialHandler.AuditLogger
+	AuditLogger audit.Logger
+}
+
+// Validate checks that the credentials cache configuration is consistent, it
+// is a no-op when caching is disabled
+func (opts EksCredentialHandlerOpts) Validate() error {
+	if !opts.cachingEnabled() {
+		return nil
+	}
+	return opts.cachedRetrieverOpts(nil).Validate()
+}
+
+func (opts EksCredentialHandlerOpts) cachingEnabled() bool {
+	return opts.CredentialRenewal != 0 && opts.MaxCacheSize != 0
+}
+
+func (opts EksCredentialHandlerOpts) cachedRetrieverOpts(delegate credentials.CredentialRetriever) credsretriever.CachedCredentialRetrieverOpts {
+	return credsretriever.CachedCredentialRetrieverOpts{
+		Delegate:              delegate,
+		CredentialsRenewalTtl: opts.CredentialRenewal,
+		MaxCacheSize:          opts.MaxCacheSize,
+		RefreshQPS:            opts.RefreshQPS,
+		MinRefreshQPS:         opts.MinRefreshQPS,
+		RefreshFraction:       opts.RefreshFraction,
+		IdleEvictionTimeout:   opts.IdleEviction,
+		PodLister:             opts.PodLister,
+		RefreshTuning:         opts.RefreshTuning,
+	}
 }
 
 var (
@@ -45,22 +107,40 @@ var (
 	}, []string{"code"})
 )
 
-func NewEksCredentialHandler(opts EksCredentialHandlerOpts) *EksCredentialHandler {
+func NewEksCredentialHandler(opts EksCredentialHandlerOpts) (*EksCredentialHandler, error) {
 	credentialsRetriever := eksauth.NewService(opts.Cfg)
-	if opts.CredentialRenewal != 0 && opts.MaxCacheSize != 0 {
-		credentialsRetriever = credsretriever.NewCachedCredentialRetriever(credsretriever.CachedCredentialRetrieverOpts{
-			Delegate:              credentialsRetriever,
-			CredentialsRenewalTtl: opts.CredentialRenewal,
-			MaxCacheSize:          opts.MaxCacheSize,
-			RefreshQPS:            opts.RefreshQPS,
-		})
+	if opts.cachingEnabled() {
+		var err error
+		credentialsRetriever, err = credsretriever.NewCachedCredentialRetriever(opts.cachedRetrieverOpts(credentialsRetriever))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &EksCredentialHandler{
-		RequestValidator:    validation.DefaultCredentialValidator{},
+		RequestValidator: validation.DefaultCredentialValidator{
+			TargetHosts:     opts.TargetHosts,
+			Audience:        opts.TokenAudience,
+			Issuers:         opts.TokenIssuers,
+			ValidateSubject: opts.ValidateTokenSubject,
+			KeySet:          opts.TokenKeySet,
+			Policy:          opts.AccessPolicy,
+			PodIPLookup:     opts.PodIPLookup,
+		},
 		ClusterName:         opts.ClusterName,
 		CredentialRetriever: credentialsRetriever,
+		StructuredErrors:    opts.StructuredErrors,
+		AuditLogger:         opts.AuditLogger,
+	}, nil
+}
+
+// Close stops the background work of the CredentialRetriever, eg. renewing
+// cached credentials, it does nothing if there is none
+func (h *EksCredentialHandler) Close() error {
+	if closer, ok := h.CredentialRetriever.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
 }
 
 func (h *EksCredentialHandler) ConfigureHandler(register func(pattern string, handlerFunc http.HandlerFunc)) {
@@ -71,21 +151,25 @@ func (h *EksCredentialHandler) HandleRequest(resp http.ResponseWriter, req *http
 	ctx := logger.ContextWithField(req.Context(), "cluster-name", h.ClusterName)
 	log := logger.FromContext(ctx)
 
-	log.Infof("handling new request request from %s", req.RemoteAddr)
+	// the address is a field so the message is the same for every request
+	// and can be sampled
+	log.WithField("remote-addr", req.RemoteAddr).Info("handling new request")
 
 	eksCredentialsRequest := &credentials.EksCredentialsRequest{
 		ClusterName:         h.ClusterName,
 		ServiceAccountToken: req.Header.Get("Authorization"),
 		RequestTargetHost:   req.Host,
+		RemoteAddr:          req.RemoteAddr,
 	}
 
-	creds, err := h.GetEksCredentials(ctx, eksCredentialsRequest)
+	creds, metadata, err := h.getEksCredentials(ctx, eksCredentialsRequest)
 	if err != nil {
-		msg, code := errors.HandleCredentialFetchingError(ctx, err)
-		promHttpStatus.WithLabelValues(strconv.Itoa(code)).Inc()
-		http.Error(resp, msg, code)
+		errResp := errors.DescribeCredentialFetchingError(ctx, err)
+		promHttpStatus.WithLabelValues(strconv.Itoa(errResp.HttpStatus)).Inc()
+		errResp.Write(resp, h.StructuredErrors || acceptsJson(req))
 		return
 	}
+	h.audit(ctx, eksCredentialsRequest, creds, metadata)
 
 	jsonOutput, err := json.Marshal(creds)
 	if err != nil {
@@ -103,13 +187,62 @@ func (h *EksCredentialHandler) HandleRequest(resp http.ResponseWriter, req *http
 	}
 }
 
+// acceptsJson checks if the client explicitly accepts JSON responses
+func acceptsJson(req *http.Request) bool {
+	for _, accept := range req.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+			if strings.TrimSpace(mediaType) == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (h *EksCredentialHandler) GetEksCredentials(ctx context.Context, request *credentials.EksCredentialsRequest) (*credentials.EksCredentialsResponse, error) {
+	iamCredentials, _, err := h.getEksCredentials(ctx, request)
+	return iamCredentials, err
+}
+
+func (h *EksCredentialHandler) getEksCredentials(ctx context.Context, request *credentials.EksCredentialsRequest) (*credentials.EksCredentialsResponse, credentials.ResponseMetadata, error) {
 	// validate request
 	err := h.RequestValidator.ValidateEksCredentialRequest(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// call EKS Auth
-	iamCredentials, _, err := h.CredentialRetriever.GetIamCredentials(ctx, request)
-	return iamCredentials, err
+	return h.CredentialRetriever.GetIamCredentials(ctx, request)
+}
+
+// audit records the issued credentials in the audit log, if enabled. The
+// request has been validated so the token claims are only parsed to
+// identify the pod.
+func (h *EksCredentialHandler) audit(ctx context.Context, request *credentials.EksCredentialsRequest,
+	creds *credentials.EksCredentialsResponse, metadata credentials.ResponseMetadata) {
+	if h.AuditLogger == nil {
+		return
+	}
+	record := audit.Record{
+		Time:              time.Now(),
+		AccountId:         creds.AccountId,
+		AccessKeyIdSuffix: audit.AccessKeyIdSuffix(creds.AccessKeyId),
+		ClientAddr:        request.RemoteAddr,
+	}
+	if claims, err := k8s.ParseServiceAccountToken(request.ServiceAccountToken); err == nil {
+		record.Namespace = claims.Kubernetes.Namespace
+		record.ServiceAccount = claims.Kubernetes.ServiceAccount.Name
+		record.PodName = claims.Kubernetes.Pod.Name
+		record.PodUID = claims.Kubernetes.Pod.UID
+	}
+	if metadata != nil {
+		record.AssociationId = metadata.AssociationId()
+		record.RoleArn = metadata.AssumedRoleArn()
+	}
+	if cacheMetadata, ok := metadata.(credentials.CacheResponseMetadata); ok {
+		record.CacheHit = cacheMetadata.CacheHit()
+	}
+	if err := h.AuditLogger.Log(record); err != nil {
+		logger.FromContext(ctx).Errorf("Unable to write audit record: %v", err)
+	}
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/test"
@@ -9,12 +10,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	. "github.com/onsi/gomega"
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/audit"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/cloud/eksauth"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/k8s"
 	_ "go.amzn.com/eks/eks-pod-identity-agent/internal/test"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/validation"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/credentials/mockcreds"
 	"go.uber.org/mock/gomock"
 )
 
@@ -63,6 +68,7 @@ func TestEksCredentialHandler_GetIamCredentialsHandler(t *testing.T) {
 		clusterName     string
 		token           string
 		targetHost      string
+		accept          string
 		eksAuthResponse *credentials.EksCredentialsResponse
 	}{
 		{
@@ -80,6 +86,13 @@ func TestEksCredentialHandler_GetIamCredentialsHandler(t *testing.T) {
 			targetHost:  validTargetHost,
 			clusterName: someValidClusterName,
 		},
+		{
+			name:        "structured error when client accepts json",
+			sentBytes:   []byte(`{"Code":"InvalidRequest","Message":"Service account token cannot be empty","Retryable":false}`),
+			targetHost:  validTargetHost,
+			clusterName: someValidClusterName,
+			accept:      "text/plain;q=0.5, application/json",
+		},
 		{
 			name:            "Fetch credentials successfully",
 			sentBytes:       marshalledCreds,
@@ -104,6 +117,9 @@ func TestEksCredentialHandler_GetIamCredentialsHandler(t *testing.T) {
 				ClusterName:         tc.clusterName,
 			}
 			request := buildRequest(tc.token, tc.targetHost)
+			if tc.accept != "" {
+				request.Header.Set("Accept", tc.accept)
+			}
 			if tc.eksAuthResponse != nil {
 				eksAuthService.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).
 					Return(tc.eksAuthResponse, nil, nil)
@@ -116,6 +132,111 @@ func TestEksCredentialHandler_GetIamCredentialsHandler(t *testing.T) {
 	}
 }
 
+func TestEksCredentialHandler_HandleRequest_Audit(t *testing.T) {
+	testCases := []struct {
+		name           string
+		cacheHit       bool
+		eksAuthError   error
+		expectedRecord string
+	}{
+		{
+			name:     "records issued credentials",
+			cacheHit: true,
+			expectedRecord: `"namespace":"ns","serviceAccount":"sa","podName":"pod","podUid":"pod-uid",` +
+				`"associationId":"a-123","roleArn":"arn:aws:sts::123456789012:assumed-role/role/session",` +
+				`"accountId":"123456789012","accessKeyIdSuffix":"WXYZ","cacheHit":true,"clientAddr":"localhost"}`,
+		},
+		{
+			name:         "failures are not recorded",
+			eksAuthError: fmt.Errorf("some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controller := gomock.NewController(t)
+			defer controller.Finish()
+
+			// setup
+			token := test.CreateTokenWithClaimsForTest(k8s.ServiceAccountClaims{
+				RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+				Kubernetes: k8s.KubernetesClaims{
+					Namespace:      "ns",
+					Pod:            k8s.ObjectClaim{Name: "pod", UID: "pod-uid"},
+					ServiceAccount: k8s.ObjectClaim{Name: "sa"},
+				},
+			})
+			creds := &credentials.EksCredentialsResponse{
+				AccessKeyId:     "ASIAABCDEFGHWXYZ",
+				SecretAccessKey: "secret-access-key",
+				Token:           "session-token",
+				AccountId:       "123456789012",
+				Expiration:      credentials.SdkCompliantExpirationTime{Time: time.Now().Add(time.Hour)},
+			}
+			metadata := mockcreds.NewMockCacheResponseMetadata(controller)
+			metadata.EXPECT().AssociationId().Return("a-123").AnyTimes()
+			metadata.EXPECT().AssumedRoleArn().Return("arn:aws:sts::123456789012:assumed-role/role/session").AnyTimes()
+			metadata.EXPECT().CacheHit().Return(tc.cacheHit).AnyTimes()
+			retriever := mockcreds.NewMockCredentialRetriever(controller)
+			if tc.eksAuthError != nil {
+				retriever.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).Return(nil, nil, tc.eksAuthError)
+			} else {
+				retriever.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).Return(creds, metadata, nil)
+			}
+			auditLog := &bytes.Buffer{}
+			handler := EksCredentialHandler{
+				CredentialRetriever: retriever,
+				RequestValidator:    validation.DefaultCredentialValidator{},
+				AuditLogger:         audit.NewLogger(auditLog),
+			}
+
+			// trigger
+			handler.HandleRequest(&mockResponseWriter{g: g}, buildRequest(token, configuration.DefaultIpv4TargetHost))
+
+			// validate
+			if tc.expectedRecord == "" {
+				g.Expect(auditLog.String()).To(BeEmpty())
+				return
+			}
+			g.Expect(auditLog.String()).To(ContainSubstring(tc.expectedRecord))
+			g.Expect(auditLog.String()).ToNot(ContainSubstring(creds.SecretAccessKey))
+			g.Expect(auditLog.String()).ToNot(ContainSubstring(creds.Token))
+			g.Expect(auditLog.String()).ToNot(ContainSubstring(token))
+		})
+	}
+}
+
+func TestEksCredentialHandler_HandleRequest_DoesNotLogSecrets(t *testing.T) {
+	g := NewWithT(t)
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setup
+	logs := test.CaptureLogsForTest(t)
+	token := test.CreateTokenForTest(time.Now().Add(time.Hour), time.Now(), time.Now())
+	retriever := mockcreds.NewMockCredentialRetriever(controller)
+	retriever.EXPECT().GetIamCredentials(gomock.Any(), gomock.Any()).Return(nil, nil,
+		fmt.Errorf("invalid response from server for %s: %+v", token, credentials.EksCredentialsResponse{
+			SecretAccessKey: test.SecretAccessKeyForTest,
+			Token:           test.SessionTokenForTest,
+		}))
+	handler := EksCredentialHandler{
+		CredentialRetriever: retriever,
+		RequestValidator:    validation.DefaultCredentialValidator{},
+	}
+
+	// trigger
+	handler.HandleRequest(&mockResponseWriter{g: g}, buildRequest(token, configuration.DefaultIpv4TargetHost))
+
+	// validate
+	g.Expect(logs.String()).To(ContainSubstring("Error fetching credentials"))
+	g.Expect(logs.String()).ToNot(ContainSubstring(token))
+	g.Expect(logs.String()).ToNot(ContainSubstring(test.SecretAccessKeyForTest))
+	g.Expect(logs.String()).ToNot(ContainSubstring(test.SessionTokenForTest[:40]))
+}
+
 func buildRequest(token string, targetHost string) *http.Request {
 	baseURL := fmt.Sprintf("http://%s/api", targetHost)
 	parsedUrl, err := url.Parse(baseURL)
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+)
+
+const (
+	defaultLogLevelDuration = 15 * time.Minute
+	maxLogLevelDuration     = 24 * time.Hour
+)
+
+// LogLevelHandler changes the logging level at runtime, eg. to debug an
+// issue on a single node:
+//
+//	curl -X PUT 'localhost:2706/log-level?level=debug&duration=10m'
+//
+// The level reverts to the configured one once the duration passes or on
+// DELETE. Only local callers are served.
+type LogLevelHandler struct{}
+
+func NewLogLevelHandler() *LogLevelHandler {
+	return &LogLevelHandler{}
+}
+
+func (h *LogLevelHandler) ConfigureHandler(register func(pattern string, handlerFunc http.HandlerFunc)) {
+	register("/log-level", h.HandleLogLevel)
+}
+
+func (h *LogLevelHandler) HandleLogLevel(resp http.ResponseWriter, req *http.Request) {
+	if !isLoopback(req.RemoteAddr) {
+		http.Error(resp, "Log level can only be changed from the node", http.StatusForbidden)
+		return
+	}
+
+	var status logger.LevelStatus
+	switch req.Method {
+	case http.MethodGet:
+		status = logger.CurrentLevel()
+	case http.MethodPut, http.MethodPost:
+		level, duration, err := parseLogLevelRequest(req)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status = logger.OverrideLevel(level, duration)
+	case http.MethodDelete:
+		status = logger.ResetLevel()
+	default:
+		resp.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonOutput, err := json.Marshal(status)
+	if err != nil {
+		http.Error(resp, "Unable to serialize log level", http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	_, _ = resp.Write(jsonOutput)
+}
+
+// parseLogLevelRequest reads the level and duration query parameters
+func parseLogLevelRequest(req *http.Request) (logrus.Level, time.Duration, error) {
+	query := req.URL.Query()
+	level, err := logrus.ParseLevel(query.Get("level"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid level: %v", err)
+	}
+	duration := defaultLogLevelDuration
+	if rawDuration := query.Get("duration"); rawDuration != "" {
+		duration, err = time.ParseDuration(rawDuration)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid duration: %v", err)
+		}
+	}
+	if duration <= 0 || duration > maxLogLevelDuration {
+		return 0, 0, fmt.Errorf("duration must be within (0, %v], got %v", maxLogLevelDuration, duration)
+	}
+	return level, duration, nil
+}
+
+// isLoopback checks if remoteAddr is a loopback address
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
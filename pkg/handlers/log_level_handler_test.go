@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+)
+
+func TestLogLevelHandler_HandleLogLevel(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		remoteAddr     string
+		expectedStatus int
+		expectedBody   string
+		expectedLevel  string
+	}{
+		{
+			name:           "get the level",
+			method:         http.MethodGet,
+			url:            "/log-level",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"level":"info","configuredLevel":"info"}`,
+			expectedLevel:  "info",
+		},
+		{
+			name:           "change the level temporarily",
+			method:         http.MethodPut,
+			url:            "/log-level?level=debug&duration=10m",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"level":"debug","configuredLevel":"info","revertAt":`,
+			expectedLevel:  "debug",
+		},
+		{
+			name:           "restore the level",
+			method:         http.MethodDelete,
+			url:            "/log-level",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"level":"info","configuredLevel":"info"}`,
+			expectedLevel:  "info",
+		},
+		{
+			name:           "invalid level",
+			method:         http.MethodPut,
+			url:            "/log-level?level=loud",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `invalid level: not a valid logrus Level: "loud"`,
+			expectedLevel:  "info",
+		},
+		{
+			name:           "duration too long",
+			method:         http.MethodPut,
+			url:            "/log-level?level=debug&duration=48h",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "duration must be within (0, 24h0m0s], got 48h0m0s",
+			expectedLevel:  "info",
+		},
+		{
+			name:           "remote caller",
+			method:         http.MethodPut,
+			url:            "/log-level?level=debug",
+			remoteAddr:     "10.0.0.1:1234",
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Log level can only be changed from the node",
+			expectedLevel:  "info",
+		},
+		{
+			name:           "unsupported method",
+			method:         http.MethodPatch,
+			url:            "/log-level",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedLevel:  "info",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			logger.Initialize("info")
+			if tc.method == http.MethodDelete {
+				logger.OverrideLevel(logrus.DebugLevel, time.Hour)
+			}
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+			request.RemoteAddr = "127.0.0.1:1234"
+			if tc.remoteAddr != "" {
+				request.RemoteAddr = tc.remoteAddr
+			}
+			recorder := httptest.NewRecorder()
+
+			// trigger
+			NewLogLevelHandler().HandleLogLevel(recorder, request)
+
+			// validate
+			g.Expect(recorder.Code).To(Equal(tc.expectedStatus))
+			g.Expect(recorder.Body.String()).To(ContainSubstring(tc.expectedBody))
+			g.Expect(logger.CurrentLevel().Level).To(Equal(tc.expectedLevel))
+			logger.ResetLevel()
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -12,44 +13,92 @@ import (
 
 const defaultProbeTimeout = 10 * time.Second
 
+// errNotReady wraps the errors of readiness checks, which are sent in the
+// probe response
+var errNotReady = errors.New("not ready")
+
 type ProbeHandler interface {
 	ConfigureHandler(register func(pattern string, handlerFunc http.HandlerFunc))
 	HandleProbe(resp http.ResponseWriter, request *http.Request)
 }
 
+// A ReadinessCheck returns an error while the agent is not ready to serve
+// requests, for reasons other than its servers not responding
+type ReadinessCheck func(ctx context.Context) error
+
 type probeHandler struct {
-	addrs        []string
-	client       http.Client
-	probeTimeout time.Duration
+	addrs           []string
+	client          http.Client
+	probeTimeout    time.Duration
+	readinessChecks []ReadinessCheck
 }
 
-func NewProbeHandler(hostToProbe []string, port uint16) ProbeHandler {
-	addrs := make([]string, len(hostToProbe))
-	for i, host := range hostToProbe {
-		addrs[i] = fmt.Sprintf("%s:%d", host, port)
+// ProbeTarget describes where the agent answers
+type ProbeTarget struct {
+	// Hosts and Port the agent listens on
+	Hosts []string
+	Port  uint16
+	// Mark, if not 0, is set on the probe connections so they pass the
+	// nftables rules guarding the agent
+	Mark uint32
+}
+
+// NewProbeHandler creates a ProbeHandler that checks the agent answers on
+// every host of target, /readyz additionally runs the readinessChecks
+func NewProbeHandler(target ProbeTarget, readinessChecks ...ReadinessCheck) ProbeHandler {
+	addrs := make([]string, len(target.Hosts))
+	for i, host := range target.Hosts {
+		addrs[i] = fmt.Sprintf("%s:%d", host, target.Port)
+	}
+	handler := &probeHandler{
+		addrs:           addrs,
+		probeTimeout:    defaultProbeTimeout,
+		readinessChecks: readinessChecks,
 	}
-	return &probeHandler{
-		addrs:        addrs,
-		probeTimeout: defaultProbeTimeout,
+	if target.Mark != 0 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{Control: markControl(target.Mark)}).DialContext
+		handler.client.Transport = transport
 	}
+	return handler
 }
 
 func (p *probeHandler) ConfigureHandler(register func(pattern string, handlerFunc http.HandlerFunc)) {
-	register("/readyz", p.HandleProbe)
+	register("/readyz", p.handleReadiness)
 	register("/healthz", p.HandleProbe)
 }
 
 func (p *probeHandler) HandleProbe(resp http.ResponseWriter, request *http.Request) {
+	p.handleProbe(resp, request, false)
+}
+
+func (p *probeHandler) handleReadiness(resp http.ResponseWriter, request *http.Request) {
+	p.handleProbe(resp, request, true)
+}
+
+func (p *probeHandler) handleProbe(resp http.ResponseWriter, request *http.Request, readiness bool) {
 	ctx, cancel := context.WithTimeout(request.Context(), p.probeTimeout)
 	log := logger.FromContext(ctx)
 	defer cancel()
 
-	err := p.probeAddrs(ctx)
+	var err error
+	if readiness {
+		// the checks run first so the reason the agent is not ready, eg.
+		// how far its network startup got, is reported instead of its
+		// servers not answering
+		err = p.runReadinessChecks(ctx)
+	}
+	if err == nil {
+		err = p.probeAddrs(ctx)
+	}
 
 	if err == nil {
 		resp.WriteHeader(http.StatusOK)
 	} else if errors.Is(err, context.DeadlineExceeded) {
 		resp.WriteHeader(http.StatusRequestTimeout)
+	} else if errors.Is(err, errNotReady) {
+		resp.WriteHeader(http.StatusInternalServerError)
+		_, _ = resp.Write([]byte(err.Error()))
 	} else {
 		resp.WriteHeader(http.StatusInternalServerError)
 		log.Errorf("InternalServerError: %v", err)
@@ -88,3 +137,13 @@ func (p *probeHandler) probeAddrs(ctx context.Context) (ret error) {
 	}
 	return
 }
+
+func (p *probeHandler) runReadinessChecks(ctx context.Context) error {
+	for _, check := range p.readinessChecks {
+		if err := check(ctx); err != nil {
+			logger.FromContext(ctx).Warnf("Failed readiness check: %v", err)
+			return fmt.Errorf("%w: %w", errNotReady, err)
+		}
+	}
+	return nil
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -140,3 +143,55 @@ func TestProbeHandler_HandleProbe(t *testing.T) {
 		})
 	}
 }
+
+func TestProbeHandler_ReadinessChecks(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		path                 string
+		checkErr             error
+		expectedResponseCode int
+		expectedBody         string
+	}{
+		{
+			name:                 "ready when the checks pass",
+			path:                 "/readyz",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "not ready when a check fails",
+			path:                 "/readyz",
+			checkErr:             errors.New("network drift"),
+			expectedResponseCode: http.StatusInternalServerError,
+			expectedBody:         "not ready: network drift",
+		},
+		{
+			name:                 "healthy even if a check fails",
+			path:                 "/healthz",
+			checkErr:             errors.New("network drift"),
+			expectedResponseCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			handler := NewProbeHandler(ProbeTarget{}, func(ctx context.Context) error {
+				return tc.checkErr
+			})
+			mux := http.NewServeMux()
+			handler.ConfigureHandler(func(pattern string, handlerFunc http.HandlerFunc) {
+				mux.HandleFunc(pattern, handlerFunc)
+			})
+
+			// trigger
+			resp := httptest.NewRecorder()
+			mux.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			// validate
+			g.Expect(resp.Code).To(Equal(tc.expectedResponseCode))
+			g.Expect(resp.Body.String()).To(Equal(tc.expectedBody))
+		})
+	}
+}
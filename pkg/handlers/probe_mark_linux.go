@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// markControl sets mark on the sockets it is given, which requires
+// CAP_NET_ADMIN
+func markControl(mark uint32) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var markErr error
+		err := c.Control(func(fd uintptr) {
+			markErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(mark))
+		})
+		if err != nil {
+			return err
+		}
+		return markErr
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+func TestMarkControl(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer ln.Close()
+	dialer := net.Dialer{Control: markControl(0x2703)}
+
+	// trigger
+	conn, err := dialer.Dial("tcp", ln.Addr().String())
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("setting socket marks requires CAP_NET_ADMIN")
+	}
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	defer conn.Close()
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	g.Expect(err).ToNot(HaveOccurred())
+	var mark int
+	g.Expect(raw.Control(func(fd uintptr) {
+		mark, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK)
+	})).To(Succeed())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(mark).To(Equal(0x2703))
+}
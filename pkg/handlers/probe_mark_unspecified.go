@@ -0,0 +1,15 @@
+//go:build !linux
+
+package handlers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// markControl fails to create sockets, marks are only available on linux
+func markControl(mark uint32) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errors.New("socket marks are not supported on this platform")
+	}
+}
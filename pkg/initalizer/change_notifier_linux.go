@@ -0,0 +1,78 @@
+package initalizer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+)
+
+// netlinkChangeNotifier subscribes to the kernel notifications of link,
+// address and route changes
+type netlinkChangeNotifier struct{}
+
+func (netlinkChangeNotifier) Subscribe(ctx context.Context, changes chan<- string) error {
+	done := make(chan struct{})
+	links := make(chan netlink.LinkUpdate, 16)
+	addrs := make(chan netlink.AddrUpdate, 16)
+	routes := make(chan netlink.RouteUpdate, 16)
+	defer func() {
+		close(done)
+		// netlink closes the channels once it notices done, until then
+		// keep reading so it does not block sending
+		go drain(links)
+		go drain(addrs)
+		go drain(routes)
+	}()
+
+	subscriptionErrs := make(chan error, 1)
+	onError := func(err error) {
+		select {
+		case subscriptionErrs <- err:
+		default:
+		}
+	}
+	if err := netlink.LinkSubscribeWithOptions(links, done, netlink.LinkSubscribeOptions{ErrorCallback: onError}); err != nil {
+		return fmt.Errorf("unable to subscribe to link changes: %w", err)
+	}
+	if err := netlink.AddrSubscribeWithOptions(addrs, done, netlink.AddrSubscribeOptions{ErrorCallback: onError}); err != nil {
+		return fmt.Errorf("unable to subscribe to address changes: %w", err)
+	}
+	if err := netlink.RouteSubscribeWithOptions(routes, done, netlink.RouteSubscribeOptions{ErrorCallback: onError}); err != nil {
+		return fmt.Errorf("unable to subscribe to route changes: %w", err)
+	}
+
+	for {
+		var change string
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-subscriptionErrs:
+			return err
+		case update, ok := <-links:
+			if !ok {
+				return fmt.Errorf("link subscription closed")
+			}
+			change = fmt.Sprintf("link %s", update.Attrs().Name)
+		case update, ok := <-addrs:
+			if !ok {
+				return fmt.Errorf("address subscription closed")
+			}
+			change = fmt.Sprintf("address %s", update.LinkAddress.String())
+		case update, ok := <-routes:
+			if !ok {
+				return fmt.Errorf("route subscription closed")
+			}
+			change = fmt.Sprintf("route %s", update.Dst)
+		}
+		select {
+		case changes <- change:
+		default:
+		}
+	}
+}
+
+func drain[T any](ch <-chan T) {
+	for range ch {
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package initalizer
+
+import (
+	"context"
+
+	"github.com/vishvananda/netlink"
+)
+
+type netlinkChangeNotifier struct{}
+
+func (netlinkChangeNotifier) Subscribe(ctx context.Context, changes chan<- string) error {
+	return netlink.ErrNotImplemented
+}
@@ -2,11 +2,17 @@ package initalizer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
 
 	"github.com/vishvananda/netlink"
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
 	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/iproute"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/nftables"
 	"golang.org/x/sys/unix"
 )
 
@@ -14,31 +20,138 @@ import (
 // and configuration of the route table in both IPv4 & IPv6
 type Executor struct {
 	agentLinkRetriever iproute.AgentLinkRetriever
+	linkName           string
+	usesRouteTable     bool
+	// families are the addresses the agent listens on
+	families        []iproute.AddrFamily
+	addressFamilies AddressFamilies
+	guard           nftables.Guard
+
+	mu sync.Mutex
+	// configuredFamilies are the families Initialize managed to set up
+	// in its last run, optional families that failed are left out
+	configuredFamilies []iproute.AddrFamily
+}
+
+// ExecutorOpts configures the link set up by the Executor
+type ExecutorOpts struct {
+	// LinkName is the name of the agent link, configuration.AgentLinkName
+	// if empty
+	LinkName string
+	// LinkType is the kind of link created, iproute.LinkTypeDummy if
+	// empty. See iproute.LinkOpts for the other link options.
+	LinkType        iproute.LinkType
+	LinkPeerName    string
+	LinkPeerNetns   string
+	MigrateLinkType bool
+	// Addresses the agent listens on, attached to the link with a route
+	// to each of them. configuration.DefaultAgentAddresses if empty.
+	Addresses []string
+	// AddressFamilies tells which families must be set up for Initialize
+	// to succeed
+	AddressFamilies AddressFamilies
+	// Netns is the network namespace the link is set up in, given as a
+	// path or the pid of a process in it, see NetnsPath. The current
+	// namespace if empty.
+	Netns string
+	// Guard if set restricts which traffic can reach the addresses
+	Guard nftables.Guard
+	// RouteTable the routes are added to, the main table if 0. Traffic
+	// to the addresses is sent to other tables by a rule at RulePriority.
+	RouteTable   int
+	RulePriority int
 }
 
-func NewExecutor() (*Executor, error) {
-	handle, err := netlink.NewHandle()
+// defaultRulePriority is the priority of the rule looking up the main table
+const defaultRulePriority = 32766
+
+func NewExecutor(opts ExecutorOpts) (*Executor, error) {
+	handle, err := newNetlinkHandle(opts.Netns)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Executor{
-		agentLinkRetriever: iproute.NewAgentLinkRetriever(handle),
-	}, nil
+	return newExecutor(handle, opts)
 }
 
-func (e *Executor) Initialize(ctx context.Context) error {
-	log := logger.FromContext(ctx)
-
-	ipv4LinkLocalAddr, err := netlink.ParseAddr(configuration.DefaultIpv4TargetHost + "/32")
+func newExecutor(handle iproute.NetlinkHandle, opts ExecutorOpts) (*Executor, error) {
+	if opts.LinkName == "" {
+		opts.LinkName = configuration.AgentLinkName
+	}
+	if len(opts.Addresses) == 0 {
+		opts.Addresses = configuration.DefaultAgentAddresses()
+	}
+	families, err := addrFamilies(opts.Addresses)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if opts.RouteTable < 0 || opts.RouteTable == iproute.LocalRouteTable {
+		return nil, fmt.Errorf("invalid route table %d", opts.RouteTable)
 	}
+	usesRouteTable := opts.RouteTable != 0 && opts.RouteTable != iproute.MainRouteTable
+	if usesRouteTable && (opts.RulePriority <= 0 || opts.RulePriority >= defaultRulePriority) {
+		return nil, fmt.Errorf("rule priority %d must be within (0, %d) to be evaluated before the main table",
+			opts.RulePriority, defaultRulePriority)
+	}
+	addressFamilies := opts.AddressFamilies.withDefaults()
+	if err := addressFamilies.validate(families); err != nil {
+		return nil, err
+	}
+	linkType, err := iproute.ParseLinkType(string(opts.LinkType))
+	if err != nil {
+		return nil, err
+	}
+	opts.LinkType = linkType
+	linkName := opts.LinkName
+	if linkType == iproute.LinkTypeLoopback {
+		linkName = iproute.LoopbackLinkName
+	}
+	return &Executor{
+		agentLinkRetriever: iproute.NewAgentLinkRetriever(handle, iproute.LinkOpts{
+			Name:         opts.LinkName,
+			Type:         opts.LinkType,
+			PeerName:     opts.LinkPeerName,
+			PeerNetns:    opts.LinkPeerNetns,
+			MigrateType:  opts.MigrateLinkType,
+			RouteTable:   opts.RouteTable,
+			RulePriority: opts.RulePriority,
+		}),
+		linkName:        linkName,
+		usesRouteTable:  usesRouteTable,
+		families:        families,
+		addressFamilies: addressFamilies,
+		guard:           opts.Guard,
+	}, nil
+}
 
-	ipv6LinkLocalAddr, err := netlink.ParseAddr(configuration.DefaultIpv6TargetHost + "/128")
+// addrFamilies validates the addresses the agent listens on and turns them
+// into the families set up on the link
+func addrFamilies(addresses []string) ([]iproute.AddrFamily, error) {
+	ips, err := configuration.ParseAgentAddresses(addresses)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	families := make([]iproute.AddrFamily, len(ips))
+	for i, ip := range ips {
+		family, bits := unix.AF_INET6, 128
+		if ip.To4() != nil {
+			family, bits = unix.AF_INET, 32
+		}
+		families[i] = iproute.AddrFamily{
+			Family: family,
+			LinkLocalAddr: &netlink.Addr{
+				IPNet: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)},
+			},
+		}
+	}
+	return families, nil
+}
+
+// Initialize creates the agent link, attaches the addresses to it and adds
+// the routes to them. It fails if any address of a required family cannot
+// be set up, addresses of optional families are skipped when they fail.
+func (e *Executor) Initialize(ctx context.Context) error {
+	log := logger.FromContext(ctx)
 
 	// first create the interface
 	link, err := e.agentLinkRetriever.CreateOrGetLink(ctx)
@@ -48,29 +161,18 @@ func (e *Executor) Initialize(ctx context.Context) error {
 	}
 
 	ctx = logger.ContextWithField(ctx, "link", link.Name())
-	supportedFamilies := []iproute.AddrFamily{
-		{
-			Family:        unix.AF_INET,
-			LinkLocalAddr: ipv4LinkLocalAddr,
-		},
-		{
-			Family:        unix.AF_INET6,
-			LinkLocalAddr: ipv6LinkLocalAddr,
-		},
-	}
+	failedAddrs := map[*netlink.Addr]bool{}
 
 	// attach the required ip addresses to the interface before bringing it up
-	for _, fam := range supportedFamilies {
+	for _, fam := range e.families {
 		ctx := logger.ContextWithField(ctx, "ip", fam.LinkLocalAddr)
 
 		err := link.SetupForAddrFamily(ctx, fam)
 		if err != nil {
-			if isOptionalFamily(fam.Family) {
-				// swallow the error if the family we are trying to associate is optional
-				log.Errorf("Unable to configure family %02x: %v", fam, err)
-			} else {
-				log.Fatalf("Stopping execution, unable to configure required family %02x: %v", fam, err)
+			if err := e.handleFamilyError(ctx, fam, err); err != nil {
+				return err
 			}
+			failedAddrs[fam.LinkLocalAddr] = true
 		}
 	}
 
@@ -82,22 +184,192 @@ func (e *Executor) Initialize(ctx context.Context) error {
 	}
 
 	// add the routes to the interface to the default routing table
-	for _, fam := range supportedFamilies {
+	for _, fam := range e.families {
 		ctx := logger.ContextWithField(ctx, "ip", fam.LinkLocalAddr)
 
 		err := link.SetupRouteTableForAddrFamily(ctx, fam)
 		if err != nil {
-			if isOptionalFamily(fam.Family) {
-				log.Errorf("Unable to configure family %02x: %v", fam, err)
-			} else {
-				log.Fatalf("Stopping execution, unable to configure required family %02x: %v", fam, err)
+			if err := e.handleFamilyError(ctx, fam, err); err != nil {
+				return err
 			}
+			failedAddrs[fam.LinkLocalAddr] = true
+		}
+	}
+
+	if e.guard != nil {
+		addresses := make([]net.IP, len(e.families))
+		for i, fam := range e.families {
+			addresses[i] = fam.LinkLocalAddr.IP
+		}
+		if err := e.guard.Install(ctx, addresses); err != nil {
+			return err
 		}
 	}
 
+	var configuredFamilies []iproute.AddrFamily
+	for _, fam := range e.families {
+		if !failedAddrs[fam.LinkLocalAddr] {
+			configuredFamilies = append(configuredFamilies, fam)
+		}
+	}
+	e.mu.Lock()
+	e.configuredFamilies = configuredFamilies
+	e.mu.Unlock()
 	return nil
 }
 
-func isOptionalFamily(fam int) bool {
-	return unix.AF_INET6 == fam
+// handleFamilyError swallows the error if the family we are trying to set
+// up is optional
+func (e *Executor) handleFamilyError(ctx context.Context, fam iproute.AddrFamily, err error) error {
+	if e.addressFamilies.isOptional(fam.Family) {
+		logger.FromContext(ctx).Errorf("Unable to configure optional family %02x: %v", fam.Family, err)
+		return nil
+	}
+	return fmt.Errorf("unable to configure required family %02x address %s: %w", fam.Family, fam.LinkLocalAddr, err)
+}
+
+// A Drift is a difference between the host and the state Initialize set up
+type Drift struct {
+	// Reason is one of link_missing, link_wrong_type, link_down,
+	// address_missing, route_missing, route_mismatch or rule_missing
+	Reason string
+	Detail string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s", d.Reason, d.Detail)
+}
+
+// CheckState inspects the host, without changing it, to find out whether
+// the state set up by the last Initialize was changed since
+func (e *Executor) CheckState(ctx context.Context) ([]Drift, error) {
+	link, err := e.agentLinkRetriever.GetLink(ctx)
+	if errors.Is(err, iproute.ErrLinkNotFound) {
+		return []Drift{{Reason: "link_missing", Detail: err.Error()}}, nil
+	}
+	if errors.Is(err, iproute.ErrWrongLinkType) {
+		return []Drift{{Reason: "link_wrong_type", Detail: err.Error()}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	if !link.IsUp() {
+		drift = append(drift, Drift{Reason: "link_down", Detail: fmt.Sprintf("link %s is down", link.Name())})
+	}
+	e.mu.Lock()
+	configuredFamilies := e.configuredFamilies
+	e.mu.Unlock()
+	for _, fam := range configuredFamilies {
+		hasAddr, err := link.HasAddrFamily(ctx, fam)
+		if err != nil {
+			return nil, err
+		}
+		if !hasAddr {
+			drift = append(drift, Drift{Reason: "address_missing",
+				Detail: fmt.Sprintf("address %s is not attached to %s", fam.LinkLocalAddr, link.Name())})
+		}
+		hasRoute, err := link.HasRouteForAddrFamily(ctx, fam)
+		if err != nil {
+			drift = append(drift, Drift{Reason: "route_mismatch", Detail: err.Error()})
+		} else if !hasRoute {
+			drift = append(drift, Drift{Reason: "route_missing",
+				Detail: fmt.Sprintf("there is no route to %s through %s", fam.LinkLocalAddr, link.Name())})
+		}
+		hasRule, err := link.HasRuleForAddrFamily(ctx, fam)
+		if err != nil {
+			return nil, err
+		}
+		if !hasRule {
+			drift = append(drift, Drift{Reason: "rule_missing",
+				Detail: fmt.Sprintf("there is no rule looking up the route to %s", fam.LinkLocalAddr)})
+		}
+	}
+	return drift, nil
+}
+
+// FailedAddrs lists the addresses of optional families the last Initialize
+// could not set up, nothing can listen on them
+func (e *Executor) FailedAddrs() []net.IP {
+	e.mu.Lock()
+	configuredFamilies := e.configuredFamilies
+	e.mu.Unlock()
+	var failed []net.IP
+	for _, fam := range e.families {
+		if !slices.ContainsFunc(configuredFamilies, func(configured iproute.AddrFamily) bool {
+			return configured.LinkLocalAddr.IP.Equal(fam.LinkLocalAddr.IP)
+		}) {
+			failed = append(failed, fam.LinkLocalAddr.IP)
+		}
+	}
+	return failed
+}
+
+// PendingAddrs lists the addresses set up by the last Initialize that
+// cannot be bound to yet, see iproute.AgentLink.AddrFamilyUsable
+func (e *Executor) PendingAddrs(ctx context.Context) ([]net.IP, error) {
+	link, err := e.agentLinkRetriever.GetLink(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	configuredFamilies := e.configuredFamilies
+	e.mu.Unlock()
+	var pending []net.IP
+	for _, fam := range configuredFamilies {
+		usable, err := link.AddrFamilyUsable(ctx, fam)
+		if err != nil {
+			return nil, err
+		}
+		if !usable {
+			pending = append(pending, fam.LinkLocalAddr.IP)
+		}
+	}
+	return pending, nil
+}
+
+// Uninitialize removes the guard rules, routes, addresses and link created by
+// Initialize. It can be called repeatedly, things that were already
+// removed are skipped.
+func (e *Executor) Uninitialize(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+
+	if e.guard != nil {
+		if err := e.guard.Remove(ctx); err != nil {
+			return err
+		}
+	}
+
+	// rules are not tied to the link, they are left behind if it was
+	// deleted by other means or a previous run stopped halfway
+	for _, fam := range e.families {
+		ctx := logger.ContextWithField(ctx, "ip", fam.LinkLocalAddr)
+		if err := e.agentLinkRetriever.TeardownRuleForAddrFamily(ctx, fam); err != nil {
+			return err
+		}
+	}
+
+	link, err := e.agentLinkRetriever.GetLink(ctx)
+	if errors.Is(err, iproute.ErrLinkNotFound) {
+		log.Infof("Link not found, nothing else to remove")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx = logger.ContextWithField(ctx, "link", link.Name())
+	for _, fam := range e.families {
+		ctx := logger.ContextWithField(ctx, "ip", fam.LinkLocalAddr)
+		if err := link.TeardownRouteTableForAddrFamily(ctx, fam); err != nil {
+			return fmt.Errorf("unable to remove route for %s: %w", fam.LinkLocalAddr, err)
+		}
+		if err := link.TeardownForAddrFamily(ctx, fam); err != nil {
+			return fmt.Errorf("unable to remove address %s: %w", fam.LinkLocalAddr, err)
+		}
+	}
+
+	return link.Delete(ctx)
 }
@@ -0,0 +1,452 @@
+package initalizer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	_ "go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestExecutor_CheckState(t *testing.T) {
+	ipv4 := mustParseAddr(configuration.DefaultIpv4TargetHost + "/32")
+	ipv6 := mustParseAddr(configuration.DefaultIpv6TargetHost + "/128")
+
+	testCases := []struct {
+		name            string
+		change          func(g Gomega, handle *fakeNetlinkHandle)
+		expectedReasons []string
+	}{
+		{
+			name: "no drift right after initializing",
+		},
+		{
+			name: "link was deleted",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.LinkDel(link)).To(Succeed())
+			},
+			expectedReasons: []string{"link_missing"},
+		},
+		{
+			name: "link was brought down",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				g.Expect(handle.linkSetDown(configuration.AgentLinkName)).To(Succeed())
+			},
+			expectedReasons: []string{"link_down"},
+		},
+		{
+			name: "link was replaced by a link of another type",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.LinkDel(link)).To(Succeed())
+				g.Expect(handle.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: configuration.AgentLinkName}})).To(Succeed())
+			},
+			expectedReasons: []string{"link_wrong_type"},
+		},
+		{
+			name: "address was removed",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.AddrDel(link, ipv4)).To(Succeed())
+			},
+			expectedReasons: []string{"address_missing"},
+		},
+		{
+			name: "route was removed",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.RouteDel(&netlink.Route{Dst: ipv6.IPNet, LinkIndex: link.Attrs().Index})).To(Succeed())
+			},
+			expectedReasons: []string{"route_missing"},
+		},
+		{
+			name: "route goes through another link",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				g.Expect(handle.LinkAdd(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "other0"}})).To(Succeed())
+				g.Expect(handle.routeThrough(ipv4.IPNet, "other0")).To(Succeed())
+			},
+			expectedReasons: []string{"route_mismatch"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			// setup
+			handle := newFakeNetlinkHandle()
+			executor, err := newExecutor(handle, ExecutorOpts{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(executor.Initialize(ctx)).To(Succeed())
+			if tc.change != nil {
+				tc.change(g, handle)
+			}
+
+			// trigger
+			drift, err := executor.CheckState(ctx)
+
+			// validate
+			g.Expect(err).ToNot(HaveOccurred())
+			reasons := make([]string, len(drift))
+			for i, d := range drift {
+				reasons[i] = d.Reason
+			}
+			if tc.expectedReasons == nil {
+				g.Expect(reasons).To(BeEmpty())
+			} else {
+				g.Expect(reasons).To(Equal(tc.expectedReasons))
+			}
+		})
+	}
+}
+
+func TestExecutor_Initialize_CustomLink(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             ExecutorOpts
+		expectedLink     string
+		expectedAddrs    []string
+		expectedErrorMsg string
+	}{
+		{
+			name:          "defaults",
+			expectedLink:  configuration.AgentLinkName,
+			expectedAddrs: []string{configuration.DefaultIpv4TargetHost + "/32", configuration.DefaultIpv6TargetHost + "/128"},
+		},
+		{
+			name: "custom link name and addresses",
+			opts: ExecutorOpts{
+				LinkName:  "pod-id-test0",
+				Addresses: []string{"169.254.170.24", "169.254.170.25", "fd00:ec2::24"},
+			},
+			expectedLink:  "pod-id-test0",
+			expectedAddrs: []string{"169.254.170.24/32", "169.254.170.25/32", "fd00:ec2::24/128"},
+		},
+		{
+			name:             "address that is not link-local",
+			opts:             ExecutorOpts{Addresses: []string{"10.0.0.1"}},
+			expectedErrorMsg: "10.0.0.1 is not an IPv4 link-local address (169.254.0.0/16)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			// setup
+			handle := newFakeNetlinkHandle()
+			executor, err := newExecutor(handle, tc.opts)
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// trigger
+			err = executor.Initialize(ctx)
+
+			// validate
+			g.Expect(err).ToNot(HaveOccurred())
+			link, err := handle.LinkByName(tc.expectedLink)
+			g.Expect(err).ToNot(HaveOccurred())
+			var addrs, routes []string
+			for _, addr := range handle.addrs[link.Attrs().Index] {
+				addrs = append(addrs, addr.IPNet.String())
+			}
+			for _, route := range handle.routes {
+				g.Expect(route.LinkIndex).To(Equal(link.Attrs().Index))
+				routes = append(routes, route.Dst.String())
+			}
+			g.Expect(addrs).To(Equal(tc.expectedAddrs))
+			g.Expect(routes).To(Equal(tc.expectedAddrs))
+		})
+	}
+}
+
+func TestExecutor_Initialize_AddressFamilies(t *testing.T) {
+	addressFamilies := []AddressFamilies{
+		{IPv4: FamilyRequired, IPv6: FamilyRequired},
+		{IPv4: FamilyRequired, IPv6: FamilyOptional},
+		{IPv4: FamilyOptional, IPv6: FamilyRequired},
+		{IPv4: FamilyOptional, IPv6: FamilyOptional},
+	}
+	failures := []struct {
+		name   string
+		failed []int
+	}{
+		{name: "nothing fails"},
+		{name: "IPv4 fails", failed: []int{unix.AF_INET}},
+		{name: "IPv6 fails", failed: []int{unix.AF_INET6}},
+		{name: "both fail", failed: []int{unix.AF_INET, unix.AF_INET6}},
+	}
+
+	for _, families := range addressFamilies {
+		for _, failure := range failures {
+			name := fmt.Sprintf("ipv4 %s, ipv6 %s, %s", families.IPv4, families.IPv6, failure.name)
+			t.Run(name, func(t *testing.T) {
+				g := NewWithT(t)
+				ctx := context.Background()
+
+				// setup
+				handle := newFakeNetlinkHandle()
+				for _, family := range failure.failed {
+					handle.addrAddErrs[family] = unix.EAFNOSUPPORT
+				}
+				executor, err := newExecutor(handle, ExecutorOpts{AddressFamilies: families})
+				g.Expect(err).ToNot(HaveOccurred())
+
+				// trigger
+				err = executor.Initialize(ctx)
+
+				// validate, only failures of required families are errors
+				// and the optional ones that failed are not tracked
+				expectError := false
+				var expectedConfigured []int
+				for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+					if !slices.Contains(failure.failed, family) {
+						expectedConfigured = append(expectedConfigured, family)
+					} else if !families.isOptional(family) {
+						expectError = true
+					}
+				}
+				if expectError {
+					g.Expect(err).To(MatchError(unix.EAFNOSUPPORT))
+					return
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+				var configured []int
+				for _, fam := range executor.configuredFamilies {
+					configured = append(configured, fam.Family)
+				}
+				g.Expect(configured).To(Equal(expectedConfigured))
+			})
+		}
+	}
+}
+
+func TestNewExecutor_AddressFamilies(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             ExecutorOpts
+		expectedErrorMsg string
+	}{
+		{
+			name: "IPv4 only addresses with IPv6 optional",
+			opts: ExecutorOpts{Addresses: []string{configuration.DefaultIpv4TargetHost}},
+		},
+		{
+			name: "IPv6 only addresses with IPv6 required",
+			opts: ExecutorOpts{
+				Addresses:       []string{configuration.DefaultIpv6TargetHost},
+				AddressFamilies: AddressFamilies{IPv4: FamilyOptional, IPv6: FamilyRequired},
+			},
+		},
+		{
+			name:             "IPv6 only addresses with IPv4 required",
+			opts:             ExecutorOpts{Addresses: []string{configuration.DefaultIpv6TargetHost}},
+			expectedErrorMsg: "family ipv4 is required but none of the addresses is ipv4",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			_, err := newExecutor(newFakeNetlinkHandle(), tc.opts)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+// fakeGuard records the addresses it guards
+type fakeGuard struct {
+	addresses []net.IP
+	installed bool
+}
+
+func (f *fakeGuard) Install(ctx context.Context, addresses []net.IP) error {
+	f.addresses = addresses
+	f.installed = true
+	return nil
+}
+
+func (f *fakeGuard) Remove(ctx context.Context) error {
+	f.installed = false
+	return nil
+}
+
+func TestExecutor_Guard(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup
+	guard := &fakeGuard{}
+	executor, err := newExecutor(newFakeNetlinkHandle(), ExecutorOpts{Guard: guard})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger
+	g.Expect(executor.Initialize(ctx)).To(Succeed())
+
+	// validate
+	g.Expect(guard.installed).To(BeTrue())
+	g.Expect(guard.addresses).To(HaveLen(2))
+	g.Expect(guard.addresses[0].String()).To(Equal(configuration.DefaultIpv4TargetHost))
+	g.Expect(guard.addresses[1].String()).To(Equal(configuration.DefaultIpv6TargetHost))
+
+	// trigger, the rules are removed with the link
+	g.Expect(executor.Uninitialize(ctx)).To(Succeed())
+
+	// validate
+	g.Expect(guard.installed).To(BeFalse())
+}
+
+func TestExecutor_RouteTable(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	ipv4 := mustParseAddr(configuration.DefaultIpv4TargetHost + "/32")
+
+	// setup
+	handle := newFakeNetlinkHandle()
+	executor, err := newExecutor(handle, ExecutorOpts{RouteTable: 100, RulePriority: 1000})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger
+	g.Expect(executor.Initialize(ctx)).To(Succeed())
+
+	// validate, the routes are only in the agent table
+	mainRoutes, err := handle.RouteList(nil, unix.AF_INET)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(mainRoutes).To(BeEmpty())
+	g.Expect(handle.routes).To(HaveLen(2))
+	for _, route := range handle.routes {
+		g.Expect(route.Table).To(Equal(100))
+	}
+	g.Expect(handle.rules).To(HaveLen(2))
+	for _, rule := range handle.rules {
+		g.Expect(rule.Table).To(Equal(100))
+		g.Expect(rule.Priority).To(Equal(1000))
+	}
+	report, err := executor.Verify(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.Ok()).To(BeTrue())
+
+	// trigger, a rule evaluated before sends the traffic to a table with
+	// a default route, as the VPC CNI does for pods on secondary ENIs
+	_, podIp, _ := net.ParseCIDR("10.0.1.5/32")
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	g.Expect(handle.RuleAdd(&netlink.Rule{Family: unix.AF_INET, Priority: 536, Table: 2, Src: podIp})).To(Succeed())
+	g.Expect(handle.RouteAdd(&netlink.Route{LinkIndex: 42, Dst: defaultDst, Table: 2})).To(Succeed())
+	report, err = executor.Verify(ctx)
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.Ok()).To(BeFalse())
+	g.Expect(report.Checks).To(ContainElement(Check{
+		Name:   "shadowing_rules",
+		Target: ipv4.IPNet.String(),
+		Status: CheckFailed,
+		Detail: "536: from 10.0.1.5/32 to <nil> table 2",
+	}))
+
+	// trigger, a removed rule is drift
+	g.Expect(handle.RuleDel(&netlink.Rule{Priority: 1000, Table: 100, Dst: ipv4.IPNet})).To(Succeed())
+	drift, err := executor.CheckState(ctx)
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(drift).To(HaveLen(1))
+	g.Expect(drift[0].Reason).To(Equal("rule_missing"))
+
+	// trigger, everything is removed on uninitialize
+	g.Expect(executor.Uninitialize(ctx)).To(Succeed())
+
+	// validate
+	g.Expect(handle.routes).To(HaveLen(1))
+	g.Expect(handle.rules).To(HaveLen(1))
+}
+
+func TestExecutor_Uninitialize_RulesWithoutLink(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup, the link is deleted by other means after initializing
+	handle := newFakeNetlinkHandle()
+	executor, err := newExecutor(handle, ExecutorOpts{RouteTable: 100, RulePriority: 1000})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(executor.Initialize(ctx)).To(Succeed())
+	link, err := handle.LinkByName(configuration.AgentLinkName)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(handle.LinkDel(link)).To(Succeed())
+	g.Expect(handle.rules).To(HaveLen(2))
+
+	// trigger
+	err = executor.Uninitialize(ctx)
+
+	// validate, the rules are removed anyway
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(handle.rules).To(BeEmpty())
+}
+
+func TestNewExecutor_RouteTable(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             ExecutorOpts
+		expectedErrorMsg string
+	}{
+		{
+			name: "main table needs no rule",
+			opts: ExecutorOpts{RouteTable: unix.RT_TABLE_MAIN},
+		},
+		{
+			name:             "local table",
+			opts:             ExecutorOpts{RouteTable: unix.RT_TABLE_LOCAL, RulePriority: 100},
+			expectedErrorMsg: "invalid route table 255",
+		},
+		{
+			name:             "rule evaluated after the main table",
+			opts:             ExecutorOpts{RouteTable: 100, RulePriority: 32766},
+			expectedErrorMsg: "rule priority 32766 must be within (0, 32766) to be evaluated before the main table",
+		},
+		{
+			name:             "missing rule priority",
+			opts:             ExecutorOpts{RouteTable: 100},
+			expectedErrorMsg: "rule priority 0 must be within (0, 32766) to be evaluated before the main table",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			_, err := newExecutor(newFakeNetlinkHandle(), tc.opts)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
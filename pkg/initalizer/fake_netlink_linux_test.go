@@ -0,0 +1,299 @@
+package initalizer
+
+import (
+	"net"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/iproute"
+	"golang.org/x/sys/unix"
+)
+
+// fakeNetlinkHandle keeps links, addresses and routes in memory so tests
+// can check the state the executor leaves behind and change it under it
+type fakeNetlinkHandle struct {
+	mu        sync.Mutex
+	links     map[string]netlink.Link
+	addrs     map[int][]netlink.Addr
+	routes    []netlink.Route
+	rules     []netlink.Rule
+	nextIndex int
+	// addrAddErrs makes adding addresses of a family fail, as if it was
+	// disabled on the host
+	addrAddErrs map[int]error
+	// addrAddFlags are set on the added addresses of a family, eg. as if
+	// IPv6 duplicate address detection was in progress
+	addrAddFlags map[int]int
+}
+
+var _ iproute.NetlinkHandle = &fakeNetlinkHandle{}
+
+func newFakeNetlinkHandle() *fakeNetlinkHandle {
+	return &fakeNetlinkHandle{
+		links:        map[string]netlink.Link{},
+		addrs:        map[int][]netlink.Addr{},
+		nextIndex:    1,
+		addrAddErrs:  map[int]error{},
+		addrAddFlags: map[int]int{},
+	}
+}
+
+func (f *fakeNetlinkHandle) LinkByName(name string) (netlink.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	link, ok := f.links[name]
+	if !ok {
+		return nil, netlink.LinkNotFoundError{}
+	}
+	// copy the attributes like the kernel would, so changes are only seen
+	// when the link is fetched again
+	return copyLink(link, *link.Attrs()), nil
+}
+
+// copyLink copies link with attrs, keeping its type
+func copyLink(link netlink.Link, attrs netlink.LinkAttrs) netlink.Link {
+	if link.Type() == "veth" {
+		return &netlink.Veth{LinkAttrs: attrs}
+	}
+	return &netlink.Dummy{LinkAttrs: attrs}
+}
+
+func (f *fakeNetlinkHandle) LinkAdd(link netlink.Link) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.links[link.Attrs().Name]; ok {
+		return unix.EEXIST
+	}
+	attrs := *link.Attrs()
+	attrs.Index = f.nextIndex
+	f.nextIndex++
+	f.links[attrs.Name] = copyLink(link, attrs)
+	return nil
+}
+
+func (f *fakeNetlinkHandle) LinkSetUp(link netlink.Link) error {
+	return f.setLinkFlags(link.Attrs().Name, net.FlagUp, true)
+}
+
+// linkSetDown brings a link down as if done by another process
+func (f *fakeNetlinkHandle) linkSetDown(name string) error {
+	return f.setLinkFlags(name, net.FlagUp, false)
+}
+
+func (f *fakeNetlinkHandle) setLinkFlags(name string, flags net.Flags, set bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	link, ok := f.links[name]
+	if !ok {
+		return netlink.LinkNotFoundError{}
+	}
+	if set {
+		link.Attrs().Flags |= flags
+	} else {
+		link.Attrs().Flags &^= flags
+	}
+	return nil
+}
+
+func (f *fakeNetlinkHandle) LinkDel(link netlink.Link) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, ok := f.links[link.Attrs().Name]
+	if !ok {
+		return netlink.LinkNotFoundError{}
+	}
+	// like the kernel, drop the addresses and routes of the link with it
+	index := existing.Attrs().Index
+	delete(f.links, link.Attrs().Name)
+	delete(f.addrs, index)
+	routes := f.routes[:0]
+	for _, route := range f.routes {
+		if route.LinkIndex != index {
+			routes = append(routes, route)
+		}
+	}
+	f.routes = routes
+	return nil
+}
+
+// LinkSetNsFd drops the link, as it leaves the namespace of the handle
+func (f *fakeNetlinkHandle) LinkSetNsFd(link netlink.Link, fd int) error {
+	return f.LinkDel(link)
+}
+
+func (f *fakeNetlinkHandle) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var addrs []netlink.Addr
+	for _, addr := range f.addrs[link.Attrs().Index] {
+		if ipFamily(addr.IP) == family {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+func (f *fakeNetlinkHandle) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.addrAddErrs[ipFamily(addr.IP)]; err != nil {
+		return err
+	}
+	index := link.Attrs().Index
+	for _, existing := range f.addrs[index] {
+		if existing.Equal(*addr) {
+			return unix.EEXIST
+		}
+	}
+	added := *addr
+	added.Flags = f.addrAddFlags[ipFamily(addr.IP)]
+	f.addrs[index] = append(f.addrs[index], added)
+	return nil
+}
+
+// setAddrFlags changes the flags of an address, eg. as the kernel does
+// once duplicate address detection completes
+func (f *fakeNetlinkHandle) setAddrFlags(ip net.IP, flags int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, addrs := range f.addrs {
+		for i := range addrs {
+			if addrs[i].IP.Equal(ip) {
+				addrs[i].Flags = flags
+			}
+		}
+	}
+}
+
+func (f *fakeNetlinkHandle) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	index := link.Attrs().Index
+	for i, existing := range f.addrs[index] {
+		if existing.Equal(*addr) {
+			f.addrs[index] = append(f.addrs[index][:i], f.addrs[index][i+1:]...)
+			return nil
+		}
+	}
+	return unix.EADDRNOTAVAIL
+}
+
+func (f *fakeNetlinkHandle) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var routes []netlink.Route
+	for _, route := range f.routes {
+		if ipFamily(route.Dst.IP) == family && isMainTable(route.Table) &&
+			(link == nil || link.Attrs().Index == route.LinkIndex) {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+func (f *fakeNetlinkHandle) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var routes []netlink.Route
+	for _, route := range f.routes {
+		if ipFamily(route.Dst.IP) == family && route.Table == filter.Table {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+func (f *fakeNetlinkHandle) RouteAdd(route *netlink.Route) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, existing := range f.routes {
+		if existing.Dst.String() == route.Dst.String() && existing.Table == route.Table {
+			return unix.EEXIST
+		}
+	}
+	f.routes = append(f.routes, *route)
+	return nil
+}
+
+func (f *fakeNetlinkHandle) RouteDel(route *netlink.Route) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.routes {
+		if existing.Dst.String() == route.Dst.String() && existing.LinkIndex == route.LinkIndex &&
+			existing.Table == route.Table {
+			f.routes = append(f.routes[:i], f.routes[i+1:]...)
+			return nil
+		}
+	}
+	return unix.ESRCH
+}
+
+func (f *fakeNetlinkHandle) RuleList(family int) ([]netlink.Rule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rules []netlink.Rule
+	for _, rule := range f.rules {
+		if rule.Family == family {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (f *fakeNetlinkHandle) RuleAdd(rule *netlink.Rule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, *rule)
+	return nil
+}
+
+func (f *fakeNetlinkHandle) RuleDel(rule *netlink.Rule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.rules {
+		if existing.Priority == rule.Priority && existing.Table == rule.Table &&
+			existing.Dst.String() == rule.Dst.String() {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return nil
+		}
+	}
+	return unix.ENOENT
+}
+
+// routeThrough replaces the route to dst with one through the link named
+// name, as if another process took over the route
+func (f *fakeNetlinkHandle) routeThrough(dst *net.IPNet, name string) error {
+	link, err := f.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.routes {
+		if existing.Dst.String() == dst.String() {
+			f.routes[i].LinkIndex = link.Attrs().Index
+			return nil
+		}
+	}
+	f.routes = append(f.routes, netlink.Route{Dst: dst, LinkIndex: link.Attrs().Index})
+	return nil
+}
+
+func isMainTable(table int) bool {
+	return table == 0 || table == unix.RT_TABLE_MAIN
+}
+
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return unix.AF_INET
+	}
+	return unix.AF_INET6
+}
+
+func mustParseAddr(addr string) *netlink.Addr {
+	parsed, err := netlink.ParseAddr(addr)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,86 @@
+package initalizer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/iproute"
+	"golang.org/x/sys/unix"
+)
+
+// A FamilyRequirement tells whether Initialize fails when an address
+// family cannot be set up
+type FamilyRequirement string
+
+const (
+	FamilyRequired FamilyRequirement = "required"
+	// FamilyOptional families that cannot be set up are logged and left
+	// out, eg. IPv6 on nodes where it is disabled
+	FamilyOptional FamilyRequirement = "optional"
+)
+
+// AddressFamilies is the requirement of each address family. Empty fields
+// take the default, IPv4 required and IPv6 optional.
+type AddressFamilies struct {
+	IPv4 FamilyRequirement
+	IPv6 FamilyRequirement
+}
+
+// ParseAddressFamilies parses a policy given as family=requirement pairs,
+// eg. ipv4=optional,ipv6=required for IPv6-only clusters
+func ParseAddressFamilies(policy map[string]string) (AddressFamilies, error) {
+	var families AddressFamilies
+	for family, requirement := range policy {
+		req := FamilyRequirement(strings.ToLower(requirement))
+		if req != FamilyRequired && req != FamilyOptional {
+			return AddressFamilies{}, fmt.Errorf("family %s must be either %s or %s, not %s",
+				family, FamilyRequired, FamilyOptional, requirement)
+		}
+		switch strings.ToLower(family) {
+		case "ipv4":
+			families.IPv4 = req
+		case "ipv6":
+			families.IPv6 = req
+		default:
+			return AddressFamilies{}, fmt.Errorf("unknown address family %s, expected ipv4 or ipv6", family)
+		}
+	}
+	return families, nil
+}
+
+func (a AddressFamilies) withDefaults() AddressFamilies {
+	if a.IPv4 == "" {
+		a.IPv4 = FamilyRequired
+	}
+	if a.IPv6 == "" {
+		a.IPv6 = FamilyOptional
+	}
+	return a
+}
+
+func (a AddressFamilies) isOptional(family int) bool {
+	if family == unix.AF_INET {
+		return a.IPv4 == FamilyOptional
+	}
+	return a.IPv6 == FamilyOptional
+}
+
+// validate checks there is an address of every required family
+func (a AddressFamilies) validate(families []iproute.AddrFamily) error {
+	for _, required := range []struct {
+		name   string
+		family int
+	}{{"ipv4", unix.AF_INET}, {"ipv6", unix.AF_INET6}} {
+		if a.isOptional(required.family) {
+			continue
+		}
+		hasAddress := slices.ContainsFunc(families, func(fam iproute.AddrFamily) bool {
+			return fam.Family == required.family
+		})
+		if !hasAddress {
+			return fmt.Errorf("family %s is required but none of the addresses is %s", required.name, required.name)
+		}
+	}
+	return nil
+}
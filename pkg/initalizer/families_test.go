@@ -0,0 +1,58 @@
+package initalizer
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseAddressFamilies(t *testing.T) {
+	testCases := []struct {
+		name             string
+		policy           map[string]string
+		expected         AddressFamilies
+		expectedErrorMsg string
+	}{
+		{
+			name:     "empty policy keeps the defaults",
+			expected: AddressFamilies{IPv4: FamilyRequired, IPv6: FamilyOptional},
+		},
+		{
+			name:     "IPv6-only cluster",
+			policy:   map[string]string{"ipv4": "optional", "IPv6": "Required"},
+			expected: AddressFamilies{IPv4: FamilyOptional, IPv6: FamilyRequired},
+		},
+		{
+			name:     "only overrides the given family",
+			policy:   map[string]string{"ipv6": "required"},
+			expected: AddressFamilies{IPv4: FamilyRequired, IPv6: FamilyRequired},
+		},
+		{
+			name:             "unknown family",
+			policy:           map[string]string{"ipx": "required"},
+			expectedErrorMsg: "unknown address family ipx, expected ipv4 or ipv6",
+		},
+		{
+			name:             "unknown requirement",
+			policy:           map[string]string{"ipv4": "maybe"},
+			expectedErrorMsg: "family ipv4 must be either required or optional, not maybe",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			families, err := ParseAddressFamilies(tc.policy)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(families.withDefaults()).To(Equal(tc.expected))
+			}
+		})
+	}
+}
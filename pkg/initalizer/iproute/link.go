@@ -3,6 +3,8 @@ package iproute
 import (
 	"context"
 	"fmt"
+	"net"
+	"os"
 
 	"github.com/vishvananda/netlink"
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
@@ -13,57 +15,203 @@ type (
 	// actual implementation of the interface
 	agentLinkRetriever struct {
 		netlinkHandle NetlinkHandle
+		opts          LinkOpts
 	}
 )
 
-func NewAgentLinkRetriever(handle *netlink.Handle) AgentLinkRetriever {
+// NewAgentLinkRetriever creates an AgentLinkRetriever for the link
+// configured by opts
+func NewAgentLinkRetriever(handle NetlinkHandle, opts LinkOpts) AgentLinkRetriever {
+	if opts.Name == "" {
+		opts.Name = configuration.AgentLinkName
+	}
+	if opts.Type == "" {
+		opts.Type = LinkTypeDummy
+	}
+	if opts.PeerName == "" {
+		opts.PeerName = opts.Name + "p"
+	}
 	return &agentLinkRetriever{
 		netlinkHandle: handle,
+		opts:          opts,
 	}
 }
 
 func (l *agentLinkRetriever) CreateOrGetLink(ctx context.Context) (AgentLink, error) {
 	log := logger.FromContext(ctx)
 
-	attrs := netlink.NewLinkAttrs()
-	attrs.Name = configuration.AgentLinkName
-	dummyDevice := &netlink.Dummy{LinkAttrs: attrs}
+	if l.opts.Type == LinkTypeLoopback {
+		return l.getLoopbackLink(ctx, l.opts.MigrateType)
+	}
 
-	link, err := l.netlinkHandle.LinkByName(attrs.Name)
+	link, err := l.netlinkHandle.LinkByName(l.opts.Name)
 	if err != nil {
 		_, errWasLinkNotFound := err.(netlink.LinkNotFoundError)
 		if !errWasLinkNotFound {
-			return nil, fmt.Errorf("error finding %s: %w", attrs.Name, err)
+			return nil, fmt.Errorf("error finding %s: %w", l.opts.Name, err)
 		}
 
 		log.Infof("Link was not found, creating it")
-		link, err = l.createLink(ctx, dummyDevice)
+		link, err = l.createLink(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("unable to create interface %v: %w", dummyDevice.Name, err)
+			return nil, fmt.Errorf("unable to create interface %v: %w", l.opts.Name, err)
 		}
 		log.Debugf("Link %s created", link.Attrs().Name)
+	} else if !l.hasType(link) {
+		if !l.opts.MigrateType {
+			return nil, l.wrongTypeError(link)
+		}
+		// routes and addresses go away with the link and are set up again
+		// on the new one
+		log.Warnf("Replacing %s link %s with a %s link", link.Type(), l.opts.Name, l.opts.Type)
+		if err = l.netlinkHandle.LinkDel(link); err != nil {
+			return nil, fmt.Errorf("unable to delete %s link %s: %w", link.Type(), l.opts.Name, err)
+		}
+		link, err = l.createLink(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create interface %v: %w", l.opts.Name, err)
+		}
 	}
 
-	return &agentLink{
-		netlinkHandle: l.netlinkHandle,
-		link:          link,
-	}, nil
+	return l.agentLink(link), nil
+}
+
+func (l *agentLinkRetriever) GetLink(ctx context.Context) (AgentLink, error) {
+	if l.opts.Type == LinkTypeLoopback {
+		return l.getLoopbackLink(ctx, false)
+	}
+
+	link, err := l.netlinkHandle.LinkByName(l.opts.Name)
+	if err != nil {
+		if _, errWasLinkNotFound := err.(netlink.LinkNotFoundError); errWasLinkNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrLinkNotFound, l.opts.Name)
+		}
+		return nil, fmt.Errorf("error finding %s: %w", l.opts.Name, err)
+	}
+	if !l.hasType(link) {
+		return nil, l.wrongTypeError(link)
+	}
+
+	return l.agentLink(link), nil
+}
+
+// getLoopbackLink fetches the loopback link. A link with the agent link
+// name left over from another link type would keep the addresses, so it
+// is deleted if migrate is set and reported otherwise.
+func (l *agentLinkRetriever) getLoopbackLink(ctx context.Context, migrate bool) (AgentLink, error) {
+	log := logger.FromContext(ctx)
+
+	if l.opts.Name != LoopbackLinkName {
+		stale, err := l.netlinkHandle.LinkByName(l.opts.Name)
+		if err == nil {
+			if !migrate {
+				return nil, l.wrongTypeError(stale)
+			}
+			log.Warnf("Deleting %s link %s, the agent addresses are attached to %s", stale.Type(), l.opts.Name, LoopbackLinkName)
+			if err = l.netlinkHandle.LinkDel(stale); err != nil {
+				return nil, fmt.Errorf("unable to delete %s link %s: %w", stale.Type(), l.opts.Name, err)
+			}
+		} else if _, errWasLinkNotFound := err.(netlink.LinkNotFoundError); !errWasLinkNotFound {
+			return nil, fmt.Errorf("error finding %s: %w", l.opts.Name, err)
+		}
+	}
+
+	link, err := l.netlinkHandle.LinkByName(LoopbackLinkName)
+	if err != nil {
+		return nil, fmt.Errorf("error finding %s: %w", LoopbackLinkName, err)
+	}
+	if !l.hasType(link) {
+		return nil, l.wrongTypeError(link)
+	}
+	return l.agentLink(link), nil
 }
 
-func (l *agentLinkRetriever) createLink(ctx context.Context, dummyDevice *netlink.Dummy) (netlink.Link, error) {
+func (l *agentLinkRetriever) createLink(ctx context.Context) (netlink.Link, error) {
 	log := logger.FromContext(ctx)
 
-	err := l.netlinkHandle.LinkAdd(dummyDevice)
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = l.opts.Name
+	var device netlink.Link = &netlink.Dummy{LinkAttrs: attrs}
+	if l.opts.Type == LinkTypeVeth {
+		device = &netlink.Veth{LinkAttrs: attrs, PeerName: l.opts.PeerName}
+	}
+
+	err := l.netlinkHandle.LinkAdd(device)
 	if err != nil {
-		log.Errorf("Unable to create interface %s: %v", dummyDevice.Name, err)
+		log.Errorf("Unable to create interface %s: %v", l.opts.Name, err)
 		return nil, err
 	}
-	return l.netlinkHandle.LinkByName(dummyDevice.Name)
+	if l.opts.Type == LinkTypeVeth {
+		if err = l.setupPeer(ctx); err != nil {
+			// deleting one end of the pair deletes both
+			if delErr := l.netlinkHandle.LinkDel(device); delErr != nil {
+				log.Errorf("Unable to delete interface %s: %v", l.opts.Name, delErr)
+			}
+			return nil, err
+		}
+	}
+	return l.netlinkHandle.LinkByName(l.opts.Name)
+}
+
+// setupPeer moves the other end of a veth link to PeerNetns, or brings it
+// up if it stays in the current namespace so the link has a carrier
+func (l *agentLinkRetriever) setupPeer(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+
+	peer, err := l.netlinkHandle.LinkByName(l.opts.PeerName)
+	if err != nil {
+		return fmt.Errorf("error finding veth peer %s: %w", l.opts.PeerName, err)
+	}
+	if l.opts.PeerNetns == "" {
+		return l.netlinkHandle.LinkSetUp(peer)
+	}
+
+	ns, err := os.Open(l.opts.PeerNetns)
+	if err != nil {
+		return fmt.Errorf("unable to open namespace %s: %w", l.opts.PeerNetns, err)
+	}
+	defer ns.Close()
+	log.Infof("Moving veth peer %s to namespace %s", l.opts.PeerName, l.opts.PeerNetns)
+	if err = l.netlinkHandle.LinkSetNsFd(peer, int(ns.Fd())); err != nil {
+		return fmt.Errorf("unable to move veth peer %s to namespace %s: %w", l.opts.PeerName, l.opts.PeerNetns, err)
+	}
+	return nil
+}
+
+// hasType checks if link is of the configured type
+func (l *agentLinkRetriever) hasType(link netlink.Link) bool {
+	switch l.opts.Type {
+	case LinkTypeLoopback:
+		return link.Attrs().Flags&net.FlagLoopback != 0
+	default:
+		return link.Type() == string(l.opts.Type)
+	}
+}
+
+func (l *agentLinkRetriever) wrongTypeError(link netlink.Link) error {
+	return fmt.Errorf("%w: %s is a %s link but the agent uses a %s link, delete it or enable the link type migration",
+		ErrWrongLinkType, link.Attrs().Name, link.Type(), l.opts.Type)
+}
+
+func (l *agentLinkRetriever) agentLink(link netlink.Link) *agentLink {
+	return &agentLink{
+		netlinkHandle: l.netlinkHandle,
+		link:          link,
+		opts:          l.opts,
+	}
 }
 
+// The address flags of unix.IFA_F_DADFAILED and unix.IFA_F_TENTATIVE,
+// which are only defined on linux
+const (
+	addrFlagDadFailed = 0x08
+	addrFlagTentative = 0x40
+)
+
 type agentLink struct {
 	netlinkHandle NetlinkHandle
 	link          netlink.Link
+	opts          LinkOpts
 }
 
 // SetupForAddrFamily adds the given addr to the interface if its not already
@@ -102,6 +250,83 @@ func (l *agentLink) BringUp(ctx context.Context) error {
 	return l.netlinkHandle.LinkSetUp(l.link)
 }
 
+// TeardownForAddrFamily removes the given addr from the interface if it's
+// there
+func (l *agentLink) TeardownForAddrFamily(ctx context.Context, addrFamily AddrFamily) error {
+	log := logger.FromContext(ctx)
+
+	if addrFamily.LinkLocalAddr == nil {
+		return fmt.Errorf("family 0x%02x does not specify a link-local addr to remove", addrFamily.Family)
+	}
+
+	addrList, err := l.netlinkHandle.AddrList(l.link, addrFamily.Family)
+	if err != nil {
+		return fmt.Errorf("unable to read address list: %w", err)
+	}
+	for _, addr := range addrList {
+		if addr.IPNet == nil || !addr.IP.Equal(addrFamily.LinkLocalAddr.IP) {
+			continue
+		}
+		log.Infof("Removing IP %s from %s", addr.IPNet, l.link.Attrs().Name)
+		if err = l.netlinkHandle.AddrDel(l.link, &addr); err != nil {
+			return fmt.Errorf("unable to remove IP %s: %w", addr.IPNet, err)
+		}
+		return nil
+	}
+
+	log.Infof("IP %s not found on interface %s, continuing", addrFamily.LinkLocalAddr, l.link.Attrs().Name)
+	return nil
+}
+
+// Delete is the equivalent of calling `ip link del interface`, the
+// loopback link is left in place
+func (l *agentLink) Delete(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	if l.opts.Type == LinkTypeLoopback {
+		log.Infof("Leaving loopback link %s in place", l.link.Attrs().Name)
+		return nil
+	}
+	log.Infof("Deleting link: %s", l.link.Attrs().Name)
+	err := l.netlinkHandle.LinkDel(l.link)
+	if _, errWasLinkNotFound := err.(netlink.LinkNotFoundError); errWasLinkNotFound {
+		log.Infof("Link %s was already deleted", l.link.Attrs().Name)
+		return nil
+	}
+	return err
+}
+
+func (l *agentLink) HasAddrFamily(ctx context.Context, addrFamily AddrFamily) (bool, error) {
+	if addrFamily.LinkLocalAddr == nil {
+		return false, fmt.Errorf("family 0x%02x does not specify a link-local addr", addrFamily.Family)
+	}
+	return l.isIpAttachedToLink(ctx, addrFamily.Family, addrFamily.LinkLocalAddr)
+}
+
+func (l *agentLink) AddrFamilyUsable(ctx context.Context, addrFamily AddrFamily) (bool, error) {
+	if addrFamily.LinkLocalAddr == nil {
+		return false, fmt.Errorf("family 0x%02x does not specify a link-local addr", addrFamily.Family)
+	}
+	addrList, err := l.netlinkHandle.AddrList(l.link, addrFamily.Family)
+	if err != nil {
+		return false, fmt.Errorf("unable to read address list: %w", err)
+	}
+	for _, addr := range addrList {
+		if addr.IPNet == nil || !addr.Contains(addrFamily.LinkLocalAddr.IP) {
+			continue
+		}
+		if addr.Flags&addrFlagDadFailed != 0 {
+			return false, fmt.Errorf("duplicate address detection failed for %s on %s, it is in use elsewhere",
+				addrFamily.LinkLocalAddr, l.link.Attrs().Name)
+		}
+		return addr.Flags&addrFlagTentative == 0, nil
+	}
+	return false, nil
+}
+
+func (l *agentLink) IsUp() bool {
+	return l.link.Attrs().Flags&net.FlagUp != 0
+}
+
 func (l *agentLink) Name() string {
 	return l.link.Attrs().Name
 }
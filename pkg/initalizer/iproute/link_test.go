@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -78,6 +80,7 @@ func TestAgentLinkRetriever_CreateOrGetLink(t *testing.T) {
 
 			retriever := &agentLinkRetriever{
 				netlinkHandle: handle,
+				opts:          LinkOpts{Name: configuration.AgentLinkName, Type: LinkTypeDummy},
 			}
 			ctx := context.Background()
 
@@ -253,3 +256,506 @@ func TestAgentLink_SetupForAddrFamily(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentLinkRetriever_GetLink(t *testing.T) {
+	var (
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+	)
+
+	testCases := []struct {
+		name        string
+		handleCalls func(handle *MockNetlinkHandle)
+		error       error
+	}{
+		{
+			name: "returns the link if its there",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(dummyLink, nil)
+			},
+		},
+		{
+			name: "does not create a link if its not there",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, netlink.LinkNotFoundError{})
+			},
+			error: ErrLinkNotFound,
+		},
+		{
+			name: "link of another type",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().LinkByName(configuration.AgentLinkName).
+					Return(&netlink.Veth{LinkAttrs: attrs}, nil)
+			},
+			error: ErrWrongLinkType,
+		},
+		{
+			name: "unknown error stops execution",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, assert.AnError)
+			},
+			error: assert.AnError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			tc.handleCalls(handle)
+			retriever := &agentLinkRetriever{
+				netlinkHandle: handle,
+				opts:          LinkOpts{Name: configuration.AgentLinkName, Type: LinkTypeDummy},
+			}
+
+			// trigger
+			link, err := retriever.GetLink(context.Background())
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(link.Name()).To(Equal(configuration.AgentLinkName))
+			}
+		})
+	}
+}
+
+func TestAgentLink_TeardownForAddrFamily(t *testing.T) {
+	var (
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+
+		_, targetIp, _ = net.ParseCIDR("192.168.1.5/32")
+		targetAddr     = &netlink.Addr{
+			IPNet: targetIp,
+		}
+		_, otherIp, _ = net.ParseCIDR("192.168.1.3/32")
+		otherAddr     = &netlink.Addr{
+			IPNet: otherIp,
+		}
+		_, cidrOverlapWithTargetIp, _ = net.ParseCIDR("192.168.1.3/24")
+		cidrOverlapTargetAddr         = &netlink.Addr{
+			IPNet: cidrOverlapWithTargetIp,
+		}
+	)
+
+	testCases := []struct {
+		name        string
+		handleCalls func(handle *MockNetlinkHandle)
+		addrFamily  AddrFamily
+		error       error
+	}{
+		{
+			name: "removes the addr if the interface has it",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().AddrList(dummyLink, 1).
+						Return([]netlink.Addr{*otherAddr, *targetAddr}, nil),
+					handle.EXPECT().AddrDel(dummyLink, targetAddr).
+						Return(nil),
+				)
+			},
+			addrFamily: AddrFamily{
+				LinkLocalAddr: targetAddr,
+				Family:        1,
+			},
+		},
+		{
+			name: "does nothing if the interface doesnt have it",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().AddrList(dummyLink, 1).
+					Return([]netlink.Addr{*otherAddr}, nil)
+			},
+			addrFamily: AddrFamily{
+				LinkLocalAddr: targetAddr,
+				Family:        1,
+			},
+		},
+		{
+			name: "does not remove overlapping cidrs it did not add",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().AddrList(dummyLink, 1).
+					Return([]netlink.Addr{*cidrOverlapTargetAddr}, nil)
+			},
+			addrFamily: AddrFamily{
+				LinkLocalAddr: targetAddr,
+				Family:        1,
+			},
+		},
+		{
+			name: "stops execution if listing addresses fails",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().AddrList(dummyLink, 1).
+					Return(nil, assert.AnError)
+			},
+			addrFamily: AddrFamily{
+				LinkLocalAddr: targetAddr,
+				Family:        1,
+			},
+			error: assert.AnError,
+		},
+		{
+			name: "stops execution if removing address fails",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().AddrList(dummyLink, 1).
+						Return([]netlink.Addr{*targetAddr}, nil),
+					handle.EXPECT().AddrDel(dummyLink, targetAddr).
+						Return(assert.AnError),
+				)
+			},
+			addrFamily: AddrFamily{
+				LinkLocalAddr: targetAddr,
+				Family:        1,
+			},
+			error: assert.AnError,
+		},
+		{
+			name: "link-local addr must be specified",
+			addrFamily: AddrFamily{
+				Family: 1,
+			},
+			error: fmt.Errorf("family 0x01 does not specify a link-local addr to remove"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			if tc.handleCalls != nil {
+				tc.handleCalls(handle)
+			}
+
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+			}
+			ctx := context.Background()
+
+			// trigger
+			err := al.TeardownForAddrFamily(ctx, tc.addrFamily)
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestAgentLink_Delete(t *testing.T) {
+	var (
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+	)
+
+	testCases := []struct {
+		name      string
+		deleteErr error
+		error     error
+	}{
+		{
+			name: "deletes the link",
+		},
+		{
+			name:      "link was already deleted",
+			deleteErr: netlink.LinkNotFoundError{},
+		},
+		{
+			name:      "deletion fails",
+			deleteErr: assert.AnError,
+			error:     assert.AnError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			handle.EXPECT().LinkDel(dummyLink).Return(tc.deleteErr)
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+			}
+
+			// trigger
+			err := al.Delete(context.Background())
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestAgentLinkRetriever_CreateOrGetLink_LinkTypes(t *testing.T) {
+	var (
+		attrs        = netlink.LinkAttrs{Name: configuration.AgentLinkName}
+		dummyLink    = &netlink.Dummy{LinkAttrs: attrs}
+		vethLink     = &netlink.Veth{LinkAttrs: attrs}
+		peerLink     = &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "peer0"}}
+		loopbackLink = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: LoopbackLinkName, Flags: net.FlagLoopback}}
+		netnsPath    = filepath.Join(t.TempDir(), "netns")
+	)
+	if err := os.WriteFile(netnsPath, nil, 0600); err != nil {
+		t.Fatalf("unable to write netns file: %v", err)
+	}
+
+	testCases := []struct {
+		name         string
+		opts         LinkOpts
+		handleCalls  func(handle *MockNetlinkHandle)
+		expectedName string
+		error        error
+	}{
+		{
+			name: "creates a veth pair with the peer in the current namespace",
+			opts: LinkOpts{Type: LinkTypeVeth},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, netlink.LinkNotFoundError{}),
+					handle.EXPECT().LinkAdd(&vethMatcher{peerName: "peer0"}).Return(nil),
+					handle.EXPECT().LinkByName("peer0").Return(peerLink, nil),
+					handle.EXPECT().LinkSetUp(peerLink).Return(nil),
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(vethLink, nil),
+				)
+			},
+			expectedName: configuration.AgentLinkName,
+		},
+		{
+			name: "moves the veth peer to its namespace",
+			opts: LinkOpts{Type: LinkTypeVeth, PeerNetns: netnsPath},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, netlink.LinkNotFoundError{}),
+					handle.EXPECT().LinkAdd(&vethMatcher{peerName: "peer0"}).Return(nil),
+					handle.EXPECT().LinkByName("peer0").Return(peerLink, nil),
+					handle.EXPECT().LinkSetNsFd(peerLink, gomock.Any()).Return(nil),
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(vethLink, nil),
+				)
+			},
+			expectedName: configuration.AgentLinkName,
+		},
+		{
+			name: "deletes the veth pair if the peer cannot be moved",
+			opts: LinkOpts{Type: LinkTypeVeth, PeerNetns: netnsPath},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, netlink.LinkNotFoundError{}),
+					handle.EXPECT().LinkAdd(gomock.Any()).Return(nil),
+					handle.EXPECT().LinkByName("peer0").Return(peerLink, nil),
+					handle.EXPECT().LinkSetNsFd(peerLink, gomock.Any()).Return(assert.AnError),
+					handle.EXPECT().LinkDel(&vethMatcher{peerName: "peer0"}).Return(nil),
+				)
+			},
+			error: assert.AnError,
+		},
+		{
+			name: "fails if the veth peer namespace does not exist",
+			opts: LinkOpts{Type: LinkTypeVeth, PeerNetns: filepath.Join(t.TempDir(), "missing")},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, netlink.LinkNotFoundError{}),
+					handle.EXPECT().LinkAdd(gomock.Any()).Return(nil),
+					handle.EXPECT().LinkByName("peer0").Return(peerLink, nil),
+					handle.EXPECT().LinkDel(gomock.Any()).Return(nil),
+				)
+			},
+			error: os.ErrNotExist,
+		},
+		{
+			name: "existing link of another type",
+			opts: LinkOpts{Type: LinkTypeVeth},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(dummyLink, nil)
+			},
+			error: ErrWrongLinkType,
+		},
+		{
+			name: "migrates an existing link of another type",
+			opts: LinkOpts{Type: LinkTypeVeth, MigrateType: true},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(dummyLink, nil),
+					handle.EXPECT().LinkDel(dummyLink).Return(nil),
+					handle.EXPECT().LinkAdd(&vethMatcher{peerName: "peer0"}).Return(nil),
+					handle.EXPECT().LinkByName("peer0").Return(peerLink, nil),
+					handle.EXPECT().LinkSetUp(peerLink).Return(nil),
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(vethLink, nil),
+				)
+			},
+			expectedName: configuration.AgentLinkName,
+		},
+		{
+			name: "uses the loopback link",
+			opts: LinkOpts{Type: LinkTypeLoopback},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(nil, netlink.LinkNotFoundError{}),
+					handle.EXPECT().LinkByName(LoopbackLinkName).Return(loopbackLink, nil),
+				)
+			},
+			expectedName: LoopbackLinkName,
+		},
+		{
+			name: "link left over from another type with loopback",
+			opts: LinkOpts{Type: LinkTypeLoopback},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(dummyLink, nil)
+			},
+			error: ErrWrongLinkType,
+		},
+		{
+			name: "migrates a link left over from another type to loopback",
+			opts: LinkOpts{Type: LinkTypeLoopback, MigrateType: true},
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().LinkByName(configuration.AgentLinkName).Return(dummyLink, nil),
+					handle.EXPECT().LinkDel(dummyLink).Return(nil),
+					handle.EXPECT().LinkByName(LoopbackLinkName).Return(loopbackLink, nil),
+				)
+			},
+			expectedName: LoopbackLinkName,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			tc.handleCalls(handle)
+			tc.opts.PeerName = "peer0"
+			retriever := NewAgentLinkRetriever(handle, tc.opts)
+
+			// trigger
+			link, err := retriever.CreateOrGetLink(context.Background())
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(link.Name()).To(Equal(tc.expectedName))
+			}
+		})
+	}
+}
+
+func TestAgentLink_Delete_Loopback(t *testing.T) {
+	g := NewWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// setup, no call is expected on the handle
+	handle := NewMockNetlinkHandle(ctrl)
+	al := &agentLink{
+		link:          &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: LoopbackLinkName, Flags: net.FlagLoopback}},
+		netlinkHandle: handle,
+		opts:          LinkOpts{Type: LinkTypeLoopback},
+	}
+
+	// trigger
+	err := al.Delete(context.Background())
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
+func TestAgentLink_AddrFamilyUsable(t *testing.T) {
+	var (
+		attrs      = netlink.LinkAttrs{Name: configuration.AgentLinkName}
+		dummyLink  = &netlink.Dummy{LinkAttrs: attrs}
+		_, ip, _   = net.ParseCIDR("fd00:ec2::23/128")
+		targetAddr = &netlink.Addr{IPNet: ip}
+	)
+
+	testCases := []struct {
+		name           string
+		addrs          []netlink.Addr
+		expectedUsable bool
+		error          string
+	}{
+		{
+			name:           "address is usable",
+			addrs:          []netlink.Addr{{IPNet: ip}},
+			expectedUsable: true,
+		},
+		{
+			name:  "address is tentative",
+			addrs: []netlink.Addr{{IPNet: ip, Flags: addrFlagTentative}},
+		},
+		{
+			name: "address is not attached",
+		},
+		{
+			name:  "duplicate address detection failed",
+			addrs: []netlink.Addr{{IPNet: ip, Flags: addrFlagTentative | addrFlagDadFailed}},
+			error: "duplicate address detection failed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			handle.EXPECT().AddrList(dummyLink, 10).Return(tc.addrs, nil)
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+			}
+
+			// trigger
+			usable, err := al.AddrFamilyUsable(context.Background(), AddrFamily{Family: 10, LinkLocalAddr: targetAddr})
+
+			// validate
+			if tc.error != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.error)))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(usable).To(Equal(tc.expectedUsable))
+			}
+		})
+	}
+}
+
+// vethMatcher matches veth links with the given peer
+type vethMatcher struct {
+	peerName string
+}
+
+func (m *vethMatcher) Matches(x interface{}) bool {
+	veth, ok := x.(*netlink.Veth)
+	return ok && veth.PeerName == m.peerName
+}
+
+func (m *vethMatcher) String() string {
+	return fmt.Sprintf("is a veth link with peer %s", m.peerName)
+}
@@ -11,11 +11,20 @@ type (
 		LinkByName(name string) (netlink.Link, error)
 		LinkAdd(link netlink.Link) error
 		LinkSetUp(link netlink.Link) error
+		LinkDel(link netlink.Link) error
+		LinkSetNsFd(link netlink.Link, fd int) error
 
 		AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
 		AddrAdd(link netlink.Link, addr *netlink.Addr) error
+		AddrDel(link netlink.Link, addr *netlink.Addr) error
 
 		RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+		RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
 		RouteAdd(route *netlink.Route) error
+		RouteDel(route *netlink.Route) error
+
+		RuleList(family int) ([]netlink.Rule, error)
+		RuleAdd(rule *netlink.Rule) error
+		RuleDel(rule *netlink.Rule) error
 	}
 )
@@ -65,6 +65,20 @@ func (mr *MockNetlinkHandleMockRecorder) AddrAdd(link, addr any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddrAdd", reflect.TypeOf((*MockNetlinkHandle)(nil).AddrAdd), link, addr)
 }
 
+// AddrDel mocks base method.
+func (m *MockNetlinkHandle) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddrDel", link, addr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddrDel indicates an expected call of AddrDel.
+func (mr *MockNetlinkHandleMockRecorder) AddrDel(link, addr any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddrDel", reflect.TypeOf((*MockNetlinkHandle)(nil).AddrDel), link, addr)
+}
+
 // AddrList mocks base method.
 func (m *MockNetlinkHandle) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
 	m.ctrl.T.Helper()
@@ -109,6 +123,34 @@ func (mr *MockNetlinkHandleMockRecorder) LinkByName(name any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkByName", reflect.TypeOf((*MockNetlinkHandle)(nil).LinkByName), name)
 }
 
+// LinkDel mocks base method.
+func (m *MockNetlinkHandle) LinkDel(link netlink.Link) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkDel", link)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkDel indicates an expected call of LinkDel.
+func (mr *MockNetlinkHandleMockRecorder) LinkDel(link any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkDel", reflect.TypeOf((*MockNetlinkHandle)(nil).LinkDel), link)
+}
+
+// LinkSetNsFd mocks base method.
+func (m *MockNetlinkHandle) LinkSetNsFd(link netlink.Link, fd int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkSetNsFd", link, fd)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkSetNsFd indicates an expected call of LinkSetNsFd.
+func (mr *MockNetlinkHandleMockRecorder) LinkSetNsFd(link, fd any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkSetNsFd", reflect.TypeOf((*MockNetlinkHandle)(nil).LinkSetNsFd), link, fd)
+}
+
 // LinkSetUp mocks base method.
 func (m *MockNetlinkHandle) LinkSetUp(link netlink.Link) error {
 	m.ctrl.T.Helper()
@@ -137,6 +179,20 @@ func (mr *MockNetlinkHandleMockRecorder) RouteAdd(route any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouteAdd", reflect.TypeOf((*MockNetlinkHandle)(nil).RouteAdd), route)
 }
 
+// RouteDel mocks base method.
+func (m *MockNetlinkHandle) RouteDel(route *netlink.Route) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RouteDel", route)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RouteDel indicates an expected call of RouteDel.
+func (mr *MockNetlinkHandleMockRecorder) RouteDel(route any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouteDel", reflect.TypeOf((*MockNetlinkHandle)(nil).RouteDel), route)
+}
+
 // RouteList mocks base method.
 func (m *MockNetlinkHandle) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
 	m.ctrl.T.Helper()
@@ -151,3 +207,61 @@ func (mr *MockNetlinkHandleMockRecorder) RouteList(link, family any) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouteList", reflect.TypeOf((*MockNetlinkHandle)(nil).RouteList), link, family)
 }
+
+// RouteListFiltered mocks base method.
+func (m *MockNetlinkHandle) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RouteListFiltered", family, filter, filterMask)
+	ret0, _ := ret[0].([]netlink.Route)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RouteListFiltered indicates an expected call of RouteListFiltered.
+func (mr *MockNetlinkHandleMockRecorder) RouteListFiltered(family, filter, filterMask any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouteListFiltered", reflect.TypeOf((*MockNetlinkHandle)(nil).RouteListFiltered), family, filter, filterMask)
+}
+
+// RuleAdd mocks base method.
+func (m *MockNetlinkHandle) RuleAdd(rule *netlink.Rule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RuleAdd", rule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RuleAdd indicates an expected call of RuleAdd.
+func (mr *MockNetlinkHandleMockRecorder) RuleAdd(rule any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuleAdd", reflect.TypeOf((*MockNetlinkHandle)(nil).RuleAdd), rule)
+}
+
+// RuleDel mocks base method.
+func (m *MockNetlinkHandle) RuleDel(rule *netlink.Rule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RuleDel", rule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RuleDel indicates an expected call of RuleDel.
+func (mr *MockNetlinkHandleMockRecorder) RuleDel(rule any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuleDel", reflect.TypeOf((*MockNetlinkHandle)(nil).RuleDel), rule)
+}
+
+// RuleList mocks base method.
+func (m *MockNetlinkHandle) RuleList(family int) ([]netlink.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RuleList", family)
+	ret0, _ := ret[0].([]netlink.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RuleList indicates an expected call of RuleList.
+func (mr *MockNetlinkHandleMockRecorder) RuleList(family any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuleList", reflect.TypeOf((*MockNetlinkHandle)(nil).RuleList), family)
+}
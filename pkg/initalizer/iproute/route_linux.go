@@ -6,17 +6,15 @@ import (
 
 	"github.com/vishvananda/netlink"
 	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+	"golang.org/x/sys/unix"
 )
 
 func (l *agentLink) SetupRouteTableForAddrFamily(ctx context.Context, family AddrFamily) error {
 	log := logger.FromContext(ctx)
 
-	newRoute := &netlink.Route{
-		LinkIndex: l.link.Attrs().Index,
-		Dst:       family.LinkLocalAddr.IPNet,
-	}
+	newRoute := l.agentRoute(family)
 
-	routeList, err := l.netlinkHandle.RouteList(nil, family.Family)
+	routeList, err := l.routeList(family.Family)
 	if err != nil {
 		return fmt.Errorf("unable to fetch newRoute list for interface %s: %w", l.link.Attrs().Name, err)
 	}
@@ -29,7 +27,7 @@ func (l *agentLink) SetupRouteTableForAddrFamily(ctx context.Context, family Add
 				return err
 			}
 			log.Infof("Route (dst: %v, iface idx: %v) already exists, skipping creation", existingRoute.Dst, existingRoute.LinkIndex)
-			return nil
+			return l.setupRule(ctx, family)
 		} else {
 			log.Tracef("Discarding route %v as it doesnt contain %v", existingRoute.Dst, family.LinkLocalAddr.IP)
 		}
@@ -41,9 +39,232 @@ func (l *agentLink) SetupRouteTableForAddrFamily(ctx context.Context, family Add
 	}
 	log.Infof("Created newRoute (dst: %v, iface idx: %v)", newRoute.Dst, newRoute.LinkIndex)
 
+	return l.setupRule(ctx, family)
+}
+
+// setupRule adds the rule looking up the route table for traffic to the
+// family addr, warning about rules that shadow it
+func (l *agentLink) setupRule(ctx context.Context, family AddrFamily) error {
+	if !l.usesRouteTable() {
+		return nil
+	}
+	log := logger.FromContext(ctx)
+
+	shadowingRules, err := l.ShadowingRulesForAddrFamily(ctx, family)
+	if err != nil {
+		return err
+	}
+	for _, rule := range shadowingRules {
+		log.Warnf("Rule %d (from %v to %v table %d) is evaluated before the agent rule and may send traffic to %v elsewhere",
+			rule.Priority, rule.Src, rule.Dst, rule.Table, family.LinkLocalAddr)
+	}
+
+	hasRule, err := l.HasRuleForAddrFamily(ctx, family)
+	if err != nil || hasRule {
+		return err
+	}
+	rule := l.agentRule(family)
+	if err = l.netlinkHandle.RuleAdd(rule); err != nil {
+		return fmt.Errorf("unable to create rule for addr %v: %w", family.LinkLocalAddr, err)
+	}
+	log.Infof("Created rule (to: %v, table: %d, priority: %d)", rule.Dst, rule.Table, rule.Priority)
+	return nil
+}
+
+// TeardownRouteTableForAddrFamily removes the route to the family addr
+// through the interface. Routes to the addr through other interfaces are
+// left in place as they were not created by the agent.
+func (l *agentLink) TeardownRouteTableForAddrFamily(ctx context.Context, family AddrFamily) error {
+	log := logger.FromContext(ctx)
+
+	agentRoute := l.agentRoute(family)
+
+	routeList, err := l.routeList(family.Family)
+	if err != nil {
+		return fmt.Errorf("unable to fetch route list for interface %s: %w", l.link.Attrs().Name, err)
+	}
+
+	for _, existingRoute := range routeList {
+		if !dstRoutesEq(&existingRoute, agentRoute) {
+			continue
+		}
+		if existingRoute.LinkIndex != agentRoute.LinkIndex {
+			log.Warnf("Leaving route (dst: %v, iface idx: %v) as it does not go through %s",
+				existingRoute.Dst, existingRoute.LinkIndex, l.link.Attrs().Name)
+			continue
+		}
+		if err = l.netlinkHandle.RouteDel(&existingRoute); err != nil {
+			return fmt.Errorf("unable to remove route for addr %v: %w", family.LinkLocalAddr, err)
+		}
+		log.Infof("Removed route (dst: %v, iface idx: %v)", existingRoute.Dst, existingRoute.LinkIndex)
+		return nil
+	}
+
+	log.Infof("Route to %v not found, continuing", family.LinkLocalAddr)
+	return nil
+}
+
+func (l *agentLink) HasRouteForAddrFamily(ctx context.Context, family AddrFamily) (bool, error) {
+	agentRoute := l.agentRoute(family)
+
+	routeList, err := l.routeList(family.Family)
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch route list for interface %s: %w", l.link.Attrs().Name, err)
+	}
+
+	for _, existingRoute := range routeList {
+		if dstRoutesEq(&existingRoute, agentRoute) {
+			return true, l.validateRouteLinkMatch(existingRoute)
+		}
+	}
+	return false, nil
+}
+
+func (l *agentLink) ConflictingRoutesForAddrFamily(ctx context.Context, family AddrFamily) ([]netlink.Route, error) {
+	agentRoute := l.agentRoute(family)
+
+	routeList, err := l.routeList(family.Family)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch route list for interface %s: %w", l.link.Attrs().Name, err)
+	}
+
+	var conflicts []netlink.Route
+	for _, existingRoute := range routeList {
+		if dstRoutesEq(&existingRoute, agentRoute) && l.validateRouteLinkMatch(existingRoute) != nil {
+			conflicts = append(conflicts, existingRoute)
+		}
+	}
+	return conflicts, nil
+}
+
+// TeardownRuleForAddrFamily removes the rule added along the route to the
+// family addr, rules do not refer to the link so it is not needed
+func (l *agentLinkRetriever) TeardownRuleForAddrFamily(ctx context.Context, family AddrFamily) error {
+	return l.agentLink(nil).teardownRule(ctx, family)
+}
+
+// teardownRule removes the rule added by setupRule, if any
+func (l *agentLink) teardownRule(ctx context.Context, family AddrFamily) error {
+	if !l.usesRouteTable() {
+		return nil
+	}
+	log := logger.FromContext(ctx)
+
+	hasRule, err := l.HasRuleForAddrFamily(ctx, family)
+	if err != nil {
+		return err
+	}
+	if !hasRule {
+		log.Infof("Rule to %v not found, continuing", family.LinkLocalAddr)
+		return nil
+	}
+	rule := l.agentRule(family)
+	if err = l.netlinkHandle.RuleDel(rule); err != nil {
+		return fmt.Errorf("unable to remove rule for addr %v: %w", family.LinkLocalAddr, err)
+	}
+	log.Infof("Removed rule (to: %v, table: %d, priority: %d)", rule.Dst, rule.Table, rule.Priority)
 	return nil
 }
 
+func (l *agentLink) HasRuleForAddrFamily(ctx context.Context, family AddrFamily) (bool, error) {
+	if !l.usesRouteTable() {
+		return true, nil
+	}
+	rules, err := l.netlinkHandle.RuleList(family.Family)
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch rule list: %w", err)
+	}
+	for _, rule := range rules {
+		if rule.Table == l.opts.RouteTable && rule.Priority == l.opts.RulePriority &&
+			rule.Src == nil && rule.Dst != nil && rule.Dst.String() == family.LinkLocalAddr.IPNet.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ShadowingRulesForAddrFamily finds the rules with a lower priority than the
+// agent one that match traffic to the family addr and look up a table with
+// a route to it. The local table is skipped, it only delivers traffic to
+// the addresses of the host, like the agent ones.
+func (l *agentLink) ShadowingRulesForAddrFamily(ctx context.Context, family AddrFamily) ([]netlink.Rule, error) {
+	if !l.usesRouteTable() {
+		return nil, nil
+	}
+	rules, err := l.netlinkHandle.RuleList(family.Family)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch rule list: %w", err)
+	}
+
+	var shadowing []netlink.Rule
+	for _, rule := range rules {
+		// rules without priority are evaluated first
+		priority := max(rule.Priority, 0)
+		if priority >= l.opts.RulePriority || rule.Table == l.opts.RouteTable ||
+			rule.Table == unix.RT_TABLE_LOCAL || rule.Table == unix.RT_TABLE_UNSPEC {
+			continue
+		}
+		if rule.Dst != nil && !rule.Dst.Contains(family.LinkLocalAddr.IP) {
+			continue
+		}
+		hasRoute, err := l.tableHasRouteTo(rule.Table, family)
+		if err != nil {
+			return nil, err
+		}
+		if hasRoute {
+			shadowing = append(shadowing, rule)
+		}
+	}
+	return shadowing, nil
+}
+
+// tableHasRouteTo checks if any route in table, including default routes,
+// covers the family addr
+func (l *agentLink) tableHasRouteTo(table int, family AddrFamily) (bool, error) {
+	routes, err := l.netlinkHandle.RouteListFiltered(family.Family, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch route list of table %d: %w", table, err)
+	}
+	for _, route := range routes {
+		if route.Dst == nil || route.Dst.Contains(family.LinkLocalAddr.IP) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (l *agentLink) usesRouteTable() bool {
+	return l.opts.RouteTable != 0 && l.opts.RouteTable != unix.RT_TABLE_MAIN
+}
+
+// routeList lists the routes in the table the agent routes are added to
+func (l *agentLink) routeList(family int) ([]netlink.Route, error) {
+	if !l.usesRouteTable() {
+		return l.netlinkHandle.RouteList(nil, family)
+	}
+	return l.netlinkHandle.RouteListFiltered(family, &netlink.Route{Table: l.opts.RouteTable}, netlink.RT_FILTER_TABLE)
+}
+
+func (l *agentLink) agentRoute(family AddrFamily) *netlink.Route {
+	route := &netlink.Route{
+		LinkIndex: l.link.Attrs().Index,
+		Dst:       family.LinkLocalAddr.IPNet,
+	}
+	if l.usesRouteTable() {
+		route.Table = l.opts.RouteTable
+	}
+	return route
+}
+
+func (l *agentLink) agentRule(family AddrFamily) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = family.Family
+	rule.Dst = family.LinkLocalAddr.IPNet
+	rule.Table = l.opts.RouteTable
+	rule.Priority = l.opts.RulePriority
+	return rule
+}
+
 func (l *agentLink) validateRouteLinkMatch(existingRoute netlink.Route) error {
 	if existingRoute.LinkIndex != l.link.Attrs().Index {
 		return fmt.Errorf("expected route %s to be interface index %d but is %d, please remove route and try again",
@@ -11,6 +11,7 @@ import (
 	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
 	_ "go.amzn.com/eks/eks-pod-identity-agent/internal/test"
 	"go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
 )
 
 func TestAgentLink_SetupRouteTableForAddrFamily(t *testing.T) {
@@ -134,3 +135,455 @@ func TestAgentLink_SetupRouteTableForAddrFamily(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentLink_TeardownRouteTableForAddrFamily(t *testing.T) {
+	var (
+		linkIdx   = 1
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName, Index: linkIdx}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+
+		_, targetIp, _ = net.ParseCIDR("192.168.1.5/32")
+		targetAddr     = &netlink.Addr{
+			IPNet: targetIp,
+		}
+		targetAddrFamily = AddrFamily{
+			LinkLocalAddr: targetAddr,
+			Family:        1,
+		}
+
+		agentRoute     = netlink.Route{LinkIndex: linkIdx, Dst: targetIp}
+		otherLinkRoute = netlink.Route{LinkIndex: 2, Dst: targetIp}
+
+		_, otherIp, _ = net.ParseCIDR("192.168.1.3/32")
+		otherRouteDst = netlink.Route{LinkIndex: linkIdx, Dst: otherIp}
+		otherRouteGw  = netlink.Route{LinkIndex: 3, Gw: otherIp.IP}
+	)
+
+	testCases := []struct {
+		name        string
+		handleCalls func(handle *MockNetlinkHandle)
+		error       error
+	}{
+		{
+			name: "removes the route through the agent link",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RouteList(nil, 1).
+						Return([]netlink.Route{otherRouteDst, otherRouteGw, agentRoute}, nil),
+					handle.EXPECT().RouteDel(&agentRoute).
+						Return(nil),
+				)
+			},
+		},
+		{
+			name: "does nothing if there is no route",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().RouteList(nil, 1).
+					Return([]netlink.Route{otherRouteDst, otherRouteGw}, nil)
+			},
+		},
+		{
+			name: "leaves routes through other interfaces",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().RouteList(nil, 1).
+					Return([]netlink.Route{otherLinkRoute}, nil)
+			},
+		},
+		{
+			name: "stops execution if listing routes fails",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().RouteList(nil, 1).
+					Return(nil, fmt.Errorf("some error"))
+			},
+			error: fmt.Errorf("unable to fetch route list for interface pod-id-link0: some error"),
+		},
+		{
+			name: "stops execution if removing the route fails",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RouteList(nil, 1).
+						Return([]netlink.Route{agentRoute}, nil),
+					handle.EXPECT().RouteDel(&agentRoute).
+						Return(fmt.Errorf("some error")),
+				)
+			},
+			error: fmt.Errorf("unable to remove route for addr 192.168.1.5/32: some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			tc.handleCalls(handle)
+
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+			}
+			ctx := context.Background()
+
+			// trigger
+			err := al.TeardownRouteTableForAddrFamily(ctx, targetAddrFamily)
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error.Error()))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestAgentLink_ConflictingRoutesForAddrFamily(t *testing.T) {
+	var (
+		linkIdx   = 1
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName, Index: linkIdx}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+
+		_, targetIp, _ = net.ParseCIDR("192.168.1.5/32")
+		targetAddr     = &netlink.Addr{
+			IPNet: targetIp,
+		}
+		targetAddrFamily = AddrFamily{
+			LinkLocalAddr: targetAddr,
+			Family:        1,
+		}
+
+		agentRoute     = netlink.Route{LinkIndex: linkIdx, Dst: targetIp}
+		otherLinkRoute = netlink.Route{LinkIndex: 2, Dst: targetIp}
+
+		_, otherIp, _ = net.ParseCIDR("192.168.1.3/32")
+		otherRouteDst = netlink.Route{LinkIndex: 2, Dst: otherIp}
+		otherRouteGw  = netlink.Route{LinkIndex: 3, Gw: otherIp.IP}
+	)
+
+	testCases := []struct {
+		name              string
+		routes            []netlink.Route
+		routesErr         error
+		expectedConflicts []netlink.Route
+		error             error
+	}{
+		{
+			name:   "no conflicts with the agent route",
+			routes: []netlink.Route{otherRouteDst, otherRouteGw, agentRoute},
+		},
+		{
+			name:              "finds routes to the addr through other links",
+			routes:            []netlink.Route{otherRouteDst, agentRoute, otherLinkRoute},
+			expectedConflicts: []netlink.Route{otherLinkRoute},
+		},
+		{
+			name:      "stops execution if listing routes fails",
+			routesErr: fmt.Errorf("some error"),
+			error:     fmt.Errorf("unable to fetch route list for interface pod-id-link0: some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			handle.EXPECT().RouteList(nil, 1).Return(tc.routes, tc.routesErr)
+
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+			}
+
+			// trigger
+			conflicts, err := al.ConflictingRoutesForAddrFamily(context.Background(), targetAddrFamily)
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error.Error()))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(conflicts).To(Equal(tc.expectedConflicts))
+			}
+		})
+	}
+}
+
+func TestAgentLink_SetupRouteTableForAddrFamily_RouteTable(t *testing.T) {
+	var (
+		linkIdx   = 1
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName, Index: linkIdx}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+		linkOpts  = LinkOpts{Name: configuration.AgentLinkName, RouteTable: 100, RulePriority: 50}
+
+		_, targetIp, _ = net.ParseCIDR("192.168.1.5/32")
+		targetAddr     = &netlink.Addr{
+			IPNet: targetIp,
+		}
+		targetAddrFamily = AddrFamily{
+			LinkLocalAddr: targetAddr,
+			Family:        1,
+		}
+
+		expectedRoute = netlink.Route{LinkIndex: linkIdx, Dst: targetIp, Table: 100}
+		tableFilter   = &netlink.Route{Table: 100}
+		expectedRule  = netlink.Rule{Priority: 50, Family: 1, Table: 100, Dst: targetIp}
+	)
+
+	testCases := []struct {
+		name        string
+		handleCalls func(handle *MockNetlinkHandle)
+		error       error
+	}{
+		{
+			name: "creates the route in the table and the rule",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RouteListFiltered(1, tableFilter, netlink.RT_FILTER_TABLE).
+						Return(nil, nil),
+					handle.EXPECT().RouteAdd(&expectedRoute).
+						Return(nil),
+					handle.EXPECT().RuleList(1).
+						Return(nil, nil),
+					handle.EXPECT().RuleList(1).
+						Return(nil, nil),
+					handle.EXPECT().RuleAdd(gomock.Any()).
+						DoAndReturn(func(rule *netlink.Rule) error {
+							if rule.Priority != 50 || rule.Table != 100 || rule.Dst.String() != targetIp.String() {
+								return fmt.Errorf("unexpected rule %v", rule)
+							}
+							return nil
+						}),
+				)
+			},
+		},
+		{
+			name: "doesn't create the route nor the rule if they exist",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RouteListFiltered(1, tableFilter, netlink.RT_FILTER_TABLE).
+						Return([]netlink.Route{expectedRoute}, nil),
+					handle.EXPECT().RuleList(1).
+						Return([]netlink.Rule{expectedRule}, nil),
+					handle.EXPECT().RuleList(1).
+						Return([]netlink.Rule{expectedRule}, nil),
+				)
+			},
+		},
+		{
+			name: "stops execution if the rule cannot be created",
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RouteListFiltered(1, tableFilter, netlink.RT_FILTER_TABLE).
+						Return([]netlink.Route{expectedRoute}, nil),
+					handle.EXPECT().RuleList(1).
+						Return(nil, nil),
+					handle.EXPECT().RuleList(1).
+						Return(nil, nil),
+					handle.EXPECT().RuleAdd(gomock.Any()).
+						Return(fmt.Errorf("some error")),
+				)
+			},
+			error: fmt.Errorf("unable to create rule for addr 192.168.1.5/32: some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			tc.handleCalls(handle)
+
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+				opts:          linkOpts,
+			}
+
+			// trigger
+			err := al.SetupRouteTableForAddrFamily(context.Background(), targetAddrFamily)
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error.Error()))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestAgentLink_ShadowingRulesForAddrFamily(t *testing.T) {
+	var (
+		attrs     = netlink.LinkAttrs{Name: configuration.AgentLinkName, Index: 1}
+		dummyLink = &netlink.Dummy{LinkAttrs: attrs}
+		linkOpts  = LinkOpts{Name: configuration.AgentLinkName, RouteTable: 100, RulePriority: 1000}
+
+		_, targetIp, _   = net.ParseCIDR("169.254.170.23/32")
+		targetAddrFamily = AddrFamily{
+			LinkLocalAddr: &netlink.Addr{IPNet: targetIp},
+			Family:        1,
+		}
+
+		_, podIp, _      = net.ParseCIDR("10.0.1.5/32")
+		_, vpcCidr, _    = net.ParseCIDR("10.0.0.0/16")
+		_, defaultDst, _ = net.ParseCIDR("0.0.0.0/0")
+		localRule        = netlink.Rule{Priority: 0, Table: unix.RT_TABLE_LOCAL}
+		agentRule        = netlink.Rule{Priority: 1000, Table: 100, Dst: targetIp}
+		toVpcRule        = netlink.Rule{Priority: 512, Table: unix.RT_TABLE_MAIN, Dst: vpcCidr}
+		fromPodRule      = netlink.Rule{Priority: 536, Table: 2, Src: podIp}
+		laterFromPodRule = netlink.Rule{Priority: 1536, Table: 2, Src: podIp}
+		mainRule         = netlink.Rule{Priority: 32766, Table: unix.RT_TABLE_MAIN}
+		eniDefaultRoute  = netlink.Route{LinkIndex: 3, Dst: defaultDst, Table: 2}
+		table2Filter     = &netlink.Route{Table: 2}
+	)
+
+	testCases := []struct {
+		name             string
+		rules            []netlink.Rule
+		table2Routes     []netlink.Route
+		expectedRules    []netlink.Rule
+		expectedErrorMsg string
+	}{
+		{
+			name:  "rules not matching the addr or evaluated later do not shadow",
+			rules: []netlink.Rule{localRule, toVpcRule, agentRule, laterFromPodRule, mainRule},
+		},
+		{
+			name:          "rule evaluated before looking up a table with a default route",
+			rules:         []netlink.Rule{localRule, fromPodRule, agentRule, mainRule},
+			table2Routes:  []netlink.Route{eniDefaultRoute},
+			expectedRules: []netlink.Rule{fromPodRule},
+		},
+		{
+			name:         "rule evaluated before looking up a table without a route to the addr",
+			rules:        []netlink.Rule{localRule, fromPodRule, agentRule, mainRule},
+			table2Routes: []netlink.Route{{LinkIndex: 3, Dst: vpcCidr, Table: 2}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			handle.EXPECT().RuleList(1).Return(tc.rules, nil)
+			handle.EXPECT().RouteListFiltered(1, table2Filter, netlink.RT_FILTER_TABLE).
+				Return(tc.table2Routes, nil).AnyTimes()
+
+			al := &agentLink{
+				link:          dummyLink,
+				netlinkHandle: handle,
+				opts:          linkOpts,
+			}
+
+			// trigger
+			rules, err := al.ShadowingRulesForAddrFamily(context.Background(), targetAddrFamily)
+
+			// validate
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(rules).To(Equal(tc.expectedRules))
+		})
+	}
+}
+
+func TestAgentLinkRetriever_TeardownRuleForAddrFamily(t *testing.T) {
+	var (
+		linkOpts = LinkOpts{Name: configuration.AgentLinkName, RouteTable: 100, RulePriority: 50}
+
+		_, targetIp, _   = net.ParseCIDR("192.168.1.5/32")
+		targetAddrFamily = AddrFamily{
+			LinkLocalAddr: &netlink.Addr{IPNet: targetIp},
+			Family:        1,
+		}
+
+		agentRule = netlink.Rule{Priority: 50, Family: 1, Table: 100, Dst: targetIp}
+	)
+
+	testCases := []struct {
+		name        string
+		opts        LinkOpts
+		handleCalls func(handle *MockNetlinkHandle)
+		error       error
+	}{
+		{
+			name: "removes the rule without the link",
+			opts: linkOpts,
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RuleList(1).
+						Return([]netlink.Rule{agentRule}, nil),
+					handle.EXPECT().RuleDel(gomock.Any()).
+						DoAndReturn(func(rule *netlink.Rule) error {
+							if rule.Priority != 50 || rule.Table != 100 || rule.Dst.String() != targetIp.String() {
+								return fmt.Errorf("unexpected rule %v", rule)
+							}
+							return nil
+						}),
+				)
+			},
+		},
+		{
+			name: "does nothing if there is no rule",
+			opts: linkOpts,
+			handleCalls: func(handle *MockNetlinkHandle) {
+				handle.EXPECT().RuleList(1).
+					Return(nil, nil)
+			},
+		},
+		{
+			name:        "does nothing if the routes are in the main table",
+			opts:        LinkOpts{Name: configuration.AgentLinkName},
+			handleCalls: func(handle *MockNetlinkHandle) {},
+		},
+		{
+			name: "stops execution if removing the rule fails",
+			opts: linkOpts,
+			handleCalls: func(handle *MockNetlinkHandle) {
+				gomock.InOrder(
+					handle.EXPECT().RuleList(1).
+						Return([]netlink.Rule{agentRule}, nil),
+					handle.EXPECT().RuleDel(gomock.Any()).
+						Return(fmt.Errorf("some error")),
+				)
+			},
+			error: fmt.Errorf("unable to remove rule for addr 192.168.1.5/32: some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// setup
+			handle := NewMockNetlinkHandle(ctrl)
+			tc.handleCalls(handle)
+			retriever := NewAgentLinkRetriever(handle, tc.opts)
+
+			// trigger
+			err := retriever.TeardownRuleForAddrFamily(context.Background(), targetAddrFamily)
+
+			// validate
+			if tc.error != nil {
+				g.Expect(err).To(MatchError(tc.error.Error()))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
@@ -11,3 +11,27 @@ import (
 func (l *agentLink) SetupRouteTableForAddrFamily(ctx context.Context, family AddrFamily) error {
 	return netlink.ErrNotImplemented
 }
+
+func (l *agentLink) TeardownRouteTableForAddrFamily(ctx context.Context, family AddrFamily) error {
+	return netlink.ErrNotImplemented
+}
+
+func (l *agentLinkRetriever) TeardownRuleForAddrFamily(ctx context.Context, family AddrFamily) error {
+	return netlink.ErrNotImplemented
+}
+
+func (l *agentLink) HasRouteForAddrFamily(ctx context.Context, family AddrFamily) (bool, error) {
+	return false, netlink.ErrNotImplemented
+}
+
+func (l *agentLink) ConflictingRoutesForAddrFamily(ctx context.Context, family AddrFamily) ([]netlink.Route, error) {
+	return nil, netlink.ErrNotImplemented
+}
+
+func (l *agentLink) HasRuleForAddrFamily(ctx context.Context, family AddrFamily) (bool, error) {
+	return false, netlink.ErrNotImplemented
+}
+
+func (l *agentLink) ShadowingRulesForAddrFamily(ctx context.Context, family AddrFamily) ([]netlink.Rule, error) {
+	return nil, netlink.ErrNotImplemented
+}
@@ -2,6 +2,8 @@ package iproute
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/vishvananda/netlink"
 )
@@ -11,16 +13,81 @@ type (
 	// otherwise it will try to create one
 	AgentLinkRetriever interface {
 		CreateOrGetLink(ctx context.Context) (AgentLink, error)
+		// GetLink fetches the agent's link, returning ErrLinkNotFound if
+		// there is none
+		GetLink(ctx context.Context) (AgentLink, error)
+		// TeardownRuleForAddrFamily removes the rule sending traffic to the
+		// family addr to the route table, doing nothing if there is none.
+		// Rules outlive the link so they are removed without it.
+		TeardownRuleForAddrFamily(ctx context.Context, family AddrFamily) error
 	}
 
 	AgentLink interface {
 		SetupForAddrFamily(ctx context.Context, addrFamily AddrFamily) error
 		SetupRouteTableForAddrFamily(ctx context.Context, family AddrFamily) error
 
+		// TeardownForAddrFamily and TeardownRouteTableForAddrFamily undo
+		// their Setup counterparts, doing nothing if there is nothing to
+		// remove. The rule added with the route is removed by
+		// AgentLinkRetriever.TeardownRuleForAddrFamily.
+		TeardownForAddrFamily(ctx context.Context, addrFamily AddrFamily) error
+		TeardownRouteTableForAddrFamily(ctx context.Context, family AddrFamily) error
+
+		// HasAddrFamily checks if the family addr is attached to the link
+		HasAddrFamily(ctx context.Context, addrFamily AddrFamily) (bool, error)
+		// AddrFamilyUsable checks if the family addr can be bound to, which
+		// IPv6 addresses cannot while duplicate address detection is in
+		// progress. It fails if the detection found the addr in use.
+		AddrFamilyUsable(ctx context.Context, addrFamily AddrFamily) (bool, error)
+		// HasRouteForAddrFamily checks if there is a route to the family
+		// addr through the link, failing if the route goes through
+		// another link
+		HasRouteForAddrFamily(ctx context.Context, family AddrFamily) (bool, error)
+		// ConflictingRoutesForAddrFamily lists the routes to the family
+		// addr that go through other links
+		ConflictingRoutesForAddrFamily(ctx context.Context, family AddrFamily) ([]netlink.Route, error)
+		// HasRuleForAddrFamily checks if there is a rule sending traffic
+		// to the family addr to the route table, always true when the
+		// routes are in the main table
+		HasRuleForAddrFamily(ctx context.Context, family AddrFamily) (bool, error)
+		// ShadowingRulesForAddrFamily lists the rules evaluated before the
+		// agent one that send traffic to the family addr elsewhere
+		ShadowingRulesForAddrFamily(ctx context.Context, family AddrFamily) ([]netlink.Rule, error)
+
 		BringUp(context.Context) error
+		// IsUp checks if the link was up when it was retrieved
+		IsUp() bool
+		// Delete removes the link from the host, except for the loopback
+		// link
+		Delete(context.Context) error
 		Name() string
 	}
 
+	// LinkType is the kind of link the agent addresses are attached to
+	LinkType string
+
+	// LinkOpts configures the agent link and its routes
+	LinkOpts struct {
+		// Name of the link, configuration.AgentLinkName if empty
+		Name string
+		// Type of the link, LinkTypeDummy if empty
+		Type LinkType
+		// PeerName is the name of the other end of a veth link,
+		// Name with a "p" suffix if empty
+		PeerName string
+		// PeerNetns is the path of the namespace, eg. one created by
+		// `ip netns add`, the other end of a veth link is moved to. It is
+		// left in the current namespace if empty.
+		PeerNetns string
+		// MigrateType replaces an existing link of another type instead
+		// of failing with ErrWrongLinkType
+		MigrateType bool
+		// RouteTable the routes are added to, the main table if 0. Routes
+		// in other tables are looked up through a rule at RulePriority.
+		RouteTable   int
+		RulePriority int
+	}
+
 	AddrFamily struct {
 		// A valid family type, for now we only support AF_INET and AF_INET6
 		Family int
@@ -28,3 +95,43 @@ type (
 		LinkLocalAddr *netlink.Addr
 	}
 )
+
+// The tables of unix.RT_TABLE_MAIN and unix.RT_TABLE_LOCAL, which are only
+// defined on linux
+const (
+	MainRouteTable  = 254
+	LocalRouteTable = 255
+)
+
+const (
+	// LinkTypeDummy is a dummy link, which requires the dummy module
+	LinkTypeDummy LinkType = "dummy"
+	// LinkTypeVeth is one end of a veth pair
+	LinkTypeVeth LinkType = "veth"
+	// LinkTypeLoopback attaches the addresses to the loopback link
+	// instead of creating one
+	LinkTypeLoopback LinkType = "loopback"
+)
+
+// LoopbackLinkName is the name of the loopback link
+const LoopbackLinkName = "lo"
+
+var (
+	// ErrLinkNotFound is returned when the agent's link does not exist
+	ErrLinkNotFound = errors.New("agent link not found")
+	// ErrWrongLinkType is returned when there is a link of another type
+	// with the agent link name
+	ErrWrongLinkType = errors.New("agent link has the wrong type")
+)
+
+// ParseLinkType validates the name of a link type
+func ParseLinkType(linkType string) (LinkType, error) {
+	switch LinkType(linkType) {
+	case LinkTypeDummy, LinkTypeVeth, LinkTypeLoopback:
+		return LinkType(linkType), nil
+	case "":
+		return LinkTypeDummy, nil
+	}
+	return "", fmt.Errorf("unknown link type %s, expected one of %s, %s or %s",
+		linkType, LinkTypeDummy, LinkTypeVeth, LinkTypeLoopback)
+}
@@ -0,0 +1,38 @@
+package initalizer
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// NetnsPath turns the pid of a process into the path of its network
+// namespace, other values are taken as the path of a namespace, eg.
+// /var/run/netns/<name> for namespaces created with `ip netns add`
+func NetnsPath(namespace string) string {
+	if pid, err := strconv.Atoi(namespace); err == nil {
+		return fmt.Sprintf("/proc/%d/ns/net", pid)
+	}
+	return namespace
+}
+
+// newNetlinkHandle creates a handle in the namespace given by NetnsPath,
+// or in the current one if namespace is empty
+func newNetlinkHandle(namespace string) (*netlink.Handle, error) {
+	if namespace == "" {
+		return netlink.NewHandle()
+	}
+	ns, err := netns.GetFromPath(NetnsPath(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open network namespace %s: %w", namespace, err)
+	}
+	// the handle sockets stay in the namespace once created
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create netlink handle in namespace %s: %w", namespace, err)
+	}
+	return handle, nil
+}
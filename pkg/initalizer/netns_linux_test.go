@@ -0,0 +1,135 @@
+package initalizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/iproute"
+	"golang.org/x/sys/unix"
+)
+
+// netnsTestChildEnv is set when a test runs again in its own user and
+// network namespace, where it can change links without privileges
+const netnsTestChildEnv = "POD_IDENTITY_NETNS_TEST_CHILD"
+
+func TestNewExecutor_Netns(t *testing.T) {
+	if os.Getenv(netnsTestChildEnv) == "" {
+		runInUserNetns(t)
+		return
+	}
+
+	// the target namespace belongs to a process started in a new network
+	// namespace, so it is different from the one the test runs in
+	target := exec.Command("sleep", "60")
+	target.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	if err := target.Start(); err != nil {
+		t.Fatalf("unable to start process in a new network namespace: %v", err)
+	}
+	defer func() {
+		_ = target.Process.Kill()
+		_ = target.Wait()
+	}()
+	pid := target.Process.Pid
+
+	testCases := []struct {
+		name  string
+		netns string
+	}{
+		{
+			name:  "namespace of a pid",
+			netns: strconv.Itoa(pid),
+		},
+		{
+			name:  "namespace path",
+			netns: fmt.Sprintf("/proc/%d/ns/net", pid),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			// setup, loopback links are used as the dummy module may not
+			// be available
+			executor, err := NewExecutor(ExecutorOpts{
+				Netns:     tc.netns,
+				LinkType:  iproute.LinkTypeLoopback,
+				Addresses: []string{configuration.DefaultIpv4TargetHost},
+			})
+			g.Expect(err).ToNot(HaveOccurred())
+			ns, err := netns.GetFromPid(pid)
+			g.Expect(err).ToNot(HaveOccurred())
+			defer ns.Close()
+			targetHandle, err := netlink.NewHandleAt(ns)
+			g.Expect(err).ToNot(HaveOccurred())
+			defer targetHandle.Delete()
+
+			// trigger
+			err = executor.Initialize(ctx)
+
+			// validate, the address is only attached in the target namespace
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(loopbackHasAgentAddr(g, targetHandle)).To(BeTrue())
+			currentHandle, err := netlink.NewHandle()
+			g.Expect(err).ToNot(HaveOccurred())
+			defer currentHandle.Delete()
+			g.Expect(loopbackHasAgentAddr(g, currentHandle)).To(BeFalse())
+
+			g.Expect(executor.Uninitialize(ctx)).To(Succeed())
+			g.Expect(loopbackHasAgentAddr(g, targetHandle)).To(BeFalse())
+		})
+	}
+}
+
+func TestNewExecutor_Netns_NotFound(t *testing.T) {
+	g := NewWithT(t)
+
+	// trigger
+	_, err := NewExecutor(ExecutorOpts{Netns: "/proc/self/ns/missing"})
+
+	// validate
+	g.Expect(err).To(MatchError(ContainSubstring("unable to open network namespace")))
+}
+
+// runInUserNetns runs the test again in a new user and network namespace,
+// skipping it if those cannot be created
+func runInUserNetns(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.v")
+	cmd.Env = append(os.Environ(), netnsTestChildEnv+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	out, err := cmd.CombinedOutput()
+	if cmd.Process == nil {
+		t.Skipf("unable to create a user namespace: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("test failed in a user namespace: %v\n%s", err, out)
+	}
+	t.Logf("test output in a user namespace:\n%s", out)
+}
+
+func loopbackHasAgentAddr(g Gomega, handle *netlink.Handle) bool {
+	lo, err := handle.LinkByName(iproute.LoopbackLinkName)
+	g.Expect(err).ToNot(HaveOccurred())
+	addrs, err := handle.AddrList(lo, unix.AF_INET)
+	g.Expect(err).ToNot(HaveOccurred())
+	for _, addr := range addrs {
+		if addr.IP.String() == configuration.DefaultIpv4TargetHost {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package nftables
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	nft "github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+)
+
+// fakeNftHandle records the changes flushed to it in nft syntax
+type fakeNftHandle struct {
+	// pending are the changes queued since the last flush
+	pending []string
+	// flushed are the changes applied by the last successful flush
+	flushed  []string
+	flushErr error
+}
+
+func (f *fakeNftHandle) AddTable(t *nft.Table) *nft.Table {
+	f.pending = append(f.pending, "add table inet "+t.Name)
+	return t
+}
+
+func (f *fakeNftHandle) DelTable(t *nft.Table) {
+	f.pending = append(f.pending, "delete table inet "+t.Name)
+}
+
+func (f *fakeNftHandle) AddChain(c *nft.Chain) *nft.Chain {
+	f.pending = append(f.pending, "add chain "+describeChain(c))
+	return c
+}
+
+func (f *fakeNftHandle) AddRule(r *nft.Rule) *nft.Rule {
+	f.pending = append(f.pending, fmt.Sprintf("add rule %s %s", r.Chain.Name, describeRule(r)))
+	return r
+}
+
+func (f *fakeNftHandle) Flush() error {
+	pending := f.pending
+	f.pending = nil
+	if f.flushErr != nil {
+		return f.flushErr
+	}
+	f.flushed = pending
+	return nil
+}
+
+func describeChain(c *nft.Chain) string {
+	if c.Hooknum == nil {
+		return c.Name
+	}
+	hook := map[nft.ChainHook]string{*nft.ChainHookInput: "input", *nft.ChainHookOutput: "output"}[*c.Hooknum]
+	policy := "drop"
+	if c.Policy != nil && *c.Policy == nft.ChainPolicyAccept {
+		policy = "accept"
+	}
+	return fmt.Sprintf("%s { type %s hook %s priority %d; policy %s; }", c.Name, c.Type, hook, *c.Priority, policy)
+}
+
+// describeRule renders the expressions used by the Guard the way nft lists
+// them, the protocol checks implied by the matches are left out
+func describeRule(r *nft.Rule) string {
+	var words []string
+	var loaded string
+	var mask net.IPMask
+	for _, e := range r.Exprs {
+		switch e := e.(type) {
+		case *expr.Meta:
+			loaded = map[expr.MetaKey]string{
+				expr.MetaKeyNFPROTO: "meta nfproto",
+				expr.MetaKeyL4PROTO: "meta l4proto",
+				expr.MetaKeyIIFNAME: "iifname",
+				expr.MetaKeySKUID:   "meta skuid",
+				expr.MetaKeyMARK:    "meta mark",
+			}[e.Key]
+			mask = nil
+		case *expr.Payload:
+			loaded = map[[3]uint32]string{
+				{uint32(expr.PayloadBaseNetworkHeader), 12, 4}:  "ip saddr",
+				{uint32(expr.PayloadBaseNetworkHeader), 16, 4}:  "ip daddr",
+				{uint32(expr.PayloadBaseNetworkHeader), 8, 16}:  "ip6 saddr",
+				{uint32(expr.PayloadBaseNetworkHeader), 24, 16}: "ip6 daddr",
+				{uint32(expr.PayloadBaseTransportHeader), 2, 2}: "tcp dport",
+			}[[3]uint32{uint32(e.Base), e.Offset, e.Len}]
+			mask = nil
+		case *expr.Bitwise:
+			mask = e.Mask
+		case *expr.Cmp:
+			switch loaded {
+			case "meta nfproto", "meta l4proto":
+			case "iifname":
+				name := strings.TrimRight(string(e.Data), "\x00")
+				if len(e.Data) == len(name) {
+					name += "*"
+				}
+				words = append(words, loaded, fmt.Sprintf("%q", name))
+			case "meta skuid":
+				words = append(words, loaded, fmt.Sprint(binaryutil.NativeEndian.Uint32(e.Data)))
+			case "meta mark":
+				words = append(words, loaded, fmt.Sprintf("0x%08x", binaryutil.NativeEndian.Uint32(e.Data)))
+			case "tcp dport":
+				words = append(words, loaded, fmt.Sprint(binaryutil.BigEndian.Uint16(e.Data)))
+			default:
+				value := net.IP(e.Data).String()
+				if mask != nil {
+					ones, _ := mask.Size()
+					value = fmt.Sprintf("%s/%d", value, ones)
+				}
+				words = append(words, loaded, value)
+			}
+		case *expr.Counter:
+			words = append(words, "counter")
+		case *expr.Verdict:
+			switch e.Kind {
+			case expr.VerdictAccept:
+				words = append(words, "accept")
+			case expr.VerdictDrop:
+				words = append(words, "drop")
+			case expr.VerdictJump:
+				words = append(words, "jump", e.Chain)
+			}
+		default:
+			words = append(words, fmt.Sprintf("%T", e))
+		}
+	}
+	return strings.Join(words, " ")
+}
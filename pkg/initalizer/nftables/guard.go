@@ -0,0 +1,69 @@
+package nftables
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TableName is the nftables table, in the inet family, holding the rules
+// installed by the Guard
+const TableName = "pod_identity_agent"
+
+// maxInterfaceName is the longest interface name accepted by the kernel,
+// IFNAMSIZ without the terminating nul
+const maxInterfaceName = 15
+
+// DefaultProbeMark is the mark the agent sets on its probe connections so
+// they pass the Guard
+const DefaultProbeMark uint32 = 0x2703
+
+// GuardOpts configures who can reach the agent
+type GuardOpts struct {
+	// Port the agent listens on
+	Port uint16
+	// AllowedCIDRs are the networks requests can come from, usually the
+	// pod CIDRs of the node
+	AllowedCIDRs []string
+	// AllowedInterfaces are the interfaces requests can come through, a
+	// trailing * matches every interface with that prefix, eg. eni* or
+	// veth*
+	AllowedInterfaces []string
+	// AllowedUIDs are the users whose host network processes can reach
+	// the agent
+	AllowedUIDs []uint32
+	// ProbeMark, if not 0, is the mark of the connections host processes
+	// can reach the agent with. The agent sets it on its probe connections
+	// so they pass without allowing the user it runs as.
+	ProbeMark uint32
+}
+
+// A Guard restricts which traffic can reach the agent addresses, so host
+// network processes other than the agent cannot fetch credentials
+type Guard interface {
+	// Install replaces the rules guarding the agent addresses
+	Install(ctx context.Context, addresses []net.IP) error
+	// Remove deletes the rules, doing nothing if they are not installed
+	Remove(ctx context.Context) error
+}
+
+// parseGuardOpts validates the allowed CIDRs and interfaces of opts,
+// returning the parsed CIDRs
+func parseGuardOpts(opts GuardOpts) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, len(opts.AllowedCIDRs))
+	for i, cidr := range opts.AllowedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed CIDR %s: %w", cidr, err)
+		}
+		cidrs[i] = ipNet
+	}
+	for _, iface := range opts.AllowedInterfaces {
+		name := strings.TrimSuffix(iface, "*")
+		if name == "" || len(name) > maxInterfaceName || strings.ContainsAny(name, "*/ \t\n") {
+			return nil, fmt.Errorf("invalid allowed interface %q", iface)
+		}
+	}
+	return cidrs, nil
+}
@@ -0,0 +1,217 @@
+package nftables
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	nft "github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// checkSourceChain and checkOwnerChain decide whether traffic to the
+	// agent coming into the host or sent by host processes is accepted
+	checkSourceChain = "check_source"
+	checkOwnerChain  = "check_owner"
+)
+
+type nftGuard struct {
+	handle NftHandle
+	opts   GuardOpts
+	cidrs  []*net.IPNet
+}
+
+// NewGuard creates a Guard installing nftables rules through handle. The
+// rest of opts are checked on Install, so a Guard only used to remove the
+// rules can be created without them.
+func NewGuard(handle NftHandle, opts GuardOpts) (Guard, error) {
+	cidrs, err := parseGuardOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &nftGuard{handle: handle, opts: opts, cidrs: cidrs}, nil
+}
+
+func (g *nftGuard) Install(ctx context.Context, addresses []net.IP) error {
+	log := logger.FromContext(ctx)
+	if g.opts.Port == 0 {
+		return fmt.Errorf("the agent port is required")
+	}
+	if len(g.opts.AllowedCIDRs) == 0 && len(g.opts.AllowedInterfaces) == 0 {
+		return fmt.Errorf("at least one allowed CIDR or interface is required, pods would be unable to reach the agent")
+	}
+	log.Infof("Installing nftables rules restricting access to %v port %d", addresses, g.opts.Port)
+	g.deleteTable()
+	g.addTable(addresses)
+	if err := g.handle.Flush(); err != nil {
+		return fmt.Errorf("unable to install nftables rules: %w", err)
+	}
+	return nil
+}
+
+func (g *nftGuard) Remove(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	log.Infof("Removing nftables table %s", TableName)
+	g.deleteTable()
+	if err := g.handle.Flush(); err != nil {
+		return fmt.Errorf("unable to remove nftables rules: %w", err)
+	}
+	return nil
+}
+
+// deleteTable queues the removal of the table, adding it first makes
+// deleting it succeed if it is missing
+func (g *nftGuard) deleteTable() {
+	table := &nft.Table{Family: nft.TableFamilyINet, Name: TableName}
+	g.handle.AddTable(table)
+	g.handle.DelTable(table)
+}
+
+// addTable queues the creation of a table where traffic to the agent
+// coming into the host is accepted from the allowed CIDRs and interfaces,
+// and traffic sent by host processes is accepted from the allowed users
+// or with the probe mark.
+// The rest of the traffic to the agent is dropped.
+func (g *nftGuard) addTable(addresses []net.IP) {
+	table := g.handle.AddTable(&nft.Table{Family: nft.TableFamilyINet, Name: TableName})
+	policy := nft.ChainPolicyAccept
+
+	input := g.handle.AddChain(&nft.Chain{
+		Name: "input", Table: table, Type: nft.ChainTypeFilter,
+		Hooknum: nft.ChainHookInput, Priority: nft.ChainPriorityFilter, Policy: &policy,
+	})
+	checkSource := g.handle.AddChain(&nft.Chain{Name: checkSourceChain, Table: table})
+	output := g.handle.AddChain(&nft.Chain{
+		Name: "output", Table: table, Type: nft.ChainTypeFilter,
+		Hooknum: nft.ChainHookOutput, Priority: nft.ChainPriorityFilter, Policy: &policy,
+	})
+	checkOwner := g.handle.AddChain(&nft.Chain{Name: checkOwnerChain, Table: table})
+
+	for _, ip := range addresses {
+		g.addRule(input, matchDestination(ip), matchTcpPort(g.opts.Port), jump(checkSourceChain))
+		g.addRule(output, matchDestination(ip), matchTcpPort(g.opts.Port), jump(checkOwnerChain))
+	}
+
+	// locally generated traffic comes back in through lo, it was already
+	// checked on its way out
+	g.addRule(checkSource, matchInterface("lo"), accept())
+	for _, cidr := range g.cidrs {
+		g.addRule(checkSource, matchSource(cidr), accept())
+	}
+	for _, iface := range g.opts.AllowedInterfaces {
+		g.addRule(checkSource, matchInterface(iface), accept())
+	}
+	g.addRule(checkSource, drop())
+
+	for _, uid := range g.opts.AllowedUIDs {
+		g.addRule(checkOwner, matchUid(uid), accept())
+	}
+	if g.opts.ProbeMark != 0 {
+		g.addRule(checkOwner, matchMark(g.opts.ProbeMark), accept())
+	}
+	g.addRule(checkOwner, drop())
+}
+
+func (g *nftGuard) addRule(chain *nft.Chain, exprs ...[]expr.Any) {
+	rule := &nft.Rule{Table: chain.Table, Chain: chain}
+	for _, e := range exprs {
+		rule.Exprs = append(rule.Exprs, e...)
+	}
+	g.handle.AddRule(rule)
+}
+
+// matchDestination matches packets sent to ip, as `ip daddr` or
+// `ip6 daddr` do
+func matchDestination(ip net.IP) []expr.Any {
+	if ip4 := ip.To4(); ip4 != nil {
+		return matchNetworkHeader(unix.NFPROTO_IPV4, 16, ip4, nil)
+	}
+	return matchNetworkHeader(unix.NFPROTO_IPV6, 24, ip.To16(), nil)
+}
+
+// matchSource matches packets sent from cidr, as `ip saddr` or
+// `ip6 saddr` do
+func matchSource(cidr *net.IPNet) []expr.Any {
+	if ip4 := cidr.IP.To4(); ip4 != nil {
+		return matchNetworkHeader(unix.NFPROTO_IPV4, 12, ip4, cidr.Mask)
+	}
+	return matchNetworkHeader(unix.NFPROTO_IPV6, 8, cidr.IP.To16(), cidr.Mask)
+}
+
+// matchNetworkHeader matches packets of the family whose network header
+// holds value at offset, only comparing the bits set in mask if any
+func matchNetworkHeader(family byte, offset uint32, value []byte, mask net.IPMask) []expr.Any {
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{family}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(value))},
+	}
+	if mask != nil {
+		exprs = append(exprs, &expr.Bitwise{
+			SourceRegister: 1, DestRegister: 1, Len: uint32(len(value)),
+			Mask: mask, Xor: make([]byte, len(value)),
+		})
+	}
+	return append(exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: value})
+}
+
+// matchTcpPort matches tcp packets sent to port, as `tcp dport` does
+func matchTcpPort(port uint16) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_TCP}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(port)},
+	}
+}
+
+// matchInterface matches packets coming in through iface, as `iifname`
+// does. Names ending with * match every interface with that prefix.
+func matchInterface(iface string) []expr.Any {
+	name, wildcard := strings.CutSuffix(iface, "*")
+	data := []byte(name)
+	if !wildcard {
+		// names are compared including their nul padding so only the
+		// exact name matches
+		data = make([]byte, unix.IFNAMSIZ)
+		copy(data, name)
+	}
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: data},
+	}
+}
+
+// matchUid matches packets sent by processes of the user, as `meta skuid`
+// does
+func matchUid(uid uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeySKUID, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(uid)},
+	}
+}
+
+// matchMark matches packets carrying mark, as `meta mark` does
+func matchMark(mark uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(mark)},
+	}
+}
+
+func jump(chain string) []expr.Any {
+	return []expr.Any{&expr.Verdict{Kind: expr.VerdictJump, Chain: chain}}
+}
+
+func accept() []expr.Any {
+	return []expr.Any{&expr.Verdict{Kind: expr.VerdictAccept}}
+}
+
+func drop() []expr.Any {
+	return []expr.Any{&expr.Counter{}, &expr.Verdict{Kind: expr.VerdictDrop}}
+}
@@ -0,0 +1,288 @@
+package nftables
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	nft "github.com/google/nftables"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netns"
+	_ "go.amzn.com/eks/eks-pod-identity-agent/internal/test"
+)
+
+var (
+	guardTestAddresses = []net.IP{net.ParseIP("169.254.170.23"), net.ParseIP("fd00:ec2::23")}
+	guardTestOpts      = GuardOpts{
+		Port:              80,
+		AllowedCIDRs:      []string{"10.0.0.0/16", "2600:1f14::/56"},
+		AllowedInterfaces: []string{"eni*", "eth1"},
+		AllowedUIDs:       []uint32{0},
+		ProbeMark:         DefaultProbeMark,
+	}
+	// guardTestRules are the rules installed with guardTestOpts
+	guardTestRules = map[string][]string{
+		"input": {
+			"ip daddr 169.254.170.23 tcp dport 80 jump check_source",
+			"ip6 daddr fd00:ec2::23 tcp dport 80 jump check_source",
+		},
+		"check_source": {
+			`iifname "lo" accept`,
+			"ip saddr 10.0.0.0/16 accept",
+			"ip6 saddr 2600:1f14::/56 accept",
+			`iifname "eni*" accept`,
+			`iifname "eth1" accept`,
+			"counter drop",
+		},
+		"output": {
+			"ip daddr 169.254.170.23 tcp dport 80 jump check_owner",
+			"ip6 daddr fd00:ec2::23 tcp dport 80 jump check_owner",
+		},
+		"check_owner": {
+			"meta skuid 0 accept",
+			"meta mark 0x00002703 accept",
+			"counter drop",
+		},
+	}
+)
+
+func TestNftGuard_Install(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             GuardOpts
+		flushErr         error
+		expectedChanges  []string
+		expectedErrorMsg string
+	}{
+		{
+			name: "allows pod CIDRs, interfaces and users",
+			opts: guardTestOpts,
+			expectedChanges: []string{
+				"add table inet pod_identity_agent",
+				"delete table inet pod_identity_agent",
+				"add table inet pod_identity_agent",
+				"add chain input { type filter hook input priority 0; policy accept; }",
+				"add chain check_source",
+				"add chain output { type filter hook output priority 0; policy accept; }",
+				"add chain check_owner",
+				"add rule input ip daddr 169.254.170.23 tcp dport 80 jump check_source",
+				"add rule output ip daddr 169.254.170.23 tcp dport 80 jump check_owner",
+				"add rule input ip6 daddr fd00:ec2::23 tcp dport 80 jump check_source",
+				"add rule output ip6 daddr fd00:ec2::23 tcp dport 80 jump check_owner",
+				`add rule check_source iifname "lo" accept`,
+				"add rule check_source ip saddr 10.0.0.0/16 accept",
+				"add rule check_source ip6 saddr 2600:1f14::/56 accept",
+				`add rule check_source iifname "eni*" accept`,
+				`add rule check_source iifname "eth1" accept`,
+				"add rule check_source counter drop",
+				"add rule check_owner meta skuid 0 accept",
+				"add rule check_owner meta mark 0x00002703 accept",
+				"add rule check_owner counter drop",
+			},
+		},
+		{
+			name: "drops traffic from all host processes without allowed users",
+			opts: GuardOpts{
+				Port:         2703,
+				AllowedCIDRs: []string{"10.0.0.0/16"},
+			},
+			expectedChanges: []string{
+				"add table inet pod_identity_agent",
+				"delete table inet pod_identity_agent",
+				"add table inet pod_identity_agent",
+				"add chain input { type filter hook input priority 0; policy accept; }",
+				"add chain check_source",
+				"add chain output { type filter hook output priority 0; policy accept; }",
+				"add chain check_owner",
+				"add rule input ip daddr 169.254.170.23 tcp dport 2703 jump check_source",
+				"add rule output ip daddr 169.254.170.23 tcp dport 2703 jump check_owner",
+				"add rule input ip6 daddr fd00:ec2::23 tcp dport 2703 jump check_source",
+				"add rule output ip6 daddr fd00:ec2::23 tcp dport 2703 jump check_owner",
+				`add rule check_source iifname "lo" accept`,
+				"add rule check_source ip saddr 10.0.0.0/16 accept",
+				"add rule check_source counter drop",
+				"add rule check_owner counter drop",
+			},
+		},
+		{
+			name: "only lets host processes through with the probe mark",
+			opts: GuardOpts{
+				Port:              80,
+				AllowedInterfaces: []string{"veth*"},
+				ProbeMark:         0x10,
+			},
+			expectedChanges: []string{
+				"add table inet pod_identity_agent",
+				"delete table inet pod_identity_agent",
+				"add table inet pod_identity_agent",
+				"add chain input { type filter hook input priority 0; policy accept; }",
+				"add chain check_source",
+				"add chain output { type filter hook output priority 0; policy accept; }",
+				"add chain check_owner",
+				"add rule input ip daddr 169.254.170.23 tcp dport 80 jump check_source",
+				"add rule output ip daddr 169.254.170.23 tcp dport 80 jump check_owner",
+				"add rule input ip6 daddr fd00:ec2::23 tcp dport 80 jump check_source",
+				"add rule output ip6 daddr fd00:ec2::23 tcp dport 80 jump check_owner",
+				`add rule check_source iifname "lo" accept`,
+				`add rule check_source iifname "veth*" accept`,
+				"add rule check_source counter drop",
+				"add rule check_owner meta mark 0x00000010 accept",
+				"add rule check_owner counter drop",
+			},
+		},
+		{
+			name:             "port is required",
+			opts:             GuardOpts{AllowedCIDRs: []string{"10.0.0.0/16"}},
+			expectedErrorMsg: "the agent port is required",
+		},
+		{
+			name:             "something must be allowed",
+			opts:             GuardOpts{Port: 80, AllowedUIDs: []uint32{0}},
+			expectedErrorMsg: "at least one allowed CIDR or interface is required, pods would be unable to reach the agent",
+		},
+		{
+			name:             "nftables fails",
+			opts:             GuardOpts{Port: 80, AllowedInterfaces: []string{"veth*"}},
+			flushErr:         fmt.Errorf("some error"),
+			expectedErrorMsg: "unable to install nftables rules: some error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// setup
+			handle := &fakeNftHandle{flushErr: tc.flushErr}
+			guard, err := NewGuard(handle, tc.opts)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// trigger
+			err = guard.Install(context.Background(), guardTestAddresses)
+
+			// validate
+			if tc.expectedErrorMsg != "" {
+				g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.flushed).To(Equal(tc.expectedChanges))
+			}
+		})
+	}
+}
+
+func TestNftGuard_Remove(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	handle := &fakeNftHandle{}
+	guard, err := NewGuard(handle, GuardOpts{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger
+	err = guard.Remove(context.Background())
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(handle.flushed).To(Equal([]string{
+		"add table inet pod_identity_agent",
+		"delete table inet pod_identity_agent",
+	}))
+}
+
+func TestNewGuard(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             GuardOpts
+		expectedErrorMsg string
+	}{
+		{
+			name:             "invalid CIDR",
+			opts:             GuardOpts{Port: 80, AllowedCIDRs: []string{"10.0.0.0"}},
+			expectedErrorMsg: "invalid allowed CIDR 10.0.0.0: invalid CIDR address: 10.0.0.0",
+		},
+		{
+			name:             "interface name too long",
+			opts:             GuardOpts{Port: 80, AllowedInterfaces: []string{"some-long-interface"}},
+			expectedErrorMsg: `invalid allowed interface "some-long-interface"`,
+		},
+		{
+			name:             "wildcard in the middle of an interface",
+			opts:             GuardOpts{Port: 80, AllowedInterfaces: []string{"eni*0"}},
+			expectedErrorMsg: `invalid allowed interface "eni*0"`,
+		},
+		{
+			name:             "only a wildcard",
+			opts:             GuardOpts{Port: 80, AllowedInterfaces: []string{"*"}},
+			expectedErrorMsg: `invalid allowed interface "*"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// trigger
+			_, err := NewGuard(nil, tc.opts)
+
+			// validate
+			g.Expect(err).To(MatchError(tc.expectedErrorMsg))
+		})
+	}
+}
+
+func TestNewNetlinkGuard_Netns(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup, the rules are installed in the namespace of a process started
+	// in a new network namespace
+	target := exec.Command("sleep", "60")
+	target.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	if err := target.Start(); err != nil {
+		t.Skipf("unable to start process in a new network namespace: %v", err)
+	}
+	defer func() {
+		_ = target.Process.Kill()
+		_ = target.Wait()
+	}()
+	netnsPath := fmt.Sprintf("/proc/%d/ns/net", target.Process.Pid)
+	ns, err := netns.GetFromPath(netnsPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer ns.Close()
+	conn, err := nft.New(nft.WithNetNSFd(int(ns)))
+	g.Expect(err).ToNot(HaveOccurred())
+	guard, err := NewNetlinkGuard(netnsPath, guardTestOpts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger
+	err = guard.Install(ctx, guardTestAddresses)
+
+	// validate, the kernel lists the rules back in the target namespace
+	g.Expect(err).ToNot(HaveOccurred())
+	table, err := conn.ListTableOfFamily(TableName, nft.TableFamilyINet)
+	g.Expect(err).ToNot(HaveOccurred())
+	rules := map[string][]string{}
+	for chain := range guardTestRules {
+		listed, err := conn.GetRules(table, &nft.Chain{Name: chain, Table: table})
+		g.Expect(err).ToNot(HaveOccurred())
+		for _, rule := range listed {
+			rules[chain] = append(rules[chain], describeRule(rule))
+		}
+	}
+	g.Expect(rules).To(Equal(guardTestRules))
+	tables, err := nft.New()
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = tables.ListTableOfFamily(TableName, nft.TableFamilyINet)
+	g.Expect(err).To(HaveOccurred(), "the table must only be in the target namespace")
+
+	// installing again replaces the rules, and removing them twice works
+	g.Expect(guard.Install(ctx, guardTestAddresses)).To(Succeed())
+	g.Expect(guard.Remove(ctx)).To(Succeed())
+	g.Expect(guard.Remove(ctx)).To(Succeed())
+	_, err = conn.ListTableOfFamily(TableName, nft.TableFamilyINet)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,48 @@
+package nftables
+
+import (
+	"fmt"
+
+	nft "github.com/google/nftables"
+	"github.com/vishvananda/netns"
+)
+
+type (
+	// NftHandle abstracts the nftables netlink methods used by the Guard,
+	// useful for test purposes. Changes are buffered until Flush applies
+	// them in a single transaction.
+	NftHandle interface {
+		AddTable(t *nft.Table) *nft.Table
+		DelTable(t *nft.Table)
+		AddChain(c *nft.Chain) *nft.Chain
+		AddRule(r *nft.Rule) *nft.Rule
+		Flush() error
+	}
+)
+
+// NewNetlinkGuard creates a Guard programming nftables over netlink in the
+// network namespace at netnsPath, or in the current one if it is empty
+func NewNetlinkGuard(netnsPath string, opts GuardOpts) (Guard, error) {
+	handle, err := newNftHandle(netnsPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewGuard(handle, opts)
+}
+
+func newNftHandle(netnsPath string) (NftHandle, error) {
+	if netnsPath == "" {
+		return nft.New()
+	}
+	ns, err := netns.GetFromPath(netnsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open network namespace %s: %w", netnsPath, err)
+	}
+	// the lasting connection socket stays in the namespace once created
+	defer ns.Close()
+	conn, err := nft.New(nft.WithNetNSFd(int(ns)), nft.AsLasting())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create nftables connection in namespace %s: %w", netnsPath, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,59 @@
+package nftables
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	nft "github.com/google/nftables"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netns"
+)
+
+func TestNewNftHandle_Netns(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup, a process started in a new network namespace
+	target := exec.Command("sleep", "60")
+	target.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	if err := target.Start(); err != nil {
+		t.Skipf("unable to start process in a new network namespace: %v", err)
+	}
+	defer func() {
+		_ = target.Process.Kill()
+		_ = target.Wait()
+	}()
+	netnsPath := fmt.Sprintf("/proc/%d/ns/net", target.Process.Pid)
+	handle, err := newNftHandle(netnsPath)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// trigger, the namespace handle is closed once the connection is
+	// created and changes still go to the namespace
+	handle.AddTable(&nft.Table{Family: nft.TableFamilyINet, Name: TableName})
+	err = handle.Flush()
+
+	// validate
+	g.Expect(err).ToNot(HaveOccurred())
+	ns, err := netns.GetFromPath(netnsPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer ns.Close()
+	conn, err := nft.New(nft.WithNetNSFd(int(ns)))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = conn.ListTableOfFamily(TableName, nft.TableFamilyINet)
+	g.Expect(err).ToNot(HaveOccurred())
+	current, err := nft.New()
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = current.ListTableOfFamily(TableName, nft.TableFamilyINet)
+	g.Expect(err).To(HaveOccurred(), "the table must only be in the target namespace")
+}
+
+func TestNewNftHandle_NetnsNotFound(t *testing.T) {
+	g := NewWithT(t)
+
+	// trigger
+	_, err := newNftHandle("/proc/self/ns/missing")
+
+	// validate
+	g.Expect(err).To(MatchError(ContainSubstring("unable to open network namespace /proc/self/ns/missing")))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package nftables
+
+import (
+	"github.com/vishvananda/netlink"
+)
+
+// NewNetlinkGuard creates a Guard programming nftables over netlink, which
+// is only available on linux
+func NewNetlinkGuard(netnsPath string, opts GuardOpts) (Guard, error) {
+	return nil, netlink.ErrNotImplemented
+}
@@ -0,0 +1,183 @@
+package initalizer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+)
+
+const (
+	defaultResyncInterval   = time.Minute
+	defaultChangeDebounce   = time.Second
+	maxResubscribeBackoff   = 30 * time.Second
+	startResubscribeBackoff = time.Second
+)
+
+var (
+	promNetworkDrift = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_identity_network_drift",
+		Help: "Changes to the agent link, addresses or routes reverted by the reconciler",
+	}, []string{"reason"})
+	promNetworkInSync = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_identity_network_in_sync",
+		Help: "Whether the agent link, addresses and routes are as set up by initialize",
+	})
+)
+
+// A ChangeNotifier tells when links, addresses or routes on the host change
+type ChangeNotifier interface {
+	// Subscribe sends a description of every change to changes until ctx
+	// is done. It returns an error if the subscription fails or is lost.
+	// Sending to changes must not block, changes can be dropped when
+	// there is already one pending.
+	Subscribe(ctx context.Context, changes chan<- string) error
+}
+
+type ReconcilerOpts struct {
+	// ResyncInterval is how often the host is checked for drift even if no
+	// change was notified, in case a notification was missed
+	ResyncInterval time.Duration
+	// ChangeDebounce is how long to wait after a change before checking,
+	// so bursts of changes are handled at once
+	ChangeDebounce time.Duration
+}
+
+// A Reconciler keeps the host as set up by Executor.Initialize, reverting
+// changes made by other software (CNI, NetworkManager...) that would make
+// the agent unreachable
+type Reconciler struct {
+	executor *Executor
+	notifier ChangeNotifier
+	opts     ReconcilerOpts
+
+	mu      sync.Mutex
+	state   error
+	checked bool
+}
+
+func NewReconciler(executor *Executor, opts ReconcilerOpts) *Reconciler {
+	return newReconciler(executor, netlinkChangeNotifier{}, opts)
+}
+
+func newReconciler(executor *Executor, notifier ChangeNotifier, opts ReconcilerOpts) *Reconciler {
+	if opts.ResyncInterval <= 0 {
+		opts.ResyncInterval = defaultResyncInterval
+	}
+	if opts.ChangeDebounce <= 0 {
+		opts.ChangeDebounce = defaultChangeDebounce
+	}
+	return &Reconciler{
+		executor: executor,
+		notifier: notifier,
+		opts:     opts,
+	}
+}
+
+// Run initializes the host and keeps it initialized until ctx is done
+func (r *Reconciler) Run(ctx context.Context) {
+	ctx = logger.ContextWithField(ctx, "component", "network-reconciler")
+	changes := make(chan string, 1)
+	go r.watchChanges(ctx, changes)
+
+	r.setState(r.executor.Initialize(ctx))
+	ticker := time.NewTicker(r.opts.ResyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-changes:
+			logger.FromContext(ctx).Debugf("Network changed (%s), checking for drift", change)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.opts.ChangeDebounce):
+			}
+			// the changes during the debounce are covered by this check
+			select {
+			case <-changes:
+			default:
+			}
+			r.reconcile(ctx)
+		case <-ticker.C:
+			r.reconcile(ctx)
+		}
+	}
+}
+
+// Ready returns an error while the host is not as set up by initialize
+func (r *Reconciler) Ready(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.checked {
+		return fmt.Errorf("network was not initialized yet")
+	}
+	return r.state
+}
+
+// reconcile checks the host for drift and initializes it again if needed
+func (r *Reconciler) reconcile(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	drift, err := r.executor.CheckState(ctx)
+	if err != nil {
+		log.Errorf("Unable to check network for drift: %v", err)
+		r.setState(fmt.Errorf("unable to check network: %w", err))
+		return
+	}
+	if len(drift) == 0 {
+		r.setState(nil)
+		return
+	}
+
+	for _, d := range drift {
+		log.Warnf("Network drift detected, %s", d)
+		promNetworkDrift.WithLabelValues(d.Reason).Inc()
+	}
+	if err := r.executor.Initialize(ctx); err != nil {
+		r.setState(fmt.Errorf("unable to revert network drift %v: %w", drift, err))
+		return
+	}
+	drift, err = r.executor.CheckState(ctx)
+	if err == nil && len(drift) != 0 {
+		err = fmt.Errorf("network drift persists after initializing again: %v", drift)
+	}
+	r.setState(err)
+}
+
+func (r *Reconciler) setState(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = err
+	r.checked = true
+	if err != nil {
+		promNetworkInSync.Set(0)
+	} else {
+		promNetworkInSync.Set(1)
+	}
+}
+
+// watchChanges subscribes to network changes, subscribing again with
+// backoff when the subscription fails. Missed changes are caught on resync.
+func (r *Reconciler) watchChanges(ctx context.Context, changes chan<- string) {
+	log := logger.FromContext(ctx)
+	backoff := startResubscribeBackoff
+	for {
+		err := r.notifier.Subscribe(ctx, changes)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Errorf("Network change subscription failed, subscribing again in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxResubscribeBackoff)
+	}
+}
@@ -0,0 +1,129 @@
+package initalizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+)
+
+// fakeChangeNotifier forwards the changes sent by the test
+type fakeChangeNotifier struct {
+	changes chan string
+}
+
+func (f *fakeChangeNotifier) Subscribe(ctx context.Context, changes chan<- string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-f.changes:
+			changes <- change
+		}
+	}
+}
+
+func TestReconciler_Run(t *testing.T) {
+	ipv4 := mustParseAddr(configuration.DefaultIpv4TargetHost + "/32")
+
+	testCases := []struct {
+		name          string
+		change        func(g Gomega, handle *fakeNetlinkHandle)
+		expectedReady string
+	}{
+		{
+			name: "sets the link up again",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				g.Expect(handle.linkSetDown(configuration.AgentLinkName)).To(Succeed())
+			},
+		},
+		{
+			name: "creates the link again",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.LinkDel(link)).To(Succeed())
+			},
+		},
+		{
+			name: "adds the removed address and route",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.AddrDel(link, ipv4)).To(Succeed())
+				g.Expect(handle.RouteDel(&netlink.Route{Dst: ipv4.IPNet, LinkIndex: link.Attrs().Index})).To(Succeed())
+			},
+		},
+		{
+			name: "is not ready while a route goes through another link",
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				g.Expect(handle.LinkAdd(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "other0"}})).To(Succeed())
+				g.Expect(handle.routeThrough(ipv4.IPNet, "other0")).To(Succeed())
+			},
+			expectedReady: "unable to revert network drift",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// setup
+			handle := newFakeNetlinkHandle()
+			executor, err := newExecutor(handle, ExecutorOpts{})
+			g.Expect(err).ToNot(HaveOccurred())
+			notifier := &fakeChangeNotifier{changes: make(chan string)}
+			reconciler := newReconciler(executor, notifier, ReconcilerOpts{
+				ResyncInterval: time.Hour,
+				ChangeDebounce: time.Millisecond,
+			})
+			g.Expect(reconciler.Ready(ctx)).ToNot(Succeed())
+			go reconciler.Run(ctx)
+			g.Eventually(func() error { return reconciler.Ready(ctx) }).Should(Succeed())
+
+			// trigger
+			tc.change(g, handle)
+			notifier.changes <- "test change"
+
+			// validate
+			if tc.expectedReady != "" {
+				g.Eventually(func() error { return reconciler.Ready(ctx) }).
+					Should(MatchError(ContainSubstring(tc.expectedReady)))
+				return
+			}
+			g.Eventually(func() ([]Drift, error) {
+				return executor.CheckState(ctx)
+			}).Should(BeEmpty())
+			g.Expect(reconciler.Ready(ctx)).To(Succeed())
+		})
+	}
+}
+
+func TestReconciler_Run_Resyncs(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// setup, the notifier never reports anything
+	handle := newFakeNetlinkHandle()
+	executor, err := newExecutor(handle, ExecutorOpts{})
+	g.Expect(err).ToNot(HaveOccurred())
+	reconciler := newReconciler(executor, &fakeChangeNotifier{}, ReconcilerOpts{
+		ResyncInterval: 10 * time.Millisecond,
+	})
+	go reconciler.Run(ctx)
+	g.Eventually(func() error { return reconciler.Ready(ctx) }).Should(Succeed())
+
+	// trigger
+	g.Expect(handle.linkSetDown(configuration.AgentLinkName)).To(Succeed())
+
+	// validate
+	g.Eventually(func() ([]Drift, error) {
+		return executor.CheckState(ctx)
+	}).Should(BeEmpty())
+}
@@ -0,0 +1,161 @@
+package initalizer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.amzn.com/eks/eks-pod-identity-agent/internal/middleware/logger"
+)
+
+const (
+	defaultAddrPollInterval = 100 * time.Millisecond
+	defaultAddrWaitTimeout  = 30 * time.Second
+	startStartupBackoff     = time.Second
+	maxStartupBackoff       = 30 * time.Second
+)
+
+// StartupOpts configures how the network is set up before the agent
+// servers start
+type StartupOpts struct {
+	// Bind binds the listeners of the agent servers, it is called again
+	// with backoff until it succeeds so listeners bound by a previous
+	// call must be kept. failedAddrs are the addresses of optional
+	// families that could not be set up, listeners on them must be
+	// skipped as they would never bind.
+	Bind func(ctx context.Context, failedAddrs []net.IP) error
+	// AddrPollInterval is how often the addresses are checked while they
+	// cannot be bound to, eg. while IPv6 duplicate address detection is
+	// in progress
+	AddrPollInterval time.Duration
+	// AddrWaitTimeout is how long to wait for the addresses before
+	// reporting an error and waiting again after backoff
+	AddrWaitTimeout time.Duration
+	// MinBackoff and MaxBackoff bound the wait between failed steps
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// A Startup initializes the network and binds the agent listeners to the
+// addresses once they are usable, so the agent can run without a separate
+// initialize. Its progress is reported through Ready.
+type Startup struct {
+	executor *Executor
+	opts     StartupOpts
+
+	mu       sync.Mutex
+	progress error
+}
+
+func NewStartup(executor *Executor, opts StartupOpts) *Startup {
+	if opts.AddrPollInterval <= 0 {
+		opts.AddrPollInterval = defaultAddrPollInterval
+	}
+	if opts.AddrWaitTimeout <= 0 {
+		opts.AddrWaitTimeout = defaultAddrWaitTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = startStartupBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = maxStartupBackoff
+	}
+	return &Startup{
+		executor: executor,
+		opts:     opts,
+		progress: fmt.Errorf("network startup has not started"),
+	}
+}
+
+// Run initializes the network, waits for the addresses to be usable and
+// binds the listeners, repeating each step with backoff until it
+// succeeds. It only fails if ctx is done first.
+func (s *Startup) Run(ctx context.Context) error {
+	ctx = logger.ContextWithField(ctx, "component", "network-startup")
+
+	steps := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{name: "initializing network", run: s.executor.Initialize},
+		{name: "waiting for addresses", run: s.waitForAddrs},
+		{name: "binding listeners", run: s.bind},
+	}
+	for _, step := range steps {
+		if err := s.retry(ctx, step.name, step.run); err != nil {
+			return err
+		}
+	}
+	s.setProgress(nil)
+	logger.FromContext(ctx).Info("Network is ready")
+	return nil
+}
+
+// Ready returns an error describing the step Run is at until it completes
+func (s *Startup) Ready(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.progress
+}
+
+// retry runs step until it succeeds, waiting with backoff after failures
+func (s *Startup) retry(ctx context.Context, name string, step func(ctx context.Context) error) error {
+	log := logger.FromContext(ctx)
+	backoff := s.opts.MinBackoff
+	for attempt := 1; ; attempt++ {
+		s.setProgress(fmt.Errorf("%s (attempt %d)", name, attempt))
+		err := step(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Errorf("Failed %s, trying again in %v: %v", name, backoff, err)
+		s.setProgress(fmt.Errorf("failed %s (attempt %d), trying again in %v: %w", name, attempt, backoff, err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s.opts.MaxBackoff)
+	}
+}
+
+// bind binds the listeners but those on the addresses Initialize could not
+// set up
+func (s *Startup) bind(ctx context.Context) error {
+	return s.opts.Bind(ctx, s.executor.FailedAddrs())
+}
+
+// waitForAddrs polls the addresses until they can all be bound to
+func (s *Startup) waitForAddrs(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	deadline := time.After(s.opts.AddrWaitTimeout)
+	for {
+		pending, err := s.executor.PendingAddrs(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		log.Debugf("Addresses %v cannot be bound to yet", pending)
+		s.setProgress(fmt.Errorf("waiting for addresses %v to be usable", pending))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("addresses %v are still not usable after %v", pending, s.opts.AddrWaitTimeout)
+		case <-time.After(s.opts.AddrPollInterval):
+		}
+	}
+}
+
+func (s *Startup) setProgress(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress = err
+}
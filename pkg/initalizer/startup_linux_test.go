@@ -0,0 +1,183 @@
+package initalizer
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+	"golang.org/x/sys/unix"
+)
+
+func TestStartup_Run(t *testing.T) {
+	ipv6 := net.ParseIP(configuration.DefaultIpv6TargetHost)
+
+	testCases := []struct {
+		name string
+		// setup changes the host before the startup runs
+		setup func(handle *fakeNetlinkHandle)
+		// failBinding makes binding fail until the change
+		failBinding bool
+		// expectedProgress is reported by Ready before the change
+		expectedProgress string
+		// change lets the startup complete
+		change func(handle *fakeNetlinkHandle)
+	}{
+		{
+			name: "ready once the listeners are bound",
+		},
+		{
+			name: "waits for tentative addresses",
+			setup: func(handle *fakeNetlinkHandle) {
+				handle.addrAddFlags[unix.AF_INET6] = unix.IFA_F_TENTATIVE
+			},
+			expectedProgress: "waiting for addresses [" + configuration.DefaultIpv6TargetHost + "] to be usable",
+			change: func(handle *fakeNetlinkHandle) {
+				handle.setAddrFlags(ipv6, 0)
+			},
+		},
+		{
+			name: "reports duplicate addresses",
+			setup: func(handle *fakeNetlinkHandle) {
+				handle.addrAddFlags[unix.AF_INET6] = unix.IFA_F_TENTATIVE | unix.IFA_F_DADFAILED
+			},
+			expectedProgress: "duplicate address detection failed",
+			change: func(handle *fakeNetlinkHandle) {
+				handle.setAddrFlags(ipv6, 0)
+			},
+		},
+		{
+			name: "initializes again after failures",
+			setup: func(handle *fakeNetlinkHandle) {
+				handle.addrAddErrs[unix.AF_INET] = unix.EPERM
+			},
+			expectedProgress: "failed initializing network",
+			change: func(handle *fakeNetlinkHandle) {
+				handle.mu.Lock()
+				defer handle.mu.Unlock()
+				delete(handle.addrAddErrs, unix.AF_INET)
+			},
+		},
+		{
+			name:             "binds again after failures",
+			failBinding:      true,
+			expectedProgress: "failed binding listeners",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// setup
+			handle := newFakeNetlinkHandle()
+			if tc.setup != nil {
+				tc.setup(handle)
+			}
+			executor, err := newExecutor(handle, ExecutorOpts{})
+			g.Expect(err).ToNot(HaveOccurred())
+			var binds atomic.Int32
+			var bindFails atomic.Bool
+			bindFails.Store(tc.failBinding)
+			startup := NewStartup(executor, StartupOpts{
+				Bind: func(ctx context.Context, failedAddrs []net.IP) error {
+					binds.Add(1)
+					if bindFails.Load() {
+						return assert.AnError
+					}
+					return nil
+				},
+				AddrPollInterval: time.Millisecond,
+				MinBackoff:       time.Millisecond,
+				MaxBackoff:       10 * time.Millisecond,
+			})
+			g.Expect(startup.Ready(ctx)).ToNot(Succeed())
+
+			// trigger
+			done := make(chan error, 1)
+			go func() { done <- startup.Run(ctx) }()
+
+			// validate
+			if tc.expectedProgress != "" {
+				g.Eventually(func() error { return startup.Ready(ctx) }).
+					Should(MatchError(ContainSubstring(tc.expectedProgress)))
+			}
+			if tc.change != nil {
+				tc.change(handle)
+			}
+			bindFails.Store(false)
+			g.Eventually(done).Should(Receive(BeNil()))
+			g.Expect(startup.Ready(ctx)).To(Succeed())
+			if tc.failBinding {
+				g.Expect(binds.Load()).To(BeNumerically(">", 1))
+			} else {
+				g.Expect(binds.Load()).To(Equal(int32(1)))
+			}
+		})
+	}
+}
+
+func TestStartup_Run_Cancelled(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// setup, binding never succeeds
+	executor, err := newExecutor(newFakeNetlinkHandle(), ExecutorOpts{})
+	g.Expect(err).ToNot(HaveOccurred())
+	startup := NewStartup(executor, StartupOpts{
+		Bind:       func(ctx context.Context, failedAddrs []net.IP) error { return assert.AnError },
+		MinBackoff: time.Millisecond,
+	})
+	done := make(chan error, 1)
+	go func() { done <- startup.Run(ctx) }()
+	g.Eventually(func() error { return startup.Ready(ctx) }).
+		Should(MatchError(ContainSubstring("failed binding listeners")))
+
+	// trigger
+	cancel()
+
+	// validate
+	g.Eventually(done).Should(Receive(MatchError(context.Canceled)))
+	g.Expect(startup.Ready(ctx)).ToNot(Succeed())
+}
+
+func TestStartup_Run_OptionalFamilyFails(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// setup, IPv6 is optional and its address cannot be added
+	handle := newFakeNetlinkHandle()
+	handle.addrAddErrs[unix.AF_INET6] = unix.EPERM
+	executor, err := newExecutor(handle, ExecutorOpts{})
+	g.Expect(err).ToNot(HaveOccurred())
+	var boundAddrs []net.IP
+	startup := NewStartup(executor, StartupOpts{
+		Bind: func(ctx context.Context, failedAddrs []net.IP) error {
+			for _, addr := range []string{configuration.DefaultIpv4TargetHost, configuration.DefaultIpv6TargetHost} {
+				ip := net.ParseIP(addr)
+				if !slices.ContainsFunc(failedAddrs, ip.Equal) {
+					boundAddrs = append(boundAddrs, ip)
+				}
+			}
+			return nil
+		},
+		AddrPollInterval: time.Millisecond,
+		MinBackoff:       time.Millisecond,
+	})
+
+	// trigger
+	err = startup.Run(ctx)
+
+	// validate, only the IPv4 listener is bound and the agent is ready
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(boundAddrs).To(Equal([]net.IP{net.ParseIP(configuration.DefaultIpv4TargetHost)}))
+	g.Expect(executor.FailedAddrs()).To(Equal([]net.IP{net.ParseIP(configuration.DefaultIpv6TargetHost)}))
+	g.Expect(startup.Ready(ctx)).To(Succeed())
+}
@@ -0,0 +1,170 @@
+package initalizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.amzn.com/eks/eks-pod-identity-agent/pkg/initalizer/iproute"
+)
+
+// CheckStatus is the outcome of a verification check
+type CheckStatus string
+
+const (
+	CheckOk CheckStatus = "ok"
+	// CheckWarning is a problem with an optional family, the agent still
+	// works without it
+	CheckWarning CheckStatus = "warning"
+	CheckFailed  CheckStatus = "failed"
+	// CheckSkipped checks could not run because an earlier one failed
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// A Check is one of the things Verify inspects on the host
+type Check struct {
+	// Name is one of link, link_up, address, route, conflicting_routes and,
+	// when the routes are in their own table, rule or shadowing_rules
+	Name   string      `json:"name"`
+	Target string      `json:"target"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// A VerifyReport lists the checks run by Verify
+type VerifyReport struct {
+	Checks []Check `json:"checks"`
+}
+
+// Ok is false if any of the checks failed, warnings do not count
+func (r VerifyReport) Ok() bool {
+	for _, check := range r.Checks {
+		if check.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *VerifyReport) add(name, target string, status CheckStatus, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, Target: target, Status: status, Detail: detail})
+}
+
+// Verify inspects the host, without changing it, to report whether it is
+// set up as Initialize would. Errors are only returned when the host cannot
+// be inspected, problems with the setup are reported as failed checks.
+func (e *Executor) Verify(ctx context.Context) (VerifyReport, error) {
+	var report VerifyReport
+
+	link, err := e.agentLinkRetriever.GetLink(ctx)
+	if errors.Is(err, iproute.ErrLinkNotFound) || errors.Is(err, iproute.ErrWrongLinkType) {
+		detail := "link does not exist"
+		if errors.Is(err, iproute.ErrWrongLinkType) {
+			detail = err.Error()
+		}
+		report.add("link", e.linkName, CheckFailed, detail)
+		report.add("link_up", e.linkName, CheckSkipped, "")
+		for _, fam := range e.families {
+			target := fam.LinkLocalAddr.IPNet.String()
+			report.add("address", target, CheckSkipped, "")
+			report.add("route", target, CheckSkipped, "")
+			report.add("conflicting_routes", target, CheckSkipped, "")
+			if e.usesRouteTable {
+				report.add("rule", target, CheckSkipped, "")
+				report.add("shadowing_rules", target, CheckSkipped, "")
+			}
+		}
+		return report, nil
+	}
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	report.add("link", link.Name(), CheckOk, "")
+	if link.IsUp() {
+		report.add("link_up", link.Name(), CheckOk, "")
+	} else {
+		report.add("link_up", link.Name(), CheckFailed, "link is down")
+	}
+
+	for _, fam := range e.families {
+		target := fam.LinkLocalAddr.IPNet.String()
+		problem := CheckFailed
+		if e.addressFamilies.isOptional(fam.Family) {
+			problem = CheckWarning
+		}
+
+		hasAddr, err := link.HasAddrFamily(ctx, fam)
+		if err != nil {
+			return VerifyReport{}, fmt.Errorf("unable to check address %s: %w", target, err)
+		}
+		if hasAddr {
+			report.add("address", target, CheckOk, "")
+		} else {
+			report.add("address", target, problem, fmt.Sprintf("address is not attached to %s", link.Name()))
+		}
+
+		// a route through another link is reported by the conflicting
+		// routes check as well, with all the routes involved
+		hasRoute, err := link.HasRouteForAddrFamily(ctx, fam)
+		switch {
+		case err != nil:
+			report.add("route", target, problem, err.Error())
+		case hasRoute:
+			report.add("route", target, CheckOk, "")
+		default:
+			report.add("route", target, problem, fmt.Sprintf("there is no route through %s", link.Name()))
+		}
+
+		conflicts, err := link.ConflictingRoutesForAddrFamily(ctx, fam)
+		if err != nil {
+			return VerifyReport{}, fmt.Errorf("unable to check routes to %s: %w", target, err)
+		}
+		if len(conflicts) == 0 {
+			report.add("conflicting_routes", target, CheckOk, "")
+		} else {
+			routes := make([]string, len(conflicts))
+			for i, route := range conflicts {
+				routes[i] = fmt.Sprintf("%s via iface idx %d", route.Dst, route.LinkIndex)
+			}
+			report.add("conflicting_routes", target, problem, strings.Join(routes, ", "))
+		}
+
+		if e.usesRouteTable {
+			if err := e.verifyRules(ctx, &report, link, fam, problem); err != nil {
+				return VerifyReport{}, err
+			}
+		}
+	}
+	return report, nil
+}
+
+func (e *Executor) verifyRules(ctx context.Context, report *VerifyReport, link iproute.AgentLink, fam iproute.AddrFamily, problem CheckStatus) error {
+	target := fam.LinkLocalAddr.IPNet.String()
+
+	hasRule, err := link.HasRuleForAddrFamily(ctx, fam)
+	if err != nil {
+		return fmt.Errorf("unable to check rules to %s: %w", target, err)
+	}
+	if hasRule {
+		report.add("rule", target, CheckOk, "")
+	} else {
+		report.add("rule", target, problem, "there is no rule looking up the agent route table")
+	}
+
+	shadowing, err := link.ShadowingRulesForAddrFamily(ctx, fam)
+	if err != nil {
+		return fmt.Errorf("unable to check rules to %s: %w", target, err)
+	}
+	if len(shadowing) == 0 {
+		report.add("shadowing_rules", target, CheckOk, "")
+		return nil
+	}
+	rules := make([]string, len(shadowing))
+	for i, rule := range shadowing {
+		rules[i] = fmt.Sprintf("%d: from %v to %v table %d", rule.Priority, rule.Src, rule.Dst, rule.Table)
+	}
+	report.add("shadowing_rules", target, problem, strings.Join(rules, ", "))
+	return nil
+}
@@ -0,0 +1,109 @@
+package initalizer
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"go.amzn.com/eks/eks-pod-identity-agent/configuration"
+)
+
+func TestExecutor_Verify(t *testing.T) {
+	ipv4 := mustParseAddr(configuration.DefaultIpv4TargetHost + "/32")
+	ipv6 := mustParseAddr(configuration.DefaultIpv6TargetHost + "/128")
+
+	testCases := []struct {
+		name           string
+		initialize     bool
+		change         func(g Gomega, handle *fakeNetlinkHandle)
+		expectedFailed map[string]CheckStatus
+		expectedOk     bool
+	}{
+		{
+			name:       "everything is set up",
+			initialize: true,
+			expectedOk: true,
+		},
+		{
+			name: "link does not exist",
+			expectedFailed: map[string]CheckStatus{
+				"link " + configuration.AgentLinkName:       CheckFailed,
+				"link_up " + configuration.AgentLinkName:    CheckSkipped,
+				"address " + ipv4.IPNet.String():            CheckSkipped,
+				"route " + ipv4.IPNet.String():              CheckSkipped,
+				"conflicting_routes " + ipv4.IPNet.String(): CheckSkipped,
+				"address " + ipv6.IPNet.String():            CheckSkipped,
+				"route " + ipv6.IPNet.String():              CheckSkipped,
+				"conflicting_routes " + ipv6.IPNet.String(): CheckSkipped,
+			},
+		},
+		{
+			name:       "link is down and the IPv4 address is missing",
+			initialize: true,
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				g.Expect(handle.linkSetDown(configuration.AgentLinkName)).To(Succeed())
+				link, err := handle.LinkByName(configuration.AgentLinkName)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(handle.AddrDel(link, ipv4)).To(Succeed())
+			},
+			expectedFailed: map[string]CheckStatus{
+				"link_up " + configuration.AgentLinkName: CheckFailed,
+				"address " + ipv4.IPNet.String():         CheckFailed,
+			},
+		},
+		{
+			name:       "IPv6 route goes through another link",
+			initialize: true,
+			change: func(g Gomega, handle *fakeNetlinkHandle) {
+				g.Expect(handle.LinkAdd(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "other0"}})).To(Succeed())
+				g.Expect(handle.routeThrough(ipv6.IPNet, "other0")).To(Succeed())
+			},
+			expectedFailed: map[string]CheckStatus{
+				"route " + ipv6.IPNet.String():              CheckWarning,
+				"conflicting_routes " + ipv6.IPNet.String(): CheckWarning,
+			},
+			// IPv6 is optional
+			expectedOk: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			// setup
+			handle := newFakeNetlinkHandle()
+			executor, err := newExecutor(handle, ExecutorOpts{})
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.initialize {
+				g.Expect(executor.Initialize(ctx)).To(Succeed())
+			}
+			if tc.change != nil {
+				tc.change(g, handle)
+			}
+			linksBefore := len(handle.links)
+
+			// trigger
+			report, err := executor.Verify(ctx)
+
+			// validate
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(report.Checks).To(HaveLen(8))
+			failed := map[string]CheckStatus{}
+			for _, check := range report.Checks {
+				if check.Status != CheckOk {
+					failed[check.Name+" "+check.Target] = check.Status
+				}
+			}
+			if tc.expectedFailed == nil {
+				g.Expect(failed).To(BeEmpty())
+			} else {
+				g.Expect(failed).To(Equal(tc.expectedFailed))
+			}
+			g.Expect(report.Ok()).To(Equal(tc.expectedOk))
+			g.Expect(handle.links).To(HaveLen(linksBefore))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"time"
 
@@ -31,6 +32,9 @@ type (
 		// server contains the HTTP server that will listen to requests
 		server *http.Server
 		mux    *http.ServeMux
+		// listener is set by Listen, otherwise the server binds its
+		// address when it starts
+		listener net.Listener
 	}
 )
 
@@ -52,25 +56,62 @@ func newBaseServer(addr string) *Server {
 	}
 }
 
-func NewProbeServer(addr string, hosts []string, port uint16) *Server {
+func NewProbeServer(addr string, target handlers.ProbeTarget, readinessChecks ...handlers.ReadinessCheck) *Server {
 	srv := newBaseServer(addr)
-	srv.configurer = handlers.NewProbeHandler(hosts, port)
+	srv.configurer = handlers.NewProbeHandler(target, readinessChecks...)
 	return srv
 }
 
-func NewEksCredentialServer(addr string, opts handlers.EksCredentialHandlerOpts) *Server {
+// NewEksCredentialServer creates a server of the credentials endpoint. The
+// handler can be shared by several servers, eg. one per bind address, so
+// they share the credentials cache and the calls to EKS Auth. The server
+// does not close the handler, callers close it once all its servers stopped.
+func NewEksCredentialServer(addr string, handler *handlers.EksCredentialHandler) *Server {
 	srv := newBaseServer(addr)
-	srv.configurer = handlers.NewEksCredentialHandler(opts)
+	srv.configurer = handler
 	return srv
 }
 
-func NewMetricsServer(addr string, hosts []string, port uint16) *Server {
+func NewMetricsServer(addr string, target handlers.ProbeTarget, readinessChecks ...handlers.ReadinessCheck) *Server {
 	srv := newBaseServer(addr)
-	srv.configurer = handlers.NewProbeHandler(hosts, port)
+	srv.configurer = handlers.NewProbeHandler(target, readinessChecks...)
 	srv.mux.Handle("/metrics", promhttp.Handler())
 	return srv
 }
 
+// NewAdminServer creates the server of the administrative endpoints, it
+// must only listen on localhost
+func NewAdminServer(addr string) *Server {
+	srv := newBaseServer(addr)
+	srv.configurer = handlers.NewLogLevelHandler()
+	return srv
+}
+
+// Listen binds the server address ahead of ListenUntilContextCancelled,
+// so binding errors can be handled. It does nothing if it is bound already.
+func (p *Server) Listen() error {
+	if p.listener != nil {
+		return nil
+	}
+	listener, err := net.Listen("tcp", p.server.Addr)
+	if err != nil {
+		return err
+	}
+	p.listener = listener
+	return nil
+}
+
+// Close releases the address bound by Listen, for servers that end up not
+// being started
+func (p *Server) Close() error {
+	if p.listener == nil {
+		return nil
+	}
+	err := p.listener.Close()
+	p.listener = nil
+	return err
+}
+
 func (p *Server) ListenUntilContextCancelled(ctx context.Context) {
 	log := logger.FromContext(ctx)
 	p.configureHandler()
@@ -79,7 +120,13 @@ func (p *Server) ListenUntilContextCancelled(ctx context.Context) {
 	go func() {
 		log.Infof("Pod Identity Agent version %v", configuration.AgentVersion)
 		log.Info("Starting server...")
-		if err := p.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if p.listener != nil {
+			err = p.server.Serve(p.listener)
+		} else {
+			err = p.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Unable to start server: %v", err)
 		}
 		log.Debug("Server has stopped listening")
@@ -179,3 +179,90 @@ func TestEksCredentialServer(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_Listen(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// setup
+	srv := NewProbeServer("127.0.0.1:0", handlers.ProbeTarget{})
+
+	// trigger, binding again does nothing
+	g.Expect(srv.Listen()).To(Succeed())
+	listener := srv.listener
+	g.Expect(srv.Listen()).To(Succeed())
+	go srv.ListenUntilContextCancelled(ctx)
+
+	// validate, the server answers on the address bound first
+	g.Expect(srv.listener).To(BeIdenticalTo(listener))
+	resp, err := http.Get("http://" + listener.Addr().String() + "/healthz")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+	// validate, binding a used address fails
+	g.Expect(NewAdminServer(listener.Addr().String()).Listen()).ToNot(Succeed())
+}
+
+func TestServer_Close(t *testing.T) {
+	g := NewWithT(t)
+
+	// setup
+	srv := NewProbeServer("127.0.0.1:0", handlers.ProbeTarget{})
+	g.Expect(srv.Listen()).To(Succeed())
+	addr := srv.listener.Addr().String()
+
+	// trigger
+	err := srv.Close()
+
+	// validate, the address is released and closing again does nothing
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(srv.Close()).To(Succeed())
+	other := NewAdminServer(addr)
+	g.Expect(other.Listen()).To(Succeed())
+	g.Expect(other.Close()).To(Succeed())
+}
+
+// closingRetriever records whether it was closed
+type closingRetriever struct {
+	credentials.CredentialRetriever
+	closed chan struct{}
+}
+
+func (r closingRetriever) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestServer_ListenUntilContextCancelled_SharesHandler(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// setup, two servers serve the same handler
+	retriever := closingRetriever{closed: make(chan struct{})}
+	handler := &handlers.EksCredentialHandler{CredentialRetriever: retriever}
+	var servers []*Server
+	for range 2 {
+		srv := NewEksCredentialServer("127.0.0.1:0", handler)
+		g.Expect(srv.Listen()).To(Succeed())
+		servers = append(servers, srv)
+	}
+	stopped := make(chan struct{}, len(servers))
+	for _, srv := range servers {
+		go func() {
+			srv.ListenUntilContextCancelled(ctx)
+			stopped <- struct{}{}
+		}()
+	}
+
+	// trigger
+	cancel()
+
+	// validate, the shared handler is left for the caller to close
+	for range servers {
+		g.Eventually(stopped).Should(Receive())
+	}
+	g.Expect(retriever.closed).ToNot(BeClosed())
+	g.Expect(handler.Close()).To(Succeed())
+	g.Expect(retriever.closed).To(BeClosed())
+}